@@ -0,0 +1,684 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/conversation"
+	"github.com/yuki5155/go-strands-agents/cost"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/logging"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/session"
+	"github.com/yuki5155/go-strands-agents/telemetry"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const DefaultAgentID = "default"
+const DefaultMaxCycles = 20
+
+// DefaultMaxParallelTools runs the tool calls of a turn one after the other
+const DefaultMaxParallelTools = 1
+
+var (
+	ErrMaxCycles = errors.New("agents: maximum number of event loop cycles reached")
+	// ErrToolTimeout is the cause of the cancellation of a tool call that took longer than its timeout
+	ErrToolTimeout = errors.New("agents: tool call timed out")
+	// ErrTreeHistory is returned by NewAgent when the session holds the branches of a conversation.Tree for the agent,
+	// use WithTree to run the agent on the tree
+	ErrTreeHistory = errors.New("agents: the history of the agent is managed by a conversation tree")
+)
+
+// PanicError is the error of a tool call that panicked
+type PanicError struct {
+	Tool  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("agents: tool %s panicked: %v", e.Tool, e.Value)
+}
+
+// Agent runs the event loop: call the model, run the tools it asks for, repeat until it stops
+type Agent struct {
+	ID       string
+	Client   *models.AnthropicClient
+	Messages []anthropic.MessageParam
+	State    *AgentState
+	Tools    *tools.Registry
+	// Hooks receives the agent's lifecycle events and the events of its model calls
+	Hooks *hooks.Registry
+
+	systemPrompt  string
+	maxCycles     int
+	session       *session.Manager
+	tree          *conversation.Tree
+	tracer        *telemetry.Tracer
+	costTrackers  []*cost.Tracker
+	streamHandler models.StreamHandler
+	logger        *slog.Logger
+	optionErr     error
+	// maxParallelTools bounds the tool calls of a turn that run concurrently
+	maxParallelTools   int
+	cancelToolsOnError bool
+	toolTimeout        time.Duration
+
+	// mu allows one invocation at a time
+	mu sync.Mutex
+}
+
+type AgentOption func(a *Agent)
+
+func WithAgentID(id string) AgentOption {
+	return func(a *Agent) {
+		a.ID = id
+	}
+}
+
+func WithSystemPrompt(prompt string) AgentOption {
+	return func(a *Agent) {
+		a.systemPrompt = prompt
+	}
+}
+
+func WithTools(ts ...tools.Tool) AgentOption {
+	return func(a *Agent) {
+		if err := a.Tools.Register(ts...); err != nil && a.optionErr == nil {
+			a.optionErr = err
+		}
+	}
+}
+
+// WithHooks registers hook providers on the agent's registry
+func WithHooks(providers ...hooks.Provider) AgentOption {
+	return func(a *Agent) {
+		a.Hooks.AddProvider(providers...)
+	}
+}
+
+// WithTracer sets the tracer of the agent's spans, the default uses the global TracerProvider
+func WithTracer(tracer *telemetry.Tracer) AgentOption {
+	return func(a *Agent) {
+		a.tracer = tracer
+	}
+}
+
+// WithCostTrackers charges the agent's model calls to trackers, e.g. per session or per tenant
+// Once a tracker's budget is spent, Invoke fails with a *cost.BudgetExceededError
+func WithCostTrackers(trackers ...*cost.Tracker) AgentOption {
+	return func(a *Agent) {
+		a.costTrackers = append(a.costTrackers, trackers...)
+	}
+}
+
+// WithStreamHandler receives the stream events of every model call and a ToolResultEvent for every tool call
+func WithStreamHandler(handler models.StreamHandler) AgentOption {
+	return func(a *Agent) {
+		a.streamHandler = handler
+	}
+}
+
+type streamHandlerContextKey struct{}
+
+// ContextWithStreamHandler makes the invocations run with ctx deliver their events to handler besides the agent's handler,
+// e.g. to forward the answer of an agent that is called as a tool
+func ContextWithStreamHandler(ctx context.Context, handler models.StreamHandler) context.Context {
+	return context.WithValue(ctx, streamHandlerContextKey{}, handler)
+}
+
+// handler combines the agent's stream handler with the one of ctx
+func (a *Agent) handler(ctx context.Context) models.StreamHandler {
+	handler, _ := ctx.Value(streamHandlerContextKey{}).(models.StreamHandler)
+	switch {
+	case handler == nil:
+		return a.streamHandler
+	case a.streamHandler == nil:
+		return handler
+	}
+	return models.Handlers(a.streamHandler, handler)
+}
+
+// WithLogger sets the logger of invocations and tool calls, the default is the client's logger
+func WithLogger(logger *slog.Logger) AgentOption {
+	return func(a *Agent) {
+		a.logger = logging.Redact(logger)
+	}
+}
+
+// WithToolRegistry replaces the agent's registry, apply it before WithTools
+func WithToolRegistry(registry *tools.Registry) AgentOption {
+	return func(a *Agent) {
+		a.Tools = registry
+	}
+}
+
+// WithMessages seeds the history, a history restored from the session takes precedence
+func WithMessages(messages ...anthropic.MessageParam) AgentOption {
+	return func(a *Agent) {
+		a.Messages = append(a.Messages, messages...)
+	}
+}
+
+// WithState seeds the state, a state restored from the session takes precedence
+func WithState(state *AgentState) AgentOption {
+	return func(a *Agent) {
+		a.State = state
+	}
+}
+
+func WithMaxCycles(maxCycles int) AgentOption {
+	return func(a *Agent) {
+		a.maxCycles = maxCycles
+	}
+}
+
+// WithMaxParallelTools runs up to n tool calls of a turn concurrently, replacing DefaultMaxParallelTools
+// The results keep the order of the tool uses, tools marked with tools.Sequential run alone
+// With n > 1 the BeforeToolCall and AfterToolCall callbacks of the calls run concurrently too,
+// callbacks sharing state across calls must synchronize it
+func WithMaxParallelTools(n int) AgentOption {
+	return func(a *Agent) {
+		a.maxParallelTools = n
+	}
+}
+
+// WithCancelToolsOnError cancels the context of the other tool calls of a turn when a tool returns an error,
+// the calls that did not start yet fail, by default a failing tool does not affect its siblings
+func WithCancelToolsOnError(cancel bool) AgentOption {
+	return func(a *Agent) {
+		a.cancelToolsOnError = cancel
+	}
+}
+
+// WithToolTimeout cancels the context of tool calls after timeout and stops waiting for them,
+// tools.WithTimeout sets the timeout of a single tool
+func WithToolTimeout(timeout time.Duration) AgentOption {
+	return func(a *Agent) {
+		a.toolTimeout = timeout
+	}
+}
+
+// WithSessionManager persists the history and state of the agent
+func WithSessionManager(manager *session.Manager) AgentOption {
+	return func(a *Agent) {
+		a.session = manager
+	}
+}
+
+// WithTree runs the agent on the current branch of tree, e.g. to regenerate an answer after tree.Fork or tree.Rewind
+// Every invocation reads the history of the branch that is current then and appends the new messages to it
+// The tree persists the history itself, a session manager only keeps the state of the agent with it
+func WithTree(tree *conversation.Tree) AgentOption {
+	return func(a *Agent) {
+		a.tree = tree
+	}
+}
+
+// NewAgent creates an agent, restoring its history and state when a session manager is set
+func NewAgent(ctx context.Context, client *models.AnthropicClient, options ...AgentOption) (*Agent, error) {
+	registry, _ := tools.NewRegistry()
+	agent := &Agent{
+		ID:               DefaultAgentID,
+		Client:           client,
+		Messages:         []anthropic.MessageParam{},
+		State:            NewAgentState(),
+		Tools:            registry,
+		Hooks:            hooks.NewRegistry(),
+		tracer:           telemetry.NewTracer(),
+		maxCycles:        DefaultMaxCycles,
+		maxParallelTools: DefaultMaxParallelTools,
+	}
+	for _, option := range options {
+		option(agent)
+	}
+	if agent.optionErr != nil {
+		return nil, agent.optionErr
+	}
+	if agent.logger == nil {
+		agent.logger = logging.OrDiscard(logging.Redact(client.Config.Logger))
+	}
+	if agent.tree != nil {
+		if err := agent.restoreTree(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if agent.session != nil {
+		if err := agent.restoreSession(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return agent, nil
+}
+
+// restoreTree reads the history from the tree, the seeded messages start an empty tree
+func (a *Agent) restoreTree(ctx context.Context) error {
+	if history := a.tree.Messages(); len(history) > 0 {
+		a.Messages = history
+		return nil
+	}
+	return a.tree.Append(ctx, a.Messages...)
+}
+
+func (a *Agent) restoreSession(ctx context.Context) error {
+	history, err := a.session.InitializeAgent(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+	if a.tree == nil {
+		// the flattened messages of every branch are not a history
+		branches, err := a.session.Repository().ListBranches(ctx, a.session.SessionID(), a.ID)
+		if err != nil {
+			return err
+		}
+		if len(branches) > 0 {
+			return fmt.Errorf("%w: agent %q, use WithTree", ErrTreeHistory, a.ID)
+		}
+		if len(history) > 0 {
+			a.Messages = history
+		} else if err := a.session.AppendMessages(ctx, a.ID, a.Messages...); err != nil {
+			return err
+		}
+	}
+
+	state, err := a.session.LoadState(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+	if len(state) > 0 {
+		return json.Unmarshal(state, a.State)
+	}
+	return a.saveState(ctx)
+}
+
+// AgentResult is the outcome of one invocation
+type AgentResult struct {
+	StopReason string
+	// Message is the last assistant message
+	Message anthropic.MessageParam
+	// Response is the last model response
+	Response *models.StreamingResponse
+	Metrics  *Metrics
+	// Interrupts are the tool calls waiting for decisions when StopReason is StopReasonInterrupt
+	Interrupts []Interrupt
+}
+
+// Text joins the text blocks of the last assistant message
+func (r *AgentResult) Text() string {
+	text := ""
+	for _, block := range r.Message.Content {
+		if block.OfText != nil {
+			text += block.OfText.Text
+		}
+	}
+	return text
+}
+
+// Invoke adds prompt as a user message and runs the event loop until the model stops asking for tools
+func (a *Agent) Invoke(ctx context.Context, prompt string) (*AgentResult, error) {
+	return a.InvokeMessage(ctx, anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)))
+}
+
+// InvokeMessage is Invoke for a message with arbitrary content blocks
+// It fails with ErrInterrupted while tool calls wait for decisions, see Resume
+func (a *Agent) InvokeMessage(ctx context.Context, message anthropic.MessageParam) (*AgentResult, error) {
+	return a.invoke(ctx, &message, nil)
+}
+
+// invoke runs the event loop for a new message, or for the decisions about the interrupted tool calls when message is nil
+func (a *Agent) invoke(ctx context.Context, message *anthropic.MessageParam, decisions []Decision) (result *AgentResult, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tree != nil {
+		// the current branch may have changed since the last invocation
+		a.Messages = a.tree.Messages()
+	}
+
+	started := time.Now()
+	metrics := NewMetrics()
+	hooks.Invoke(ctx, a.Hooks, &hooks.BeforeInvocation{AgentID: a.ID, Message: message})
+	a.logger.DebugContext(ctx, "agent invocation started", "agent_id", a.ID, "messages", len(a.Messages))
+	traced := []anthropic.MessageParam{}
+	if message != nil {
+		traced = append(traced, *message)
+	}
+	ctx, span := a.tracer.StartInvocation(ctx, a.ID, traced...)
+	defer func() {
+		metrics.Duration = time.Since(started)
+		if saveErr := a.saveState(ctx); saveErr != nil {
+			err = errors.Join(err, saveErr)
+		}
+		a.logInvocation(ctx, result, metrics, err)
+		event := &hooks.AfterInvocation{AgentID: a.ID, Err: err}
+		if result != nil {
+			event.StopReason = result.StopReason
+			event.Message = result.Message
+		}
+		hooks.Invoke(ctx, a.Hooks, event)
+		a.tracer.EndInvocation(span, event.StopReason, event.Message, err)
+	}()
+
+	if message == nil {
+		if err := a.resumeTools(ctx, decisions, metrics); err != nil {
+			return nil, err
+		}
+	} else {
+		if len(a.Interrupts()) > 0 {
+			return nil, ErrInterrupted
+		}
+		if err := a.appendMessage(ctx, *message); err != nil {
+			return nil, err
+		}
+	}
+	for cycle := 1; cycle <= a.maxCycles; cycle++ {
+		result, err := a.runCycle(ctx, cycle, metrics)
+		if err != nil || result != nil {
+			return result, err
+		}
+	}
+	return nil, fmt.Errorf("%w (%d)", ErrMaxCycles, a.maxCycles)
+}
+
+func (a *Agent) logInvocation(ctx context.Context, result *AgentResult, metrics *Metrics, err error) {
+	if err != nil {
+		a.logger.ErrorContext(ctx, "agent invocation failed",
+			"agent_id", a.ID,
+			"cycles", metrics.CycleCount(),
+			"duration", metrics.Duration,
+			"error", err,
+		)
+		return
+	}
+	a.logger.InfoContext(ctx, "agent invocation finished",
+		"agent_id", a.ID,
+		"stop_reason", result.StopReason,
+		"cycles", metrics.CycleCount(),
+		"input_tokens", metrics.Usage.InputTokens,
+		"output_tokens", metrics.Usage.OutputTokens,
+		"duration", metrics.Duration,
+	)
+}
+
+// runCycle calls the model once and runs the tools it asks for
+// It returns a nil result when the loop must continue
+func (a *Agent) runCycle(ctx context.Context, cycle int, metrics *Metrics) (result *AgentResult, err error) {
+	started := time.Now()
+	current := CycleMetrics{Cycle: cycle, Model: a.Client.Config.ModelId}
+	ctx, span := a.tracer.StartCycle(ctx, cycle)
+	defer func() {
+		current.Duration = time.Since(started)
+		metrics.AddCycle(current)
+		a.tracer.EndCycle(span, err)
+	}()
+
+	response, err := a.callModel(ctx, &current)
+	if err != nil {
+		return nil, err
+	}
+	assistant := response.Message.ToParam()
+	if err := a.appendMessage(ctx, assistant); err != nil {
+		return nil, err
+	}
+	if response.StopReason != string(anthropic.StopReasonToolUse) {
+		return &AgentResult{StopReason: response.StopReason, Message: assistant, Response: response, Metrics: metrics}, nil
+	}
+
+	uses := toolUses(response.Message)
+	if interrupts := a.interrupts(uses); len(interrupts) > 0 {
+		if err := a.State.Set(InterruptsStateKey, interrupts); err != nil {
+			return nil, err
+		}
+		return &AgentResult{StopReason: StopReasonInterrupt, Message: assistant, Response: response, Metrics: metrics, Interrupts: interrupts}, nil
+	}
+	results := a.runTools(ctx, uses, metrics, nil)
+	return nil, a.appendMessage(ctx, anthropic.NewUserMessage(results...))
+}
+
+// callModel streams one response and records its latency and usage in current
+func (a *Agent) callModel(ctx context.Context, current *CycleMetrics) (response *models.StreamingResponse, err error) {
+	started := time.Now()
+	ctx, span := a.tracer.StartModelCall(ctx, a.Client.Config, a.Messages)
+	defer func() {
+		current.ModelLatency = time.Since(started)
+		if response != nil {
+			current.Usage = UsageFromResponse(response)
+			current.StopReason = response.StopReason
+			current.TimeToFirstToken = response.TimeToFirstToken()
+		}
+		a.tracer.EndModelCall(span, response, err)
+	}()
+
+	response, err = a.Client.StreamMessages(ctx, a.Messages, a.handler(ctx),
+		models.WithSystem(a.systemPrompt),
+		models.WithTools(a.Tools.ToolParams()),
+		models.WithHooks(a.Hooks),
+		models.WithCallCostTrackers(a.costTrackers...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return response, response.Wait()
+}
+
+type toolCallContextKey struct{}
+
+// ToolCall describes the call a tool is running for
+type ToolCall struct {
+	ToolUseID string
+	Name      string
+	Agent     *Agent
+}
+
+// ToolCallFromContext returns the call a tool is running for, nil outside of an agent's tool call
+func ToolCallFromContext(ctx context.Context) *ToolCall {
+	call, _ := ctx.Value(toolCallContextKey{}).(*ToolCall)
+	return call
+}
+
+// toolUse is a tool call asked for by the model
+type toolUse struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+func toolUses(message anthropic.Message) []toolUse {
+	uses := []toolUse{}
+	for _, block := range message.Content {
+		if block.Type == "tool_use" {
+			uses = append(uses, toolUse{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	return uses
+}
+
+// runTools calls the tools and returns the tool_result blocks in order, decisions apply to interrupted calls
+// Up to maxParallelTools calls run concurrently, sequential tools run alone
+func (a *Agent) runTools(ctx context.Context, uses []toolUse, metrics *Metrics, decisions map[string]Decision) []anthropic.ContentBlockParamUnion {
+	handler := a.handler(ctx)
+	ctx = withState(ctx, a.State)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make([]anthropic.ContentBlockParamUnion, len(uses))
+	// mu serializes the metrics and the handler
+	var mu sync.Mutex
+	run := func(i int) {
+		block := uses[i]
+		started := time.Now()
+		input, denial := block.Input, ""
+		if decision, ok := decisions[block.ID]; ok {
+			input, denial = decision.apply(block)
+		}
+		result, status, err := a.runTool(ctx, block.ID, block.Name, input, denial)
+		if err != nil && a.cancelToolsOnError {
+			cancel(fmt.Errorf("agents: tool %s failed: %w", block.Name, err))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		metrics.AddToolOutcome(block.Name, time.Since(started), status)
+		if handler != nil {
+			handler.HandleEvent(models.ToolResultEvent{ToolUseID: block.ID, Name: block.Name, Result: result})
+		}
+		results[i] = result.ToBlock(block.ID)
+	}
+
+	slots := make(chan struct{}, max(a.maxParallelTools, 1))
+	var wg sync.WaitGroup
+	for i, block := range uses {
+		if tool, err := a.Tools.Get(block.Name); a.maxParallelTools <= 1 || (err == nil && tools.IsSequential(tool)) {
+			wg.Wait()
+			run(i)
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			run(i)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runTool lets BeforeToolCall callbacks change or cancel the call and AfterToolCall callbacks change the result
+// A call denied by the caller is not invoked, denial is its result
+// The error is the one of the tool, it is reported to the model in the result
+func (a *Agent) runTool(ctx context.Context, toolUseID string, name string, input json.RawMessage, denial string) (tools.Result, tools.Status, error) {
+	started := time.Now()
+	tool, _ := a.Tools.Get(name)
+	before := &hooks.BeforeToolCall{AgentID: a.ID, ToolUseID: toolUseID, Name: name, Input: input, Tool: tool}
+	hooks.Invoke(ctx, a.Hooks, before)
+
+	ctx, span := a.tracer.StartToolCall(ctx, toolUseID, name, before.Input)
+	after := &hooks.AfterToolCall{AgentID: a.ID, ToolUseID: toolUseID, Name: name, Input: before.Input, Tool: before.Tool, Status: tools.StatusError}
+	switch {
+	case denial != "":
+		after.Result = tools.ErrorResult(denial)
+		after.Status = tools.StatusDenied
+	case before.Cancel != "":
+		after.Result = tools.ErrorResult(before.Cancel)
+		after.Status = tools.StatusCancelled
+	case before.Tool == nil:
+		after.Err = fmt.Errorf("%w: %s", tools.ErrToolNotFound, name)
+		after.Result = tools.ErrorResult(after.Err.Error())
+	case ctx.Err() != nil:
+		// a sibling failed or the invocation was cancelled before the call started
+		after.Err = context.Cause(ctx)
+		after.Result = tools.ErrorResult("tool call cancelled: " + after.Err.Error())
+		after.Status = tools.StatusCancelled
+	default:
+		ctx = context.WithValue(ctx, toolCallContextKey{}, &ToolCall{ToolUseID: toolUseID, Name: name, Agent: a})
+		after.Result, after.Status, after.Err = a.invokeTool(ctx, before.Tool, name, before.Input)
+	}
+	after.Duration = time.Since(started)
+	hooks.Invoke(ctx, a.Hooks, after)
+	a.logToolCall(ctx, before, after)
+	a.tracer.EndToolCall(span, after.Result, after.Err)
+	return after.Result, after.Status, after.Err
+}
+
+// invokeTool runs the tool in its own goroutine, so that a tool ignoring its context cannot hang the agent
+// after its timeout or after a cancellation, and converts a panic into a *PanicError
+// The result of a panic only tells the model that the tool failed, the panic is logged
+func (a *Agent) invokeTool(ctx context.Context, tool tools.Tool, name string, input json.RawMessage) (tools.Result, tools.Status, error) {
+	timeout := a.toolTimeout
+	if toolTimeout := tools.Timeout(tool); toolTimeout > 0 {
+		timeout = toolTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrToolTimeout, timeout))
+		defer cancel()
+	}
+
+	type outcome struct {
+		result tools.Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if value := recover(); value != nil {
+				done <- outcome{err: &PanicError{Tool: name, Value: value, Stack: debug.Stack()}}
+			}
+		}()
+		result, err := tool.Invoke(ctx, input)
+		done <- outcome{result: result, err: err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		// the goroutine is left behind when the tool does not return
+		result.err = context.Cause(ctx)
+	}
+	var panicErr *PanicError
+	switch {
+	case errors.As(result.err, &panicErr):
+		return tools.ErrorResult(fmt.Sprintf("tool %s failed with an internal error", name)), tools.StatusPanic, result.err
+	case result.err != nil && ctx.Err() != nil:
+		// the tool stopped because of its context
+		err := context.Cause(ctx)
+		status := tools.StatusCancelled
+		if errors.Is(err, ErrToolTimeout) {
+			status = tools.StatusTimeout
+		}
+		return tools.ErrorResult(err.Error()), status, err
+	case result.err != nil:
+		return tools.ErrorResult(result.err.Error()), tools.StatusError, result.err
+	case result.result.IsError:
+		return result.result, tools.StatusError, nil
+	}
+	return result.result, tools.StatusSuccess, nil
+}
+
+func (a *Agent) logToolCall(ctx context.Context, before *hooks.BeforeToolCall, after *hooks.AfterToolCall) {
+	attrs := []any{"agent_id", a.ID, "tool", after.Name, "tool_use_id", after.ToolUseID, "duration", after.Duration}
+	var panicErr *PanicError
+	switch {
+	case after.Status == tools.StatusDenied:
+		a.logger.InfoContext(ctx, "tool call denied", attrs...)
+	case before.Cancel != "":
+		a.logger.InfoContext(ctx, "tool call cancelled", append(attrs, "reason", before.Cancel)...)
+	case errors.As(after.Err, &panicErr):
+		a.logger.ErrorContext(ctx, "tool call panicked", append(attrs, "panic", fmt.Sprint(panicErr.Value), "stack", string(panicErr.Stack))...)
+	case after.Err != nil:
+		a.logger.WarnContext(ctx, "tool call failed", append(attrs, "status", after.Status, "error", after.Err)...)
+	default:
+		a.logger.DebugContext(ctx, "tool call", append(attrs, "is_error", after.Result.IsError)...)
+	}
+}
+
+func (a *Agent) appendMessage(ctx context.Context, message anthropic.MessageParam) error {
+	a.Messages = append(a.Messages, message)
+	hooks.Invoke(ctx, a.Hooks, &hooks.MessageAdded{AgentID: a.ID, Message: message})
+	switch {
+	case a.tree != nil:
+		return a.tree.Append(ctx, message)
+	case a.session != nil:
+		return a.session.AppendMessages(ctx, a.ID, message)
+	}
+	return nil
+}
+
+func (a *Agent) saveState(ctx context.Context) error {
+	if a.session == nil {
+		return nil
+	}
+	state, err := json.Marshal(a.State)
+	if err != nil {
+		return err
+	}
+	return a.session.SaveState(ctx, a.ID, state)
+}
@@ -0,0 +1,551 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/conversation"
+	"github.com/yuki5155/go-strands-agents/cost"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/session"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+func counterTool() tools.Tool {
+	return tools.NewFunc(tools.Spec{Name: "count", Description: "increments a counter"},
+		func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+			state := StateFromContext(ctx)
+			if state == nil {
+				return tools.Result{}, errors.New("no state")
+			}
+			count, _, err := GetState[int](state, "count")
+			if err != nil {
+				return tools.Result{}, err
+			}
+			if err := SetState(state, "count", count+1); err != nil {
+				return tools.Result{}, err
+			}
+			return tools.TextResult("counted"), nil
+		})
+}
+
+func TestAgent_Invoke(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "count", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(counterTool()), WithSystemPrompt("be brief"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Invoke(context.Background(), "count once")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text() != "done" || result.StopReason != "end_turn" {
+		t.Errorf("unexpected result %q %q", result.Text(), result.StopReason)
+	}
+	// user, assistant tool_use, user tool_result, assistant text
+	if len(agent.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(agent.Messages))
+	}
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if len(requests[1].Tools) != 1 || requests[1].Tools[0].Name != "count" {
+		t.Errorf("unexpected tools %+v", requests[1].Tools)
+	}
+	if !strings.Contains(string(requests[1].Messages[2]), `"tool_use_id":"tu_1"`) {
+		t.Errorf("expected tool result, got %s", requests[1].Messages[2])
+	}
+	count, ok, err := GetState[int](agent.State, "count")
+	if err != nil || !ok || count != 1 {
+		t.Errorf("expected count 1, got %d %v %v", count, ok, err)
+	}
+}
+
+func TestAgent_UnknownTool(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "missing", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "sorry"},
+	)
+	agent, err := NewAgent(context.Background(), server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	message := string(server.Requests()[1].Messages[2])
+	if !strings.Contains(message, `"is_error":true`) {
+		t.Errorf("expected an error result, got %s", message)
+	}
+}
+
+func TestAgent_MaxCycles(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "count", Input: map[string]any{}}}},
+	)
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(counterTool()), WithMaxCycles(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "hi"); !errors.Is(err, ErrMaxCycles) {
+		t.Errorf("expected ErrMaxCycles, got %v", err)
+	}
+}
+
+func TestAgent_StatePersisted(t *testing.T) {
+	ctx := context.Background()
+	repo, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "count", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+
+	state := NewAgentState()
+	if err := state.Set("secret", "do-not-send"); err != nil {
+		t.Fatal(err)
+	}
+	agent, err := NewAgent(ctx, server.Client(),
+		WithSessionManager(session.NewManager(repo, "s1", "alice")),
+		WithTools(counterTool()),
+		WithState(state),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(ctx, "count"); err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range server.Requests() {
+		if strings.Contains(string(request.Raw), "do-not-send") {
+			t.Errorf("state leaked into the request: %s", request.Raw)
+		}
+	}
+
+	restored, err := NewAgent(ctx, server.Client(), WithSessionManager(session.NewManager(repo, "s1", "alice")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Messages) != 4 {
+		t.Errorf("expected 4 restored messages, got %d", len(restored.Messages))
+	}
+	count, _, err := GetState[int](restored.State, "count")
+	if err != nil || count != 1 {
+		t.Errorf("expected count 1, got %d %v", count, err)
+	}
+	secret, _, err := GetState[string](restored.State, "secret")
+	if err != nil || secret != "do-not-send" {
+		t.Errorf("expected secret, got %q %v", secret, err)
+	}
+}
+
+func TestAgent_Tree(t *testing.T) {
+	ctx := context.Background()
+	repo, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := session.NewManager(repo, "s1", "alice")
+	tree, err := conversation.LoadTree(ctx, manager, DefaultAgentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "a1"}, fakeapi.Turn{Text: "a2"}, fakeapi.Turn{Text: "a2 regenerated"})
+	agent, err := NewAgent(ctx, server.Client(), WithSessionManager(manager), WithTree(tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prompt := range []string{"q1", "q2"} {
+		if _, err := agent.Invoke(ctx, prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// edit the second question and regenerate the answer
+	if _, err := tree.Rewind(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Invoke(ctx, "q2 edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := result.Message.Content[0].OfText.Text; text != "a2 regenerated" {
+		t.Errorf("unexpected answer %q", text)
+	}
+	if sent := server.Requests()[2].Messages; len(sent) != 3 || strings.Contains(string(sent[2]), `"q2"`) {
+		t.Errorf("expected the edited branch to be sent, got %s", sent)
+	}
+	main, _ := tree.BranchMessages(conversation.MainBranch)
+	if len(main) != 4 || len(tree.Messages()) != 4 || len(agent.Messages) != 4 {
+		t.Errorf("expected both branches to hold 4 messages, got %d and %d", len(main), len(tree.Messages()))
+	}
+
+	// an agent without the tree would read the messages of every branch as one history
+	if _, err := NewAgent(ctx, server.Client(), WithSessionManager(session.NewManager(repo, "s1", "alice"))); !errors.Is(err, ErrTreeHistory) {
+		t.Errorf("expected ErrTreeHistory, got %v", err)
+	}
+	loaded, err := conversation.LoadTree(ctx, session.NewManager(repo, "s1", "alice"), DefaultAgentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Branches()) != 2 || len(loaded.Messages()) != 4 {
+		t.Errorf("unexpected stored tree %+v", loaded.Branches())
+	}
+}
+
+func TestAgent_CostBudget(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "expensive", InputTokens: 1_000_000})
+	tracker := cost.NewTracker("session", cost.WithBudget(1))
+	agent, err := NewAgent(context.Background(), server.Client(), WithCostTrackers(tracker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "again"); !errors.Is(err, cost.ErrBudgetExceeded) {
+		t.Errorf("expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestAgent_StreamHandler(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "count", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	buffer := models.NewBufferHandler()
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(counterTool()), WithStreamHandler(buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "count"); err != nil {
+		t.Fatal(err)
+	}
+	var toolResult *models.ToolResultEvent
+	for _, event := range buffer.Events() {
+		if event, ok := event.(models.ToolResultEvent); ok {
+			toolResult = &event
+		}
+	}
+	if toolResult == nil || toolResult.ToolUseID != "tu_1" || toolResult.Result.Text() != "counted" {
+		t.Errorf("unexpected tool result event %+v", toolResult)
+	}
+	if buffer.Text() != "done" {
+		t.Errorf("unexpected text %q", buffer.Text())
+	}
+}
+
+func TestContextWithStreamHandler(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "first"}, fakeapi.Turn{Text: "second"})
+	agentBuffer := models.NewBufferHandler()
+	agent, err := NewAgent(context.Background(), server.Client(), WithStreamHandler(agentBuffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callBuffer := models.NewBufferHandler()
+	if _, err := agent.Invoke(ContextWithStreamHandler(context.Background(), callBuffer), "one"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "two"); err != nil {
+		t.Fatal(err)
+	}
+	if agentBuffer.Text() != "firstsecond" || callBuffer.Text() != "first" {
+		t.Errorf("unexpected text %q and %q", agentBuffer.Text(), callBuffer.Text())
+	}
+}
+
+func TestAgent_Logger(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "count", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	// the agent uses the client's logger by default
+	agent, err := NewAgent(context.Background(), server.Client(models.WithLogger(logger)), WithTools(counterTool()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "count"); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	if !strings.Contains(output, `"msg":"agent invocation finished","agent_id":"default","stop_reason":"end_turn","cycles":2,"input_tokens":20,"output_tokens":10`) {
+		t.Errorf("unexpected logs %s", output)
+	}
+	if strings.Contains(output, `"level":"DEBUG"`) {
+		t.Errorf("expected no debug logs %s", output)
+	}
+
+	buffer.Reset()
+	debug := slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	server.AddTurns(fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_2", Name: "missing", Input: map[string]any{}}}}, fakeapi.Turn{Text: "sorry"})
+	agent, err = NewAgent(context.Background(), server.Client(), WithLogger(debug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), `"msg":"tool call failed","agent_id":"default","tool":"missing","tool_use_id":"tu_2"`) {
+		t.Errorf("unexpected logs %s", buffer.String())
+	}
+}
+
+func TestAgent_ParallelTools(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	soloAlone := atomic.Bool{}
+	wait := tools.NewFunc(tools.Spec{Name: "wait"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if now <= previous || maxRunning.CompareAndSwap(previous, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return tools.TextResult(string(input)), nil
+	})
+	solo := tools.Sequential(tools.NewFunc(tools.Spec{Name: "solo"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		soloAlone.Store(running.Load() == 0)
+		return tools.TextResult("solo"), nil
+	}))
+	uses := []fakeapi.ToolUse{}
+	for i, name := range []string{"wait", "wait", "wait", "solo", "wait", "wait"} {
+		uses = append(uses, fakeapi.ToolUse{ID: fmt.Sprintf("tu_%d", i), Name: name, Input: map[string]any{"n": i}})
+	}
+	server := fakeapi.NewServer(t, fakeapi.Turn{ToolUses: uses}, fakeapi.Turn{Text: "done"})
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(wait, solo), WithMaxParallelTools(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Invoke(context.Background(), "wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning.Load() != 2 || !soloAlone.Load() {
+		t.Errorf("expected 2 concurrent calls and solo alone, got %d %v", maxRunning.Load(), soloAlone.Load())
+	}
+	var message struct {
+		Content []struct {
+			ToolUseID string `json:"tool_use_id"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(server.Requests()[1].Messages[2], &message); err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range message.Content {
+		if block.ToolUseID != fmt.Sprintf("tu_%d", i) {
+			t.Errorf("result %d is for %s", i, block.ToolUseID)
+		}
+	}
+	if len(message.Content) != 6 || result.Metrics.Tools["wait"].Calls != 5 {
+		t.Errorf("unexpected results %+v and metrics %+v", message.Content, result.Metrics.Tools)
+	}
+}
+
+func TestAgent_CancelToolsOnError(t *testing.T) {
+	fail := tools.NewFunc(tools.Spec{Name: "fail"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		return tools.Result{}, errors.New("broken")
+	})
+	slow := tools.NewFunc(tools.Spec{Name: "slow"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		select {
+		case <-ctx.Done():
+			return tools.Result{}, context.Cause(ctx)
+		case <-time.After(50 * time.Millisecond):
+			return tools.TextResult("finished"), nil
+		}
+	})
+	turns := []fakeapi.Turn{
+		{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "slow", Input: map[string]any{}}, {ID: "tu_2", Name: "fail", Input: map[string]any{}}}},
+		{Text: "done"},
+	}
+
+	for _, cancel := range []bool{false, true} {
+		server := fakeapi.NewServer(t, turns...)
+		agent, err := NewAgent(context.Background(), server.Client(), WithTools(fail, slow), WithMaxParallelTools(2), WithCancelToolsOnError(cancel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := agent.Invoke(context.Background(), "run"); err != nil {
+			t.Fatal(err)
+		}
+		results := string(server.Requests()[1].Messages[2])
+		if cancel != strings.Contains(results, "agents: tool fail failed: broken") || cancel == strings.Contains(results, "finished") {
+			t.Errorf("unexpected results with cancel %v: %s", cancel, results)
+		}
+	}
+}
+
+func TestAgent_ToolTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	// hung ignores its context
+	hung := tools.NewFunc(tools.Spec{Name: "hung"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		<-release
+		return tools.TextResult("too late"), nil
+	})
+	slow := tools.WithTimeout(tools.NewFunc(tools.Spec{Name: "slow"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		select {
+		case <-ctx.Done():
+			return tools.Result{}, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			return tools.TextResult("slow but fine"), nil
+		}
+	}), time.Second)
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "hung", Input: map[string]any{}}, {ID: "tu_2", Name: "slow", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(hung, slow), WithToolTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []tools.Status
+	hooks.Add(agent.Hooks, func(ctx context.Context, event *hooks.AfterToolCall) {
+		statuses = append(statuses, event.Status)
+	})
+	result, err := agent.Invoke(context.Background(), "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := string(server.Requests()[1].Messages[2])
+	if !strings.Contains(results, "agents: tool call timed out after 10ms") || !strings.Contains(results, "slow but fine") {
+		t.Errorf("unexpected results %s", results)
+	}
+	if fmt.Sprint(statuses) != "[timeout success]" || result.Metrics.Tools["hung"].Timeouts != 1 || result.Metrics.Tools["hung"].Errors != 1 {
+		t.Errorf("unexpected statuses %v and metrics %+v", statuses, result.Metrics.Tools["hung"])
+	}
+}
+
+func TestAgent_ToolPanic(t *testing.T) {
+	var call *ToolCall
+	boom := tools.NewFunc(tools.Spec{Name: "boom"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		call = ToolCallFromContext(ctx)
+		panic("secret connection string")
+	})
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "boom", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "sorry"},
+	)
+	var buffer bytes.Buffer
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(boom), WithLogger(slog.New(slog.NewTextHandler(&buffer, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Invoke(context.Background(), "boom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := string(server.Requests()[1].Messages[2])
+	if !strings.Contains(results, "tool boom failed with an internal error") || strings.Contains(results, "secret") {
+		t.Errorf("unexpected results %s", results)
+	}
+	if result.Metrics.Tools["boom"].Panics != 1 {
+		t.Errorf("unexpected metrics %+v", result.Metrics.Tools["boom"])
+	}
+	if logs := buffer.String(); !strings.Contains(logs, "tool call panicked") || !strings.Contains(logs, "secret connection string") || !strings.Contains(logs, "agent_test.go") {
+		t.Errorf("expected the panic and its stack in the logs:\n%s", logs)
+	}
+	if call == nil || call.ToolUseID != "tu_1" || call.Name != "boom" || call.Agent != agent {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+}
+
+func TestAgent_Interrupts(t *testing.T) {
+	ctx := context.Background()
+	repo, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{
+			{ID: "tu_1", Name: "delete", Input: map[string]any{"path": "a"}},
+			{ID: "tu_2", Name: "delete", Input: map[string]any{"path": "b"}},
+			{ID: "tu_3", Name: "delete", Input: map[string]any{"path": "c"}},
+			{ID: "tu_4", Name: "count", Input: map[string]any{}},
+		}},
+		fakeapi.Turn{Text: "done"},
+	)
+	deleted := []string{}
+	deleteTool := tools.RequireApproval(tools.NewFunc(tools.Spec{Name: "delete"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		var params struct{ Path string }
+		json.Unmarshal(input, &params)
+		deleted = append(deleted, params.Path)
+		return tools.TextResult("deleted"), nil
+	}), "deletes files")
+	newAgent := func() *Agent {
+		agent, err := NewAgent(ctx, server.Client(), WithSessionManager(session.NewManager(repo, "s1", "alice")), WithTools(deleteTool, counterTool()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent
+	}
+
+	agent := newAgent()
+	result, err := agent.Invoke(ctx, "clean up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StopReason != StopReasonInterrupt || len(result.Interrupts) != 3 || len(deleted) != 0 {
+		t.Fatalf("expected 3 interrupts before any call, got %+v %v", result, deleted)
+	}
+	if interrupt := result.Interrupts[1]; interrupt.ToolUseID != "tu_2" || interrupt.Name != "delete" || string(interrupt.Input) != `{"path":"b"}` || interrupt.Reason != "deletes files" {
+		t.Errorf("unexpected interrupt %+v", interrupt)
+	}
+	if _, err := agent.Invoke(ctx, "again"); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("expected ErrInterrupted, got %v", err)
+	}
+
+	// the interrupts survive a restart
+	restored := newAgent()
+	if len(restored.Interrupts()) != 3 {
+		t.Fatalf("expected restored interrupts, got %+v", restored.Interrupts())
+	}
+	if _, err := restored.Resume(ctx, Approve("tu_1")); !errors.Is(err, ErrInvalidDecision) {
+		t.Errorf("expected ErrInvalidDecision for missing decisions, got %v", err)
+	}
+	result, err = restored.Resume(ctx, Approve("tu_1"), Deny("tu_2", "keep b"), Edit("tu_3", json.RawMessage(`{"path":"d"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text() != "done" || strings.Join(deleted, ",") != "a,d" || len(restored.Interrupts()) != 0 {
+		t.Errorf("unexpected resume %q %v %+v", result.Text(), deleted, restored.Interrupts())
+	}
+	if count, _, _ := GetState[int](restored.State, "count"); count != 1 {
+		t.Errorf("expected the call without approval to run, got count %d", count)
+	}
+
+	requests := server.Requests()
+	var message struct {
+		Content []struct {
+			ToolUseID string `json:"tool_use_id"`
+			IsError   bool   `json:"is_error"`
+			Content   []struct{ Text string }
+		}
+	}
+	json.Unmarshal(requests[1].Messages[len(requests[1].Messages)-1], &message)
+	if len(message.Content) != 4 || !message.Content[1].IsError || message.Content[1].Content[0].Text != `{"reason":"keep b","status":"denied","tool":"delete"}` {
+		t.Errorf("unexpected tool results %+v", message)
+	}
+	if _, err := restored.Resume(ctx); !errors.Is(err, ErrNoInterrupts) {
+		t.Errorf("expected ErrNoInterrupts, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+func echoTool(name string) tools.Tool {
+	return tools.NewFunc(tools.Spec{Name: name}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		return tools.TextResult(name + ":" + string(input)), nil
+	})
+}
+
+// eventLog is safe for the tool hooks of parallel tool calls
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) RegisterHooks(registry *hooks.Registry) {
+	hooks.Add(registry, func(ctx context.Context, event *hooks.BeforeInvocation) {
+		l.add("BeforeInvocation")
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.MessageAdded) {
+		l.add("MessageAdded:" + string(event.Message.Role))
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.BeforeModelCall) {
+		l.add("BeforeModelCall")
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.AfterModelCall) {
+		l.add("AfterModelCall:" + event.StopReason)
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.BeforeToolCall) {
+		l.add("BeforeToolCall:" + event.Name)
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.AfterToolCall) {
+		l.add("AfterToolCall:" + event.Result.Text())
+	})
+	hooks.Add(registry, func(ctx context.Context, event *hooks.AfterInvocation) {
+		l.add("AfterInvocation:" + event.StopReason)
+	})
+}
+
+func TestAgent_HookEvents(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "echo", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	log := &eventLog{}
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(echoTool("echo")), WithHooks(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"BeforeInvocation",
+		"MessageAdded:user",
+		"BeforeModelCall",
+		"AfterModelCall:tool_use",
+		"MessageAdded:assistant",
+		"BeforeToolCall:echo",
+		"AfterToolCall:echo:{}",
+		"MessageAdded:user",
+		"BeforeModelCall",
+		"AfterModelCall:end_turn",
+		"MessageAdded:assistant",
+		"AfterInvocation:end_turn",
+	}
+	if !reflect.DeepEqual(log.events, expected) {
+		t.Errorf("expected %v, got %v", expected, log.events)
+	}
+}
+
+func TestAgent_HookEventsParallelTools(t *testing.T) {
+	uses := []fakeapi.ToolUse{}
+	for _, name := range []string{"a", "b", "c"} {
+		uses = append(uses, fakeapi.ToolUse{ID: "tu_" + name, Name: name, Input: map[string]any{}})
+	}
+	server := fakeapi.NewServer(t, fakeapi.Turn{ToolUses: uses}, fakeapi.Turn{Text: "done"})
+	log := &eventLog{}
+	agent, err := NewAgent(context.Background(), server.Client(),
+		WithTools(echoTool("a"), echoTool("b"), echoTool("c")), WithHooks(log), WithMaxParallelTools(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the callbacks change their events, which belong to one call each
+	hooks.Add(agent.Hooks, func(ctx context.Context, event *hooks.BeforeToolCall) {
+		event.Input = json.RawMessage(`{"call":"` + event.ToolUseID + `"}`)
+	})
+	hooks.Add(agent.Hooks, func(ctx context.Context, event *hooks.AfterToolCall) {
+		event.Result = tools.TextResult(strings.ToUpper(event.Result.Text()))
+	})
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	for _, event := range log.events {
+		if strings.Contains(event, "ToolCall:") {
+			calls = append(calls, event)
+		}
+	}
+	slices.Sort(calls)
+	expected := []string{
+		`AfterToolCall:A:{"CALL":"TU_A"}`,
+		`AfterToolCall:B:{"CALL":"TU_B"}`,
+		`AfterToolCall:C:{"CALL":"TU_C"}`,
+		"BeforeToolCall:a",
+		"BeforeToolCall:b",
+		"BeforeToolCall:c",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestAgent_HookToolInterception(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{
+			{ID: "tu_1", Name: "echo", Input: map[string]any{"v": 1}},
+			{ID: "tu_2", Name: "missing", Input: map[string]any{}},
+			{ID: "tu_3", Name: "danger", Input: map[string]any{}},
+		}},
+		fakeapi.Turn{Text: "done"},
+	)
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(echoTool("echo"), echoTool("danger")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.Add(agent.Hooks, func(ctx context.Context, event *hooks.BeforeToolCall) {
+		switch event.Name {
+		case "echo":
+			event.Input = json.RawMessage(`{"v":2}`)
+		case "missing":
+			event.Tool = echoTool("substitute")
+		case "danger":
+			event.Cancel = "not allowed"
+		}
+	})
+	hooks.Add(agent.Hooks, func(ctx context.Context, event *hooks.AfterToolCall) {
+		if event.Name == "echo" {
+			event.Result = tools.TextResult(event.Result.Text() + " (checked)")
+		}
+	})
+	if _, err := agent.Invoke(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	results := string(server.Requests()[1].Messages[2])
+	for _, want := range []string{`echo:{\"v\":2} (checked)`, `substitute:{}`, `not allowed`} {
+		if !strings.Contains(results, want) {
+			t.Errorf("expected %s in %s", want, results)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// StopReasonInterrupt ends an invocation that waits for decisions about tool calls, see Resume
+const StopReasonInterrupt = "interrupt"
+
+// InterruptsStateKey is the state key holding the pending interrupts, it is persisted with the session
+const InterruptsStateKey = "agents.interrupts"
+
+var (
+	// ErrInterrupted is returned when the agent is invoked while tool calls wait for decisions
+	ErrInterrupted = errors.New("agents: tool calls wait for decisions, call Resume")
+	// ErrNoInterrupts is returned by Resume when no tool call waits for a decision
+	ErrNoInterrupts = errors.New("agents: no interrupted tool calls")
+	// ErrInvalidDecision is returned by Resume for a missing decision or one about an unknown tool call
+	ErrInvalidDecision = errors.New("agents: invalid decision")
+)
+
+// Interrupt is a tool call that waits for the caller to approve, deny or edit it
+type Interrupt struct {
+	ToolUseID string          `json:"tool_use_id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	// Reason is the one given to tools.RequireApproval
+	Reason string `json:"reason"`
+}
+
+type DecisionAction string
+
+const (
+	ActionApprove DecisionAction = "approve"
+	ActionDeny    DecisionAction = "deny"
+	ActionEdit    DecisionAction = "edit"
+)
+
+// Decision settles an interrupted tool call
+type Decision struct {
+	ToolUseID string         `json:"tool_use_id"`
+	Action    DecisionAction `json:"action"`
+	// Input replaces the input of the call for ActionEdit
+	Input json.RawMessage `json:"input,omitempty"`
+	// Reason is told to the model for ActionDeny
+	Reason string `json:"reason,omitempty"`
+}
+
+// Approve runs the call as the model asked
+func Approve(toolUseID string) Decision {
+	return Decision{ToolUseID: toolUseID, Action: ActionApprove}
+}
+
+// Deny does not run the call, the model gets an error result with the reason
+func Deny(toolUseID, reason string) Decision {
+	return Decision{ToolUseID: toolUseID, Action: ActionDeny, Reason: reason}
+}
+
+// Edit runs the call with another input
+func Edit(toolUseID string, input json.RawMessage) Decision {
+	return Decision{ToolUseID: toolUseID, Action: ActionEdit, Input: input}
+}
+
+// apply returns the input of the call, or the result explaining a denial to the model
+func (d Decision) apply(use toolUse) (json.RawMessage, string) {
+	switch d.Action {
+	case ActionEdit:
+		return d.Input, ""
+	case ActionDeny:
+		reason := d.Reason
+		if reason == "" {
+			reason = "the user denied the tool call"
+		}
+		denial, _ := json.Marshal(map[string]string{"status": "denied", "tool": use.Name, "reason": reason})
+		return nil, string(denial)
+	}
+	return use.Input, ""
+}
+
+// Interrupts returns the tool calls waiting for decisions, they survive restarts when the agent has a session
+func (a *Agent) Interrupts() []Interrupt {
+	interrupts, _, _ := GetState[[]Interrupt](a.State, InterruptsStateKey)
+	return interrupts
+}
+
+// Resume runs the interrupted tool calls with a decision for each of them and continues the event loop
+// The calls of the interrupted turn that need no approval run too
+func (a *Agent) Resume(ctx context.Context, decisions ...Decision) (*AgentResult, error) {
+	return a.invoke(ctx, nil, decisions)
+}
+
+// interrupts returns the calls to tools marked with tools.RequireApproval
+func (a *Agent) interrupts(uses []toolUse) []Interrupt {
+	interrupts := []Interrupt{}
+	for _, use := range uses {
+		tool, err := a.Tools.Get(use.Name)
+		if err != nil {
+			continue
+		}
+		if reason := tools.ApprovalReason(tool); reason != "" {
+			interrupts = append(interrupts, Interrupt{ToolUseID: use.ID, Name: use.Name, Input: use.Input, Reason: reason})
+		}
+	}
+	return interrupts
+}
+
+// resumeTools runs the tool calls of the interrupted turn and adds their results
+func (a *Agent) resumeTools(ctx context.Context, decisions []Decision, metrics *Metrics) error {
+	interrupts := a.Interrupts()
+	if len(interrupts) == 0 {
+		return ErrNoInterrupts
+	}
+	byID := map[string]Decision{}
+	for _, decision := range decisions {
+		switch decision.Action {
+		case ActionApprove, ActionDeny, ActionEdit:
+		default:
+			return fmt.Errorf("%w: unknown action %q for %s", ErrInvalidDecision, decision.Action, decision.ToolUseID)
+		}
+		byID[decision.ToolUseID] = decision
+	}
+	pending := map[string]bool{}
+	for _, interrupt := range interrupts {
+		if _, ok := byID[interrupt.ToolUseID]; !ok {
+			return fmt.Errorf("%w: no decision for %s", ErrInvalidDecision, interrupt.ToolUseID)
+		}
+		pending[interrupt.ToolUseID] = true
+	}
+	for id := range byID {
+		if !pending[id] {
+			return fmt.Errorf("%w: %s is not interrupted", ErrInvalidDecision, id)
+		}
+	}
+
+	uses, err := a.pendingToolUses()
+	if err != nil {
+		return err
+	}
+	results := a.runTools(ctx, uses, metrics, byID)
+	a.State.Delete(InterruptsStateKey)
+	return a.appendMessage(ctx, anthropic.NewUserMessage(results...))
+}
+
+// pendingToolUses returns the tool calls of the last message, the interrupted assistant turn
+func (a *Agent) pendingToolUses() ([]toolUse, error) {
+	if len(a.Messages) == 0 || a.Messages[len(a.Messages)-1].Role != anthropic.MessageParamRoleAssistant {
+		return nil, errors.New("agents: the history does not end with the interrupted turn")
+	}
+	uses := []toolUse{}
+	for _, block := range a.Messages[len(a.Messages)-1].Content {
+		if block.OfToolUse == nil {
+			continue
+		}
+		input, err := json.Marshal(block.OfToolUse.Input)
+		if err != nil {
+			return nil, fmt.Errorf("agents: input of %s: %w", block.OfToolUse.ID, err)
+		}
+		uses = append(uses, toolUse{ID: block.OfToolUse.ID, Name: block.OfToolUse.Name, Input: input})
+	}
+	return uses, nil
+}
@@ -0,0 +1,180 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// Usage counts the tokens of one or more model calls
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+func UsageFromResponse(response *models.StreamingResponse) Usage {
+	return Usage{
+		InputTokens:              response.InputTokens,
+		OutputTokens:             response.OutputTokens,
+		CacheCreationInputTokens: response.CacheCreationInputTokens,
+		CacheReadInputTokens:     response.CacheReadInputTokens,
+	}
+}
+
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// TotalTokens is the sum of every token count
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// CycleMetrics describes one event loop cycle
+type CycleMetrics struct {
+	Cycle      int    `json:"cycle"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+	// Duration covers the model call and the tool calls of the cycle
+	Duration     time.Duration `json:"duration_ns"`
+	ModelLatency time.Duration `json:"model_latency_ns"`
+	// TimeToFirstToken is zero when the model returned neither text nor tool input
+	TimeToFirstToken time.Duration `json:"time_to_first_token_ns"`
+}
+
+// ToolMetrics aggregates the calls of one tool
+// Errors counts every failed call, including the timeouts, panics and cancellations
+type ToolMetrics struct {
+	Name      string        `json:"name"`
+	Calls     int           `json:"calls"`
+	Success   int           `json:"success"`
+	Errors    int           `json:"errors"`
+	Timeouts  int           `json:"timeouts"`
+	Panics    int           `json:"panics"`
+	Cancelled int           `json:"cancelled"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// AverageDuration is the mean duration of a call
+func (m *ToolMetrics) AverageDuration() time.Duration {
+	if m.Calls == 0 {
+		return 0
+	}
+	return m.Duration / time.Duration(m.Calls)
+}
+
+// Metrics describes one agent invocation
+type Metrics struct {
+	Duration time.Duration  `json:"duration_ns"`
+	Cycles   []CycleMetrics `json:"cycles"`
+	// Usage is the sum over every model call
+	Usage Usage `json:"usage"`
+	// ModelUsage is Usage by model id
+	ModelUsage map[string]Usage        `json:"model_usage"`
+	Tools      map[string]*ToolMetrics `json:"tools"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Cycles:     []CycleMetrics{},
+		ModelUsage: map[string]Usage{},
+		Tools:      map[string]*ToolMetrics{},
+	}
+}
+
+// CycleCount is the number of event loop cycles
+func (m *Metrics) CycleCount() int {
+	return len(m.Cycles)
+}
+
+// AddCycle records a cycle and adds its usage to the totals
+func (m *Metrics) AddCycle(cycle CycleMetrics) {
+	m.Cycles = append(m.Cycles, cycle)
+	m.Usage.Add(cycle.Usage)
+	usage := m.ModelUsage[cycle.Model]
+	usage.Add(cycle.Usage)
+	m.ModelUsage[cycle.Model] = usage
+}
+
+// AddToolCall records one call of the named tool
+func (m *Metrics) AddToolCall(name string, duration time.Duration, success bool) {
+	status := tools.StatusSuccess
+	if !success {
+		status = tools.StatusError
+	}
+	m.AddToolOutcome(name, duration, status)
+}
+
+// AddToolOutcome records one call of the named tool and how it ended
+func (m *Metrics) AddToolOutcome(name string, duration time.Duration, status tools.Status) {
+	tool, ok := m.Tools[name]
+	if !ok {
+		tool = &ToolMetrics{Name: name}
+		m.Tools[name] = tool
+	}
+	tool.Calls++
+	tool.Duration += duration
+	switch status {
+	case tools.StatusSuccess:
+		tool.Success++
+		return
+	case tools.StatusTimeout:
+		tool.Timeouts++
+	case tools.StatusPanic:
+		tool.Panics++
+	case tools.StatusCancelled:
+		tool.Cancelled++
+	}
+	tool.Errors++
+}
+
+// JSON exports the metrics as indented JSON, durations are in nanoseconds
+func (m *Metrics) JSON() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Summary is a human readable report of the metrics
+func (m *Metrics) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cycles: %d, duration: %s\n", m.CycleCount(), m.Duration)
+	fmt.Fprintf(&b, "Tokens: %d input, %d output, %d cache write, %d cache read, %d total\n",
+		m.Usage.InputTokens, m.Usage.OutputTokens, m.Usage.CacheCreationInputTokens, m.Usage.CacheReadInputTokens, m.Usage.TotalTokens())
+	for _, model := range sortedKeys(m.ModelUsage) {
+		usage := m.ModelUsage[model]
+		fmt.Fprintf(&b, "Model %s: %d input, %d output tokens\n", model, usage.InputTokens, usage.OutputTokens)
+	}
+	for _, cycle := range m.Cycles {
+		fmt.Fprintf(&b, "Cycle %d: %s (model %s, first token %s), %s\n",
+			cycle.Cycle, cycle.Duration, cycle.ModelLatency, cycle.TimeToFirstToken, cycle.StopReason)
+	}
+	for _, name := range sortedKeys(m.Tools) {
+		tool := m.Tools[name]
+		fmt.Fprintf(&b, "Tool %s: %d calls, %d success, %d errors, %s average",
+			name, tool.Calls, tool.Success, tool.Errors, tool.AverageDuration())
+		if tool.Timeouts+tool.Panics+tool.Cancelled > 0 {
+			fmt.Fprintf(&b, " (%d timeouts, %d panics, %d cancelled)", tool.Timeouts, tool.Panics, tool.Cancelled)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,86 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.AddCycle(CycleMetrics{Cycle: 1, Model: "a", Usage: Usage{InputTokens: 10, OutputTokens: 2, CacheReadInputTokens: 5}})
+	metrics.AddCycle(CycleMetrics{Cycle: 2, Model: "a", Usage: Usage{InputTokens: 20, OutputTokens: 3, CacheCreationInputTokens: 7}})
+	metrics.AddCycle(CycleMetrics{Cycle: 3, Model: "b", Usage: Usage{InputTokens: 1, OutputTokens: 1}})
+	metrics.AddToolCall("lookup", 2*time.Millisecond, true)
+	metrics.AddToolCall("lookup", 4*time.Millisecond, false)
+
+	expected := Usage{InputTokens: 31, OutputTokens: 6, CacheCreationInputTokens: 7, CacheReadInputTokens: 5}
+	if metrics.Usage != expected {
+		t.Errorf("expected %+v, got %+v", expected, metrics.Usage)
+	}
+	if metrics.ModelUsage["a"].InputTokens != 30 || metrics.ModelUsage["b"].InputTokens != 1 {
+		t.Errorf("unexpected model usage %+v", metrics.ModelUsage)
+	}
+	lookup := metrics.Tools["lookup"]
+	if lookup.Calls != 2 || lookup.Success != 1 || lookup.Errors != 1 || lookup.AverageDuration() != 3*time.Millisecond {
+		t.Errorf("unexpected tool metrics %+v", lookup)
+	}
+
+	summary := metrics.Summary()
+	for _, want := range []string{"Cycles: 3", "31 input", "49 total", "Tool lookup: 2 calls, 1 success, 1 errors"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected %q in summary:\n%s", want, summary)
+		}
+	}
+
+	data, err := metrics.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Metrics
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Usage != expected || decoded.Tools["lookup"].Errors != 1 || len(decoded.Cycles) != 3 {
+		t.Errorf("unexpected round trip %+v", decoded)
+	}
+}
+
+func TestAgent_Metrics(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Text: "checking", ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "echo", Input: map[string]any{}}}, InputTokens: 20, OutputTokens: 7},
+		fakeapi.Turn{Text: "done", InputTokens: 30, OutputTokens: 4},
+	)
+	agent, err := NewAgent(context.Background(), server.Client(), WithTools(echoTool("echo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Invoke(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := result.Metrics
+	if metrics.CycleCount() != 2 {
+		t.Fatalf("expected 2 cycles, got %d", metrics.CycleCount())
+	}
+	if metrics.Usage.InputTokens != 50 || metrics.Usage.OutputTokens != 11 {
+		t.Errorf("expected usage summed over cycles, got %+v", metrics.Usage)
+	}
+	if metrics.ModelUsage[agent.Client.Config.ModelId].InputTokens != 50 {
+		t.Errorf("unexpected model usage %+v", metrics.ModelUsage)
+	}
+	first := metrics.Cycles[0]
+	if first.StopReason != "tool_use" || first.TimeToFirstToken <= 0 || first.ModelLatency < first.TimeToFirstToken || first.Duration < first.ModelLatency {
+		t.Errorf("unexpected cycle metrics %+v", first)
+	}
+	if metrics.Tools["echo"].Calls != 1 || metrics.Tools["echo"].Success != 1 {
+		t.Errorf("unexpected tool metrics %+v", metrics.Tools["echo"])
+	}
+	if metrics.Duration < first.Duration+metrics.Cycles[1].Duration {
+		t.Errorf("invocation shorter than its cycles: %+v", metrics)
+	}
+}
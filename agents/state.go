@@ -0,0 +1,103 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// AgentState is a JSON key-value store attached to an agent
+// It is persisted by the session manager and never sent to the model
+type AgentState struct {
+	mu     sync.RWMutex
+	values map[string]json.RawMessage
+}
+
+func NewAgentState() *AgentState {
+	return &AgentState{values: map[string]json.RawMessage{}}
+}
+
+// Set stores the JSON encoding of value, so later changes to value are not seen by the state
+func (s *AgentState) Set(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = data
+	return nil
+}
+
+// Get decodes the value stored under key into out and reports whether the key exists
+func (s *AgentState) Get(key string, out any) (bool, error) {
+	s.mu.RLock()
+	data, ok := s.values[key]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+func (s *AgentState) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// Keys returns the stored keys in sorted order
+func (s *AgentState) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *AgentState) MarshalJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.Marshal(s.values)
+}
+
+// UnmarshalJSON replaces every value of the state
+func (s *AgentState) UnmarshalJSON(data []byte) error {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = values
+	return nil
+}
+
+// GetState is the typed form of AgentState.Get
+func GetState[T any](s *AgentState, key string) (T, bool, error) {
+	var value T
+	ok, err := s.Get(key, &value)
+	return value, ok, err
+}
+
+// SetState is the typed form of AgentState.Set
+func SetState[T any](s *AgentState, key string, value T) error {
+	return s.Set(key, value)
+}
+
+type stateContextKey struct{}
+
+func withState(ctx context.Context, state *AgentState) context.Context {
+	return context.WithValue(ctx, stateContextKey{}, state)
+}
+
+// StateFromContext returns the state of the agent that is calling the tool
+// It returns nil outside of a tool call
+func StateFromContext(ctx context.Context) *AgentState {
+	state, _ := ctx.Value(stateContextKey{}).(*AgentState)
+	return state
+}
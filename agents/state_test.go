@@ -0,0 +1,68 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type preferences struct {
+	Language string   `json:"language"`
+	Topics   []string `json:"topics"`
+}
+
+func TestAgentState(t *testing.T) {
+	state := NewAgentState()
+	if err := SetState(state, "prefs", preferences{Language: "go", Topics: []string{"agents"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Set("count", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, ok, err := GetState[preferences](state, "prefs")
+	if err != nil || !ok {
+		t.Fatalf("expected prefs, got %v %v", ok, err)
+	}
+	if prefs.Language != "go" || len(prefs.Topics) != 1 {
+		t.Errorf("unexpected prefs %+v", prefs)
+	}
+	if _, ok, _ := GetState[int](state, "missing"); ok {
+		t.Error("expected missing key")
+	}
+	if _, _, err := GetState[int](state, "prefs"); err == nil {
+		t.Error("expected a type error")
+	}
+	if keys := state.Keys(); !reflect.DeepEqual(keys, []string{"count", "prefs"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewAgentState()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	count, _, err := GetState[int](decoded, "count")
+	if err != nil || count != 3 {
+		t.Errorf("expected 3, got %d %v", count, err)
+	}
+
+	decoded.Delete("count")
+	if keys := decoded.Keys(); !reflect.DeepEqual(keys, []string{"prefs"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestStateFromContext(t *testing.T) {
+	if StateFromContext(context.Background()) != nil {
+		t.Error("expected no state")
+	}
+	state := NewAgentState()
+	if StateFromContext(withState(context.Background(), state)) != state {
+		t.Error("expected the state from the context")
+	}
+}
@@ -0,0 +1,260 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// SchemaVersion is the version written by Marshal and MarshalMessage
+//
+// Version 0 is the JSON the SDK's own param structs produce, it has no schema_version field
+const SchemaVersion = 1
+
+var ErrUnsupportedVersion = errors.New("codec: unsupported schema version")
+
+// Conversation is the serialized form of a list of messages
+type Conversation struct {
+	SchemaVersion int       `json:"schema_version"`
+	Messages      []Message `json:"messages"`
+}
+
+// Message is a provider neutral message, it does not depend on the SDK's param structs
+type Message struct {
+	SchemaVersion int     `json:"schema_version,omitempty"`
+	Role          string  `json:"role"`
+	Content       []Block `json:"content"`
+}
+
+// Block is a content block, Type selects which of the fields are used
+//
+//	text               Text, Citations
+//	image              Source
+//	document           Source, Title, Context, CitationsEnabled
+//	tool_use           ID, Name, Input
+//	tool_result        ToolUseID, IsError, Content
+//	thinking           Thinking, Signature
+//	redacted_thinking  Data
+type Block struct {
+	Type             string          `json:"type"`
+	Text             string          `json:"text,omitempty"`
+	Citations        []Citation      `json:"citations,omitempty"`
+	Source           *Source         `json:"source,omitempty"`
+	Title            *string         `json:"title,omitempty"`
+	Context          *string         `json:"context,omitempty"`
+	CitationsEnabled *bool           `json:"citations_enabled,omitempty"`
+	ID               string          `json:"id,omitempty"`
+	Name             string          `json:"name,omitempty"`
+	Input            json.RawMessage `json:"input,omitempty"`
+	ToolUseID        string          `json:"tool_use_id,omitempty"`
+	IsError          *bool           `json:"is_error,omitempty"`
+	Content          []Block         `json:"content,omitempty"`
+	Thinking         string          `json:"thinking,omitempty"`
+	Signature        string          `json:"signature,omitempty"`
+	Data             string          `json:"data,omitempty"`
+	CacheControl     *CacheControl   `json:"cache_control,omitempty"`
+}
+
+// Source is where an image or document comes from
+//
+//	base64   MediaType, Data
+//	url      URL
+//	text     MediaType, Data
+//	content  Data for a plain string, Content for a list of text and image blocks
+type Source struct {
+	Type      string  `json:"type"`
+	MediaType string  `json:"media_type,omitempty"`
+	Data      string  `json:"data,omitempty"`
+	URL       string  `json:"url,omitempty"`
+	Content   []Block `json:"content,omitempty"`
+}
+
+// Citation points from a text block into a document or search result
+type Citation struct {
+	Type              string  `json:"type"`
+	CitedText         string  `json:"cited_text"`
+	DocumentIndex     int64   `json:"document_index,omitempty"`
+	DocumentTitle     *string `json:"document_title,omitempty"`
+	StartCharIndex    int64   `json:"start_char_index,omitempty"`
+	EndCharIndex      int64   `json:"end_char_index,omitempty"`
+	StartPageNumber   int64   `json:"start_page_number,omitempty"`
+	EndPageNumber     int64   `json:"end_page_number,omitempty"`
+	StartBlockIndex   int64   `json:"start_block_index,omitempty"`
+	EndBlockIndex     int64   `json:"end_block_index,omitempty"`
+	SearchResultIndex int64   `json:"search_result_index,omitempty"`
+	Title             *string `json:"title,omitempty"`
+	URL               string  `json:"url,omitempty"`
+	EncryptedIndex    string  `json:"encrypted_index,omitempty"`
+	Source            string  `json:"source,omitempty"`
+}
+
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+// Migration upgrades one raw message by a single schema version
+type Migration func(message json.RawMessage) (json.RawMessage, error)
+
+var (
+	migrationsMu sync.RWMutex
+	// migrations[v] upgrades a message from version v to v+1
+	migrations = map[int]Migration{
+		0: migrateV0,
+	}
+)
+
+// RegisterMigration sets the migration that upgrades messages written with version from
+func RegisterMigration(from int, migration Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	migrations[from] = migration
+}
+
+// Marshal serializes messages into a versioned conversation document
+func Marshal(messages []anthropic.MessageParam) ([]byte, error) {
+	conversation := Conversation{SchemaVersion: SchemaVersion, Messages: make([]Message, 0, len(messages))}
+	for _, message := range messages {
+		converted, err := FromMessageParam(message)
+		if err != nil {
+			return nil, err
+		}
+		conversation.Messages = append(conversation.Messages, converted)
+	}
+	return json.Marshal(conversation)
+}
+
+// Unmarshal reads a conversation document written by Marshal with any known schema version
+func Unmarshal(data []byte) ([]anthropic.MessageParam, error) {
+	var raw struct {
+		SchemaVersion int               `json:"schema_version"`
+		Messages      []json.RawMessage `json:"messages"`
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		// a bare array is a version 0 list of SDK messages
+		if err := json.Unmarshal(data, &raw.Messages); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	messages := make([]anthropic.MessageParam, 0, len(raw.Messages))
+	for _, data := range raw.Messages {
+		message, err := decodeMessage(data, raw.SchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// MarshalMessage serializes a single message, the schema version is stored inline
+func MarshalMessage(message anthropic.MessageParam) ([]byte, error) {
+	converted, err := FromMessageParam(message)
+	if err != nil {
+		return nil, err
+	}
+	converted.SchemaVersion = SchemaVersion
+	return json.Marshal(converted)
+}
+
+// UnmarshalMessage reads a message written by MarshalMessage or by the SDK itself
+func UnmarshalMessage(data []byte) (anthropic.MessageParam, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return anthropic.MessageParam{}, err
+	}
+	return decodeMessage(data, header.SchemaVersion)
+}
+
+func decodeMessage(data json.RawMessage, version int) (anthropic.MessageParam, error) {
+	data, err := migrate(data, version)
+	if err != nil {
+		return anthropic.MessageParam{}, err
+	}
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return anthropic.MessageParam{}, err
+	}
+	return message.ToParam()
+}
+
+func migrate(data json.RawMessage, version int) (json.RawMessage, error) {
+	if version > SchemaVersion || version < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	for ; version < SchemaVersion; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from %d", ErrUnsupportedVersion, version)
+		}
+		migrated, err := migration(data)
+		if err != nil {
+			return nil, fmt.Errorf("codec: migrating from version %d: %w", version, err)
+		}
+		data = migrated
+	}
+	return data, nil
+}
+
+// migrateV0 upgrades JSON written by the SDK's param structs
+// It mostly shares the field names of version 1, only the spots below differ
+func migrateV0(data json.RawMessage) (json.RawMessage, error) {
+	var message map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&message); err != nil {
+		return nil, err
+	}
+	message["content"] = migrateV0Content(message["content"])
+	return json.Marshal(message)
+}
+
+func migrateV0Content(content any) any {
+	// content may be a plain string
+	if text, ok := content.(string); ok {
+		return []any{map[string]any{"type": "text", "text": text}}
+	}
+	blocks, ok := content.([]any)
+	if !ok {
+		return content
+	}
+	for _, item := range blocks {
+		block, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "document":
+			// the citations setting of documents is an object
+			if citations, ok := block["citations"].(map[string]any); ok {
+				delete(block, "citations")
+				if enabled, ok := citations["enabled"]; ok {
+					block["citations_enabled"] = enabled
+				}
+			}
+			// a content source may hold a plain string
+			if source, ok := block["source"].(map[string]any); ok && source["type"] == "content" {
+				if text, ok := source["content"].(string); ok {
+					delete(source, "content")
+					source["data"] = text
+				}
+			}
+		case "tool_result":
+			if nested, ok := block["content"]; ok {
+				block["content"] = migrateV0Content(nested)
+			}
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+)
+
+func sampleMessages() []anthropic.MessageParam {
+	document := anthropic.DocumentBlockParam{
+		Source:    anthropic.DocumentBlockParamSourceUnion{OfText: &anthropic.PlainTextSourceParam{Data: "The grass is green."}},
+		Title:     param.NewOpt("facts"),
+		Citations: anthropic.CitationsConfigParam{Enabled: param.NewOpt(true)},
+	}
+	contentDocument := anthropic.DocumentBlockParam{
+		Source: anthropic.DocumentBlockParamSourceUnion{OfContent: &anthropic.ContentBlockSourceParam{
+			Content: anthropic.ContentBlockSourceContentUnionParam{OfContentBlockSourceContent: []anthropic.ContentBlockSourceContentItemUnionParam{
+				{OfText: &anthropic.TextBlockParam{Text: "chunk"}},
+			}},
+		}},
+	}
+	cachedText := anthropic.TextBlockParam{Text: "long system context", CacheControl: anthropic.NewCacheControlEphemeralParam()}
+	cited := anthropic.TextBlockParam{
+		Text: "The grass is green.",
+		Citations: []anthropic.TextCitationParamUnion{
+			{OfCharLocation: &anthropic.CitationCharLocationParam{CitedText: "The grass is green.", DocumentIndex: 0, DocumentTitle: param.NewOpt("facts"), StartCharIndex: 0, EndCharIndex: 19}},
+			{OfPageLocation: &anthropic.CitationPageLocationParam{CitedText: "page", DocumentIndex: 1, StartPageNumber: 1, EndPageNumber: 2}},
+			{OfWebSearchResultLocation: &anthropic.CitationWebSearchResultLocationParam{CitedText: "web", URL: "https://example.com", EncryptedIndex: "abc", Title: param.NewOpt("Example")}},
+		},
+	}
+	toolResult := anthropic.ToolResultBlockParam{
+		ToolUseID: "toolu_1",
+		Content: []anthropic.ToolResultBlockParamContentUnion{
+			{OfText: &anthropic.TextBlockParam{Text: "4"}},
+			{OfImage: &anthropic.ImageBlockParam{Source: anthropic.ImageBlockParamSourceUnion{OfURL: &anthropic.URLImageSourceParam{URL: "https://example.com/a.png"}}}},
+		},
+	}
+	return []anthropic.MessageParam{
+		anthropic.NewUserMessage(
+			anthropic.NewTextBlock("What is 2+2?"),
+			anthropic.ContentBlockParamUnion{OfText: &cachedText},
+			anthropic.NewImageBlockBase64("image/png", "aGVsbG8="),
+			anthropic.ContentBlockParamUnion{OfDocument: &document},
+			anthropic.ContentBlockParamUnion{OfDocument: &contentDocument},
+			anthropic.NewDocumentBlock(anthropic.URLPDFSourceParam{URL: "https://example.com/a.pdf"}),
+		),
+		anthropic.NewAssistantMessage(
+			anthropic.NewThinkingBlock("sig", "let me add"),
+			anthropic.NewRedactedThinkingBlock("secret"),
+			anthropic.NewToolUseBlock("toolu_1", map[string]any{"a": 2, "b": 2}, "add"),
+		),
+		anthropic.NewUserMessage(
+			anthropic.ContentBlockParamUnion{OfToolResult: &toolResult},
+			anthropic.NewToolResultBlock("toolu_2", "boom", true),
+		),
+		anthropic.NewAssistantMessage(anthropic.ContentBlockParamUnion{OfText: &cited}),
+	}
+}
+
+// sdkJSON is the reference for lossless round trips, it is what the API receives
+func sdkJSON(t *testing.T, messages []anthropic.MessageParam) string {
+	t.Helper()
+	data, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMarshalUnmarshal_RoundTrip(t *testing.T) {
+	messages := sampleMessages()
+	data, err := Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"schema_version":1`) {
+		t.Errorf("expected schema_version in %s", data)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := sdkJSON(t, messages), sdkJSON(t, decoded); expected != got {
+		t.Errorf("round trip changed the messages\nexpected %s\ngot      %s", expected, got)
+	}
+}
+
+func TestMarshalMessage_RoundTrip(t *testing.T) {
+	for _, message := range sampleMessages() {
+		data, err := MarshalMessage(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := UnmarshalMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := sdkJSON(t, []anthropic.MessageParam{message})
+		if got := sdkJSON(t, []anthropic.MessageParam{decoded}); expected != got {
+			t.Errorf("round trip changed the message\nexpected %s\ngot      %s", expected, got)
+		}
+	}
+}
+
+func TestUnmarshal_Version0(t *testing.T) {
+	testcases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name:     "sdk json of a message list",
+			data:     sdkJSON(t, sampleMessages()),
+			expected: sdkJSON(t, sampleMessages()),
+		},
+		{
+			name:     "string content",
+			data:     `[{"role":"user","content":"hello"}]`,
+			expected: `[{"content":[{"text":"hello","type":"text"}],"role":"user"}]`,
+		},
+		{
+			name:     "string tool result content",
+			data:     `[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"42"}]}]`,
+			expected: `[{"content":[{"tool_use_id":"t1","content":[{"text":"42","type":"text"}],"type":"tool_result"}],"role":"user"}]`,
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			messages, err := Unmarshal([]byte(testcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sdkJSON(t, messages); got != testcase.expected {
+				t.Errorf("expected %s, got %s", testcase.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_UnsupportedVersion(t *testing.T) {
+	_, err := Unmarshal([]byte(`{"schema_version":99,"messages":[{"role":"user","content":[]}]}`))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	_, err = UnmarshalMessage([]byte(`{"schema_version":99,"role":"user","content":[]}`))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	original := migrations[0]
+	t.Cleanup(func() { RegisterMigration(0, original) })
+
+	RegisterMigration(0, func(message json.RawMessage) (json.RawMessage, error) {
+		var legacy struct {
+			Speaker string `json:"speaker"`
+			Text    string `json:"text"`
+		}
+		if err := json.Unmarshal(message, &legacy); err != nil {
+			return nil, err
+		}
+		return json.Marshal(Message{Role: legacy.Speaker, Content: []Block{{Type: "text", Text: legacy.Text}}})
+	})
+	message, err := UnmarshalMessage([]byte(`{"speaker":"user","text":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Role != anthropic.MessageParamRoleUser || message.Content[0].OfText.Text != "hi" {
+		t.Errorf("migration was not applied: %+v", message)
+	}
+}
+
+func TestFromBlockParam_Unsupported(t *testing.T) {
+	block := anthropic.NewServerToolUseBlock("srvtoolu_1", map[string]any{})
+	if _, err := FromBlockParam(block); !errors.Is(err, ErrUnsupportedBlock) {
+		t.Errorf("expected ErrUnsupportedBlock, got %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+)
+
+var ErrUnsupportedBlock = errors.New("codec: unsupported content block")
+
+// FromMessageParam converts an SDK message into the neutral format
+func FromMessageParam(message anthropic.MessageParam) (Message, error) {
+	converted := Message{Role: string(message.Role), Content: make([]Block, 0, len(message.Content))}
+	for _, block := range message.Content {
+		b, err := FromBlockParam(block)
+		if err != nil {
+			return Message{}, err
+		}
+		converted.Content = append(converted.Content, b)
+	}
+	return converted, nil
+}
+
+// ToParam converts the message back into the SDK's param struct
+func (m Message) ToParam() (anthropic.MessageParam, error) {
+	message := anthropic.MessageParam{
+		Role:    anthropic.MessageParamRole(m.Role),
+		Content: make([]anthropic.ContentBlockParamUnion, 0, len(m.Content)),
+	}
+	for _, block := range m.Content {
+		b, err := block.ToParam()
+		if err != nil {
+			return anthropic.MessageParam{}, err
+		}
+		message.Content = append(message.Content, b)
+	}
+	return message, nil
+}
+
+// FromBlockParam converts an SDK content block into the neutral format
+func FromBlockParam(block anthropic.ContentBlockParamUnion) (Block, error) {
+	switch {
+	case block.OfText != nil:
+		return fromTextParam(*block.OfText)
+	case block.OfImage != nil:
+		return fromImageParam(*block.OfImage)
+	case block.OfDocument != nil:
+		return fromDocumentParam(*block.OfDocument)
+	case block.OfToolUse != nil:
+		input, err := json.Marshal(block.OfToolUse.Input)
+		if err != nil {
+			return Block{}, err
+		}
+		return Block{
+			Type:         "tool_use",
+			ID:           block.OfToolUse.ID,
+			Name:         block.OfToolUse.Name,
+			Input:        input,
+			CacheControl: fromCacheControlParam(block.OfToolUse.CacheControl),
+		}, nil
+	case block.OfToolResult != nil:
+		return fromToolResultParam(*block.OfToolResult)
+	case block.OfThinking != nil:
+		return Block{Type: "thinking", Thinking: block.OfThinking.Thinking, Signature: block.OfThinking.Signature}, nil
+	case block.OfRedactedThinking != nil:
+		return Block{Type: "redacted_thinking", Data: block.OfRedactedThinking.Data}, nil
+	}
+	blockType := "unknown"
+	if t := block.GetType(); t != nil {
+		blockType = *t
+	}
+	return Block{}, fmt.Errorf("%w: %s", ErrUnsupportedBlock, blockType)
+}
+
+// ToParam converts the block back into the SDK's param union
+func (b Block) ToParam() (anthropic.ContentBlockParamUnion, error) {
+	switch b.Type {
+	case "text":
+		text, err := b.toTextParam()
+		if err != nil {
+			return anthropic.ContentBlockParamUnion{}, err
+		}
+		return anthropic.ContentBlockParamUnion{OfText: &text}, nil
+	case "image":
+		image, err := b.toImageParam()
+		if err != nil {
+			return anthropic.ContentBlockParamUnion{}, err
+		}
+		return anthropic.ContentBlockParamUnion{OfImage: &image}, nil
+	case "document":
+		document, err := b.toDocumentParam()
+		if err != nil {
+			return anthropic.ContentBlockParamUnion{}, err
+		}
+		return anthropic.ContentBlockParamUnion{OfDocument: &document}, nil
+	case "tool_use":
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return anthropic.ContentBlockParamUnion{OfToolUse: &anthropic.ToolUseBlockParam{
+			ID:           b.ID,
+			Name:         b.Name,
+			Input:        input,
+			CacheControl: b.toCacheControlParam(),
+		}}, nil
+	case "tool_result":
+		result, err := b.toToolResultParam()
+		if err != nil {
+			return anthropic.ContentBlockParamUnion{}, err
+		}
+		return anthropic.ContentBlockParamUnion{OfToolResult: &result}, nil
+	case "thinking":
+		return anthropic.NewThinkingBlock(b.Signature, b.Thinking), nil
+	case "redacted_thinking":
+		return anthropic.NewRedactedThinkingBlock(b.Data), nil
+	}
+	return anthropic.ContentBlockParamUnion{}, fmt.Errorf("%w: %s", ErrUnsupportedBlock, b.Type)
+}
+
+func fromTextParam(text anthropic.TextBlockParam) (Block, error) {
+	block := Block{Type: "text", Text: text.Text, CacheControl: fromCacheControlParam(text.CacheControl)}
+	for _, citation := range text.Citations {
+		c, err := fromCitationParam(citation)
+		if err != nil {
+			return Block{}, err
+		}
+		block.Citations = append(block.Citations, c)
+	}
+	return block, nil
+}
+
+func (b Block) toTextParam() (anthropic.TextBlockParam, error) {
+	text := anthropic.TextBlockParam{Text: b.Text, CacheControl: b.toCacheControlParam()}
+	for _, citation := range b.Citations {
+		c, err := citation.toParam()
+		if err != nil {
+			return anthropic.TextBlockParam{}, err
+		}
+		text.Citations = append(text.Citations, c)
+	}
+	return text, nil
+}
+
+func fromImageParam(image anthropic.ImageBlockParam) (Block, error) {
+	block := Block{Type: "image", CacheControl: fromCacheControlParam(image.CacheControl)}
+	switch {
+	case image.Source.OfBase64 != nil:
+		block.Source = &Source{Type: "base64", MediaType: string(image.Source.OfBase64.MediaType), Data: image.Source.OfBase64.Data}
+	case image.Source.OfURL != nil:
+		block.Source = &Source{Type: "url", URL: image.Source.OfURL.URL}
+	default:
+		return Block{}, fmt.Errorf("%w: image without source", ErrUnsupportedBlock)
+	}
+	return block, nil
+}
+
+func (b Block) toImageParam() (anthropic.ImageBlockParam, error) {
+	image := anthropic.ImageBlockParam{CacheControl: b.toCacheControlParam()}
+	if b.Source == nil {
+		return image, fmt.Errorf("%w: image without source", ErrUnsupportedBlock)
+	}
+	switch b.Source.Type {
+	case "base64":
+		image.Source.OfBase64 = &anthropic.Base64ImageSourceParam{
+			MediaType: anthropic.Base64ImageSourceMediaType(b.Source.MediaType),
+			Data:      b.Source.Data,
+		}
+	case "url":
+		image.Source.OfURL = &anthropic.URLImageSourceParam{URL: b.Source.URL}
+	default:
+		return image, fmt.Errorf("%w: image source %s", ErrUnsupportedBlock, b.Source.Type)
+	}
+	return image, nil
+}
+
+func fromDocumentParam(document anthropic.DocumentBlockParam) (Block, error) {
+	block := Block{
+		Type:             "document",
+		Title:            fromOpt(document.Title),
+		Context:          fromOpt(document.Context),
+		CitationsEnabled: fromOpt(document.Citations.Enabled),
+		CacheControl:     fromCacheControlParam(document.CacheControl),
+	}
+	source := document.Source
+	switch {
+	case source.OfBase64 != nil:
+		block.Source = &Source{Type: "base64", MediaType: "application/pdf", Data: source.OfBase64.Data}
+	case source.OfText != nil:
+		block.Source = &Source{Type: "text", MediaType: "text/plain", Data: source.OfText.Data}
+	case source.OfURL != nil:
+		block.Source = &Source{Type: "url", URL: source.OfURL.URL}
+	case source.OfContent != nil:
+		block.Source = &Source{Type: "content"}
+		content := source.OfContent.Content
+		if content.OfString.Valid() {
+			block.Source.Data = content.OfString.Value
+		}
+		for _, item := range content.OfContentBlockSourceContent {
+			var converted Block
+			var err error
+			switch {
+			case item.OfText != nil:
+				converted, err = fromTextParam(*item.OfText)
+			case item.OfImage != nil:
+				converted, err = fromImageParam(*item.OfImage)
+			default:
+				err = fmt.Errorf("%w: empty document content item", ErrUnsupportedBlock)
+			}
+			if err != nil {
+				return Block{}, err
+			}
+			block.Source.Content = append(block.Source.Content, converted)
+		}
+	default:
+		return Block{}, fmt.Errorf("%w: document without source", ErrUnsupportedBlock)
+	}
+	return block, nil
+}
+
+func (b Block) toDocumentParam() (anthropic.DocumentBlockParam, error) {
+	document := anthropic.DocumentBlockParam{
+		Title:        toOpt(b.Title),
+		Context:      toOpt(b.Context),
+		Citations:    anthropic.CitationsConfigParam{Enabled: toOpt(b.CitationsEnabled)},
+		CacheControl: b.toCacheControlParam(),
+	}
+	if b.Source == nil {
+		return document, fmt.Errorf("%w: document without source", ErrUnsupportedBlock)
+	}
+	switch b.Source.Type {
+	case "base64":
+		document.Source.OfBase64 = &anthropic.Base64PDFSourceParam{Data: b.Source.Data}
+	case "text":
+		document.Source.OfText = &anthropic.PlainTextSourceParam{Data: b.Source.Data}
+	case "url":
+		document.Source.OfURL = &anthropic.URLPDFSourceParam{URL: b.Source.URL}
+	case "content":
+		content := &anthropic.ContentBlockSourceParam{}
+		if b.Source.Content == nil {
+			content.Content.OfString = param.NewOpt(b.Source.Data)
+		}
+		for _, item := range b.Source.Content {
+			switch item.Type {
+			case "text":
+				text, err := item.toTextParam()
+				if err != nil {
+					return document, err
+				}
+				content.Content.OfContentBlockSourceContent = append(content.Content.OfContentBlockSourceContent,
+					anthropic.ContentBlockSourceContentItemUnionParam{OfText: &text})
+			case "image":
+				image, err := item.toImageParam()
+				if err != nil {
+					return document, err
+				}
+				content.Content.OfContentBlockSourceContent = append(content.Content.OfContentBlockSourceContent,
+					anthropic.ContentBlockSourceContentItemUnionParam{OfImage: &image})
+			default:
+				return document, fmt.Errorf("%w: document content %s", ErrUnsupportedBlock, item.Type)
+			}
+		}
+		document.Source.OfContent = content
+	default:
+		return document, fmt.Errorf("%w: document source %s", ErrUnsupportedBlock, b.Source.Type)
+	}
+	return document, nil
+}
+
+func fromToolResultParam(result anthropic.ToolResultBlockParam) (Block, error) {
+	block := Block{
+		Type:         "tool_result",
+		ToolUseID:    result.ToolUseID,
+		IsError:      fromOpt(result.IsError),
+		CacheControl: fromCacheControlParam(result.CacheControl),
+	}
+	for _, item := range result.Content {
+		var converted Block
+		var err error
+		switch {
+		case item.OfText != nil:
+			converted, err = fromTextParam(*item.OfText)
+		case item.OfImage != nil:
+			converted, err = fromImageParam(*item.OfImage)
+		case item.OfDocument != nil:
+			converted, err = fromDocumentParam(*item.OfDocument)
+		default:
+			err = fmt.Errorf("%w: tool result content", ErrUnsupportedBlock)
+		}
+		if err != nil {
+			return Block{}, err
+		}
+		block.Content = append(block.Content, converted)
+	}
+	return block, nil
+}
+
+func (b Block) toToolResultParam() (anthropic.ToolResultBlockParam, error) {
+	result := anthropic.ToolResultBlockParam{
+		ToolUseID:    b.ToolUseID,
+		IsError:      toOpt(b.IsError),
+		CacheControl: b.toCacheControlParam(),
+	}
+	for _, item := range b.Content {
+		var converted anthropic.ToolResultBlockParamContentUnion
+		switch item.Type {
+		case "text":
+			text, err := item.toTextParam()
+			if err != nil {
+				return result, err
+			}
+			converted.OfText = &text
+		case "image":
+			image, err := item.toImageParam()
+			if err != nil {
+				return result, err
+			}
+			converted.OfImage = &image
+		case "document":
+			document, err := item.toDocumentParam()
+			if err != nil {
+				return result, err
+			}
+			converted.OfDocument = &document
+		default:
+			return result, fmt.Errorf("%w: tool result content %s", ErrUnsupportedBlock, item.Type)
+		}
+		result.Content = append(result.Content, converted)
+	}
+	return result, nil
+}
+
+func fromCitationParam(citation anthropic.TextCitationParamUnion) (Citation, error) {
+	switch {
+	case citation.OfCharLocation != nil:
+		c := citation.OfCharLocation
+		return Citation{
+			Type: "char_location", CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: fromOpt(c.DocumentTitle),
+			StartCharIndex: c.StartCharIndex, EndCharIndex: c.EndCharIndex,
+		}, nil
+	case citation.OfPageLocation != nil:
+		c := citation.OfPageLocation
+		return Citation{
+			Type: "page_location", CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: fromOpt(c.DocumentTitle),
+			StartPageNumber: c.StartPageNumber, EndPageNumber: c.EndPageNumber,
+		}, nil
+	case citation.OfContentBlockLocation != nil:
+		c := citation.OfContentBlockLocation
+		return Citation{
+			Type: "content_block_location", CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: fromOpt(c.DocumentTitle),
+			StartBlockIndex: c.StartBlockIndex, EndBlockIndex: c.EndBlockIndex,
+		}, nil
+	case citation.OfWebSearchResultLocation != nil:
+		c := citation.OfWebSearchResultLocation
+		return Citation{
+			Type: "web_search_result_location", CitedText: c.CitedText, Title: fromOpt(c.Title),
+			URL: c.URL, EncryptedIndex: c.EncryptedIndex,
+		}, nil
+	case citation.OfSearchResultLocation != nil:
+		c := citation.OfSearchResultLocation
+		return Citation{
+			Type: "search_result_location", CitedText: c.CitedText, Title: fromOpt(c.Title), Source: c.Source,
+			SearchResultIndex: c.SearchResultIndex, StartBlockIndex: c.StartBlockIndex, EndBlockIndex: c.EndBlockIndex,
+		}, nil
+	}
+	return Citation{}, fmt.Errorf("%w: empty citation", ErrUnsupportedBlock)
+}
+
+func (c Citation) toParam() (anthropic.TextCitationParamUnion, error) {
+	switch c.Type {
+	case "char_location":
+		return anthropic.TextCitationParamUnion{OfCharLocation: &anthropic.CitationCharLocationParam{
+			CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: toOpt(c.DocumentTitle),
+			StartCharIndex: c.StartCharIndex, EndCharIndex: c.EndCharIndex,
+		}}, nil
+	case "page_location":
+		return anthropic.TextCitationParamUnion{OfPageLocation: &anthropic.CitationPageLocationParam{
+			CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: toOpt(c.DocumentTitle),
+			StartPageNumber: c.StartPageNumber, EndPageNumber: c.EndPageNumber,
+		}}, nil
+	case "content_block_location":
+		return anthropic.TextCitationParamUnion{OfContentBlockLocation: &anthropic.CitationContentBlockLocationParam{
+			CitedText: c.CitedText, DocumentIndex: c.DocumentIndex, DocumentTitle: toOpt(c.DocumentTitle),
+			StartBlockIndex: c.StartBlockIndex, EndBlockIndex: c.EndBlockIndex,
+		}}, nil
+	case "web_search_result_location":
+		return anthropic.TextCitationParamUnion{OfWebSearchResultLocation: &anthropic.CitationWebSearchResultLocationParam{
+			CitedText: c.CitedText, Title: toOpt(c.Title), URL: c.URL, EncryptedIndex: c.EncryptedIndex,
+		}}, nil
+	case "search_result_location":
+		return anthropic.TextCitationParamUnion{OfSearchResultLocation: &anthropic.CitationSearchResultLocationParam{
+			CitedText: c.CitedText, Title: toOpt(c.Title), Source: c.Source,
+			SearchResultIndex: c.SearchResultIndex, StartBlockIndex: c.StartBlockIndex, EndBlockIndex: c.EndBlockIndex,
+		}}, nil
+	}
+	return anthropic.TextCitationParamUnion{}, fmt.Errorf("%w: citation %s", ErrUnsupportedBlock, c.Type)
+}
+
+func fromCacheControlParam(cacheControl anthropic.CacheControlEphemeralParam) *CacheControl {
+	if cacheControl == (anthropic.CacheControlEphemeralParam{}) {
+		return nil
+	}
+	return &CacheControl{Type: "ephemeral", TTL: string(cacheControl.TTL)}
+}
+
+func (b Block) toCacheControlParam() anthropic.CacheControlEphemeralParam {
+	if b.CacheControl == nil {
+		return anthropic.CacheControlEphemeralParam{}
+	}
+	cacheControl := anthropic.NewCacheControlEphemeralParam()
+	cacheControl.TTL = anthropic.CacheControlEphemeralTTL(b.CacheControl.TTL)
+	return cacheControl
+}
+
+func fromOpt[T comparable](opt param.Opt[T]) *T {
+	if !opt.Valid() {
+		return nil
+	}
+	v := opt.Value
+	return &v
+}
+
+func toOpt[T comparable](v *T) param.Opt[T] {
+	if v == nil {
+		return param.Opt[T]{}
+	}
+	return param.NewOpt(*v)
+}
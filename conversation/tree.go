@@ -0,0 +1,337 @@
+package conversation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/session"
+)
+
+const MainBranch = "main"
+
+var (
+	ErrBranchNotFound = errors.New("conversation: branch not found")
+	ErrBranchExists   = errors.New("conversation: branch already exists")
+)
+
+// Branch is one line of a conversation
+// It shares the first ForkIndex messages with its parent and continues with its own messages
+type Branch struct {
+	ID        string
+	ParentID  string
+	ForkIndex int
+	CreatedAt time.Time
+
+	// indexes of the branch's own messages in Tree.messages
+	indexes []int
+}
+
+// Tree keeps every version of a conversation as a tree of branches
+// Messages returns the history of the current branch, ready to be passed to StreamMessages
+// Agents run on the current branch with agents.WithTree, an agent given only a session manager
+// for the same agent id fails with agents.ErrTreeHistory
+type Tree struct {
+	mu       sync.RWMutex
+	messages []anthropic.MessageParam
+	branches map[string]*Branch
+	order    []string
+	current  string
+
+	// manager is nil for trees that only live in memory
+	manager *session.Manager
+	agentID string
+}
+
+// NewTree creates an in-memory tree with an empty main branch
+func NewTree() *Tree {
+	t := &Tree{
+		branches: map[string]*Branch{},
+		current:  MainBranch,
+	}
+	t.addBranch(&Branch{ID: MainBranch, CreatedAt: time.Now().UTC()})
+	return t
+}
+
+// LoadTree restores the tree of an agent from the session store
+// Every change to the returned tree is persisted through manager
+func LoadTree(ctx context.Context, manager *session.Manager, agentID string) (*Tree, error) {
+	messages, err := manager.InitializeAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := manager.Repository().ListBranches(ctx, manager.SessionID(), agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTree()
+	t.manager = manager
+	t.agentID = agentID
+	t.messages = messages
+	if len(stored) == 0 {
+		// history written without branches belongs to the main branch
+		for i := range messages {
+			t.branches[MainBranch].indexes = append(t.branches[MainBranch].indexes, i)
+		}
+		return t, nil
+	}
+
+	t.branches = map[string]*Branch{}
+	t.order = nil
+	for _, branch := range stored {
+		for _, index := range branch.MessageIndexes {
+			if index < 0 || index >= len(messages) {
+				return nil, fmt.Errorf("conversation: branch %q references missing message %d", branch.BranchID, index)
+			}
+		}
+		t.addBranch(&Branch{
+			ID:        branch.BranchID,
+			ParentID:  branch.ParentID,
+			ForkIndex: branch.ForkIndex,
+			CreatedAt: branch.CreatedAt,
+			indexes:   branch.MessageIndexes,
+		})
+		if branch.Current {
+			t.current = branch.BranchID
+		}
+	}
+	if _, ok := t.branches[t.current]; !ok {
+		t.current = t.order[0]
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// validate checks that the parents of the stored branches exist and that they fork within the parent's history,
+// history would fail on anything else
+func (t *Tree) validate() error {
+	lengths := map[string]int{}
+	var length func(id string, depth int) (int, error)
+	length = func(id string, depth int) (int, error) {
+		if n, ok := lengths[id]; ok {
+			return n, nil
+		}
+		branch := t.branches[id]
+		if depth > len(t.branches) {
+			return 0, fmt.Errorf("conversation: branch %q is its own ancestor", id)
+		}
+		n := len(branch.indexes)
+		if branch.ParentID != "" {
+			if _, ok := t.branches[branch.ParentID]; !ok {
+				return 0, fmt.Errorf("conversation: branch %q has missing parent %q", id, branch.ParentID)
+			}
+			parent, err := length(branch.ParentID, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			if branch.ForkIndex < 0 || branch.ForkIndex > parent {
+				return 0, fmt.Errorf("conversation: branch %q forks at %d outside of [0, %d]", id, branch.ForkIndex, parent)
+			}
+			n += branch.ForkIndex
+		}
+		lengths[id] = n
+		return n, nil
+	}
+	for _, id := range t.order {
+		if _, err := length(id, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Current returns the branch new messages are appended to
+func (t *Tree) Current() Branch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return *t.branches[t.current]
+}
+
+// Branches returns every branch in creation order
+func (t *Tree) Branches() []Branch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	branches := make([]Branch, 0, len(t.order))
+	for _, id := range t.order {
+		branches = append(branches, *t.branches[id])
+	}
+	return branches
+}
+
+// Children returns the branches forked from branchID, these are the alternatives to its messages
+func (t *Tree) Children(branchID string) []Branch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	children := []Branch{}
+	for _, id := range t.order {
+		if t.branches[id].ParentID == branchID {
+			children = append(children, *t.branches[id])
+		}
+	}
+	return children
+}
+
+// Messages returns the full history of the current branch
+func (t *Tree) Messages() []anthropic.MessageParam {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.history(t.current)
+}
+
+// BranchMessages returns the full history of any branch
+func (t *Tree) BranchMessages(branchID string) ([]anthropic.MessageParam, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if _, ok := t.branches[branchID]; !ok {
+		return nil, ErrBranchNotFound
+	}
+	return t.history(branchID), nil
+}
+
+// Append adds messages to the end of the current branch
+func (t *Tree) Append(ctx context.Context, messages ...anthropic.MessageParam) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start := len(t.messages)
+	if t.manager != nil {
+		repo := t.manager.Repository()
+		appended, err := repo.AppendMessages(ctx, t.manager.SessionID(), t.agentID, messages)
+		if err != nil {
+			return err
+		}
+		if appended[0].Index != start {
+			return fmt.Errorf("conversation: history of agent %q was changed outside the tree", t.agentID)
+		}
+	}
+	// the stored messages are kept even when the branch is not saved, they belong to no branch then
+	t.messages = append(t.messages, messages...)
+
+	branch := *t.branches[t.current]
+	branch.indexes = slices.Clone(branch.indexes)
+	for i := range messages {
+		branch.indexes = append(branch.indexes, start+i)
+	}
+	if err := t.save(ctx, t.current, &branch); err != nil {
+		return err
+	}
+	t.branches[branch.ID] = &branch
+	return nil
+}
+
+// Fork creates a branch that keeps the first index messages of the current branch
+// and makes it current, an empty branchID generates one
+// Appending to the new branch leaves the messages after index untouched on the old one
+func (t *Tree) Fork(ctx context.Context, index int, branchID string) (Branch, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if branchID == "" {
+		branchID = newBranchID()
+	}
+	if _, ok := t.branches[branchID]; ok {
+		return Branch{}, ErrBranchExists
+	}
+	if length := len(t.history(t.current)); index < 0 || index > length {
+		return Branch{}, fmt.Errorf("conversation: fork index %d out of range [0, %d]", index, length)
+	}
+
+	// fork from the branch that owns the message at index so parent pointers stay minimal
+	parent := t.branches[t.current]
+	for parent.ParentID != "" && index <= parent.ForkIndex {
+		parent = t.branches[parent.ParentID]
+	}
+	branch := &Branch{
+		ID:        branchID,
+		ParentID:  parent.ID,
+		ForkIndex: index,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := t.save(ctx, branch.ID, t.branches[t.current], branch); err != nil {
+		return Branch{}, err
+	}
+	t.addBranch(branch)
+	t.current = branch.ID
+	return *branch, nil
+}
+
+// Rewind goes back to the first index messages of the current branch
+// The later messages stay reachable on the branch that was current before
+func (t *Tree) Rewind(ctx context.Context, index int) (Branch, error) {
+	return t.Fork(ctx, index, "")
+}
+
+// Checkout makes another branch current
+func (t *Tree) Checkout(ctx context.Context, branchID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	branch, ok := t.branches[branchID]
+	if !ok {
+		return ErrBranchNotFound
+	}
+	if err := t.save(ctx, branchID, t.branches[t.current], branch); err != nil {
+		return err
+	}
+	t.current = branchID
+	return nil
+}
+
+func (t *Tree) addBranch(branch *Branch) {
+	t.branches[branch.ID] = branch
+	t.order = append(t.order, branch.ID)
+}
+
+// history must be called with the lock held
+func (t *Tree) history(branchID string) []anthropic.MessageParam {
+	branch := t.branches[branchID]
+	messages := []anthropic.MessageParam{}
+	if branch.ParentID != "" {
+		messages = append(messages, t.history(branch.ParentID)[:branch.ForkIndex]...)
+	}
+	for _, index := range branch.indexes {
+		messages = append(messages, t.messages[index])
+	}
+	return messages
+}
+
+// save persists branches when the tree is backed by a session store, current is the branch that will be current
+// Changes are saved before they are made in memory and in one repository call,
+// so that a failed save leaves the tree and the store as they were
+func (t *Tree) save(ctx context.Context, current string, branches ...*Branch) error {
+	if t.manager == nil {
+		return nil
+	}
+	stored := make([]*session.SessionBranch, 0, len(branches))
+	for _, branch := range branches {
+		stored = append(stored, &session.SessionBranch{
+			SessionID:      t.manager.SessionID(),
+			AgentID:        t.agentID,
+			BranchID:       branch.ID,
+			ParentID:       branch.ParentID,
+			ForkIndex:      branch.ForkIndex,
+			MessageIndexes: branch.indexes,
+			Current:        branch.ID == current,
+			CreatedAt:      branch.CreatedAt,
+		})
+	}
+	return t.manager.Repository().SaveBranches(ctx, stored...)
+}
+
+func newBranchID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,290 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/session"
+)
+
+func userMessage(text string) anthropic.MessageParam {
+	return anthropic.NewUserMessage(anthropic.NewTextBlock(text))
+}
+
+func assistantMessage(text string) anthropic.MessageParam {
+	return anthropic.NewAssistantMessage(anthropic.NewTextBlock(text))
+}
+
+func texts(messages []anthropic.MessageParam) []string {
+	result := []string{}
+	for _, message := range messages {
+		result = append(result, message.Content[0].OfText.Text)
+	}
+	return result
+}
+
+// buildTree creates main: q1 a1 q2 a2, then edits q2 on a fork and regenerates
+func buildTree(t *testing.T, tree *Tree) {
+	t.Helper()
+	ctx := context.Background()
+	if err := tree.Append(ctx, userMessage("q1"), assistantMessage("a1"), userMessage("q2"), assistantMessage("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Fork(ctx, 2, "edit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Append(ctx, userMessage("q2 edited"), assistantMessage("a2 regenerated")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTree_Fork(t *testing.T) {
+	tree := NewTree()
+	buildTree(t, tree)
+
+	testcases := []struct {
+		name     string
+		branchID string
+		expected []string
+	}{
+		{
+			name:     "original branch is untouched",
+			branchID: MainBranch,
+			expected: []string{"q1", "a1", "q2", "a2"},
+		},
+		{
+			name:     "fork shares the messages before the fork index",
+			branchID: "edit",
+			expected: []string{"q1", "a1", "q2 edited", "a2 regenerated"},
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			messages, err := tree.BranchMessages(testcase.branchID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(messages); !slices.Equal(got, testcase.expected) {
+				t.Errorf("expected %v, got %v", testcase.expected, got)
+			}
+		})
+	}
+	if current := tree.Current(); current.ID != "edit" || current.ParentID != MainBranch || current.ForkIndex != 2 {
+		t.Errorf("unexpected current branch %+v", current)
+	}
+	if children := tree.Children(MainBranch); len(children) != 1 || children[0].ID != "edit" {
+		t.Errorf("expected edit to be the only child of main, got %+v", children)
+	}
+}
+
+func TestTree_ForkErrors(t *testing.T) {
+	ctx := context.Background()
+	tree := NewTree()
+	buildTree(t, tree)
+
+	if _, err := tree.Fork(ctx, 5, ""); err == nil {
+		t.Error("expected error for fork index past the end")
+	}
+	if _, err := tree.Fork(ctx, -1, ""); err == nil {
+		t.Error("expected error for negative fork index")
+	}
+	if _, err := tree.Fork(ctx, 1, "edit"); !errors.Is(err, ErrBranchExists) {
+		t.Errorf("expected ErrBranchExists, got %v", err)
+	}
+	if err := tree.Checkout(ctx, "missing"); !errors.Is(err, ErrBranchNotFound) {
+		t.Errorf("expected ErrBranchNotFound, got %v", err)
+	}
+}
+
+func TestTree_ForkBeforeParentForkIndex(t *testing.T) {
+	ctx := context.Background()
+	tree := NewTree()
+	buildTree(t, tree)
+
+	// index 1 lies in the part "edit" inherited from main, so the fork hangs off main
+	branch, err := tree.Fork(ctx, 1, "early")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch.ParentID != MainBranch {
+		t.Errorf("expected parent %q, got %q", MainBranch, branch.ParentID)
+	}
+	if got := texts(tree.Messages()); !slices.Equal(got, []string{"q1"}) {
+		t.Errorf("unexpected history %v", got)
+	}
+}
+
+func TestTree_Rewind(t *testing.T) {
+	ctx := context.Background()
+	tree := NewTree()
+	buildTree(t, tree)
+
+	previous := tree.Current().ID
+	branch, err := tree.Rewind(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(tree.Messages()); !slices.Equal(got, []string{"q1", "a1", "q2 edited"}) {
+		t.Errorf("unexpected history after rewind %v", got)
+	}
+	if branch.ParentID != previous {
+		t.Errorf("expected rewind to fork from %q, got %q", previous, branch.ParentID)
+	}
+	if err := tree.Checkout(ctx, previous); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tree.Messages()); got != 4 {
+		t.Errorf("expected the rewound messages to stay on %q, got %d messages", previous, got)
+	}
+}
+
+func TestLoadTree(t *testing.T) {
+	ctx := context.Background()
+	repo, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := LoadTree(ctx, session.NewManager(repo, "s1", "alice"), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildTree(t, tree)
+
+	loaded, err := LoadTree(ctx, session.NewManager(repo, "s1", "alice"), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Current().ID; got != "edit" {
+		t.Errorf("expected current branch edit, got %q", got)
+	}
+	if got, expected := texts(loaded.Messages()), texts(tree.Messages()); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	main, err := loaded.BranchMessages(MainBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(main); !slices.Equal(got, []string{"q1", "a1", "q2", "a2"}) {
+		t.Errorf("unexpected main history %v", got)
+	}
+}
+
+func TestLoadTree_HistoryWithoutBranches(t *testing.T) {
+	ctx := context.Background()
+	repo, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := session.NewManager(repo, "s1", "alice")
+	if _, err := manager.InitializeAgent(ctx, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.AppendMessages(ctx, "default", userMessage("q1"), assistantMessage("a1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := LoadTree(ctx, manager, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Current().ID; got != MainBranch {
+		t.Errorf("expected main branch, got %q", got)
+	}
+	if got := texts(tree.Messages()); !slices.Equal(got, []string{"q1", "a1"}) {
+		t.Errorf("unexpected history %v", got)
+	}
+}
+
+// failingRepository fails to save branches while fail is set
+type failingRepository struct {
+	session.Repository
+	fail bool
+}
+
+func (r *failingRepository) SaveBranches(ctx context.Context, branches ...*session.SessionBranch) error {
+	if r.fail {
+		return errors.New("save failed")
+	}
+	return r.Repository.SaveBranches(ctx, branches...)
+}
+
+func TestTree_FailedSave(t *testing.T) {
+	ctx := context.Background()
+	files, err := session.NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &failingRepository{Repository: files}
+	tree, err := LoadTree(ctx, session.NewManager(repo, "s1", "alice"), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Append(ctx, userMessage("q1"), assistantMessage("a1")); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.fail = true
+	if err := tree.Append(ctx, userMessage("lost")); err == nil {
+		t.Fatal("expected the append to fail")
+	}
+	if _, err := tree.Fork(ctx, 1, "fork"); err == nil {
+		t.Fatal("expected the fork to fail")
+	}
+	if err := tree.Checkout(ctx, MainBranch); err == nil {
+		t.Fatal("expected the checkout to fail")
+	}
+	if got := texts(tree.Messages()); !slices.Equal(got, []string{"q1", "a1"}) {
+		t.Errorf("expected the failed append to leave the branch as it was, got %v", got)
+	}
+	if got := len(tree.Branches()); got != 1 || tree.Current().ID != MainBranch {
+		t.Errorf("expected the failed fork to leave the branches as they were, got %d on %q", got, tree.Current().ID)
+	}
+
+	repo.fail = false
+	if err := tree.Append(ctx, userMessage("q2")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTree(ctx, session.NewManager(repo, "s1", "alice"), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := texts(loaded.Messages()), []string{"q1", "a1", "q2"}; !slices.Equal(got, expected) || !slices.Equal(texts(tree.Messages()), expected) {
+		t.Errorf("expected %v, got %v and %v", expected, texts(tree.Messages()), got)
+	}
+}
+
+func TestLoadTree_InvalidBranches(t *testing.T) {
+	ctx := context.Background()
+	for name, branches := range map[string][]session.SessionBranch{
+		"fork after the parent's history": {{BranchID: MainBranch, MessageIndexes: []int{0}}, {BranchID: "b", ParentID: MainBranch, ForkIndex: 2}},
+		"negative fork index":             {{BranchID: MainBranch}, {BranchID: "b", ParentID: MainBranch, ForkIndex: -1}},
+		"missing parent":                  {{BranchID: MainBranch}, {BranchID: "b", ParentID: "missing"}},
+		"cycle":                           {{BranchID: "a", ParentID: "b"}, {BranchID: "b", ParentID: "a"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo, err := session.NewFileRepository(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			manager := session.NewManager(repo, "s1", "alice")
+			if _, err := manager.InitializeAgent(ctx, "default"); err != nil {
+				t.Fatal(err)
+			}
+			if err := manager.AppendMessages(ctx, "default", userMessage("q1")); err != nil {
+				t.Fatal(err)
+			}
+			for _, branch := range branches {
+				branch.SessionID, branch.AgentID = "s1", "default"
+				if err := repo.SaveBranches(ctx, &branch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadTree(ctx, manager, "default"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
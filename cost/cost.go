@@ -0,0 +1,142 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownModel = errors.New("cost: no price for model")
+
+const (
+	// DefaultCacheWriteMultiplier prices 5 minute cache writes relative to input tokens
+	DefaultCacheWriteMultiplier = 1.25
+	// DefaultCacheReadMultiplier prices cache reads relative to input tokens
+	DefaultCacheReadMultiplier = 0.1
+	// BatchDiscount is the share of the price paid for Message Batches requests
+	BatchDiscount = 0.5
+)
+
+// Price is the price of a model in USD per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+	// CacheWriteMultiplier and CacheReadMultiplier apply to Input, zero means the default
+	CacheWriteMultiplier float64
+	CacheReadMultiplier  float64
+}
+
+// PriceTable maps model ids or id prefixes to prices
+type PriceTable map[string]Price
+
+// DefaultPrices lists the public list prices, keys are prefixes of dated model ids
+var DefaultPrices = PriceTable{
+	"claude-opus-4-5":   {Input: 5, Output: 25},
+	"claude-opus-4-1":   {Input: 15, Output: 75},
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-sonnet-4-5": {Input: 3, Output: 15},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-haiku-4-5":  {Input: 1, Output: 5},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+}
+
+// Usage is the token usage of a model call
+type Usage struct {
+	InputTokens              int64
+	OutputTokens             int64
+	CacheCreationInputTokens int64
+	CacheReadInputTokens     int64
+}
+
+func (u *Usage) add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Cost is the price of a usage in USD, broken down by token kind
+type Cost struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+	Total      float64 `json:"total"`
+}
+
+func (c *Cost) Add(other Cost) {
+	c.Input += other.Input
+	c.Output += other.Output
+	c.CacheWrite += other.CacheWrite
+	c.CacheRead += other.CacheRead
+	c.Total += other.Total
+}
+
+// Lookup returns the price of model, an exact key wins over the longest matching prefix
+func (t PriceTable) Lookup(model string) (Price, error) {
+	if price, ok := t[model]; ok {
+		return price, nil
+	}
+	match := ""
+	for key := range t {
+		if strings.HasPrefix(model, key) && len(key) > len(match) {
+			match = key
+		}
+	}
+	if match == "" {
+		return Price{}, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+	return t[match], nil
+}
+
+// Cost prices usage of model
+func (t PriceTable) Cost(model string, usage Usage) (Cost, error) {
+	price, err := t.Lookup(model)
+	if err != nil {
+		return Cost{}, err
+	}
+	return price.Cost(usage), nil
+}
+
+// BatchCost prices usage of a Message Batches request
+func (t PriceTable) BatchCost(model string, usage Usage) (Cost, error) {
+	cost, err := t.Cost(model, usage)
+	if err != nil {
+		return Cost{}, err
+	}
+	return cost.scale(BatchDiscount), nil
+}
+
+func (p Price) Cost(usage Usage) Cost {
+	write, read := p.CacheWriteMultiplier, p.CacheReadMultiplier
+	if write == 0 {
+		write = DefaultCacheWriteMultiplier
+	}
+	if read == 0 {
+		read = DefaultCacheReadMultiplier
+	}
+	cost := Cost{
+		Input:      perToken(p.Input) * float64(usage.InputTokens),
+		Output:     perToken(p.Output) * float64(usage.OutputTokens),
+		CacheWrite: perToken(p.Input*write) * float64(usage.CacheCreationInputTokens),
+		CacheRead:  perToken(p.Input*read) * float64(usage.CacheReadInputTokens),
+	}
+	cost.Total = cost.Input + cost.Output + cost.CacheWrite + cost.CacheRead
+	return cost
+}
+
+func (c Cost) scale(factor float64) Cost {
+	return Cost{
+		Input:      c.Input * factor,
+		Output:     c.Output * factor,
+		CacheWrite: c.CacheWrite * factor,
+		CacheRead:  c.CacheRead * factor,
+		Total:      c.Total * factor,
+	}
+}
+
+func perToken(perMillion float64) float64 {
+	return perMillion / 1_000_000
+}
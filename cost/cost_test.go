@@ -0,0 +1,111 @@
+package cost
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPriceTable_Lookup(t *testing.T) {
+	testcases := []struct {
+		model    string
+		expected float64
+	}{
+		{model: "claude-sonnet-4-5-20250929", expected: 3},
+		{model: "claude-opus-4-1-20250805", expected: 15},
+		{model: "claude-opus-4-5-20251101", expected: 5},
+		{model: "claude-3-5-haiku-latest", expected: 0.8},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.model, func(t *testing.T) {
+			price, err := DefaultPrices.Lookup(testcase.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if price.Input != testcase.expected {
+				t.Errorf("expected %v, got %v", testcase.expected, price.Input)
+			}
+		})
+	}
+	if _, err := DefaultPrices.Lookup("gpt-4"); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("expected ErrUnknownModel, got %v", err)
+	}
+}
+
+func TestPriceTable_Cost(t *testing.T) {
+	prices := PriceTable{"m": {Input: 3, Output: 15}}
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheCreationInputTokens: 200_000, CacheReadInputTokens: 1_000_000}
+
+	cost, err := prices.Cost("m", usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Cost{Input: 3, Output: 1.5, CacheWrite: 0.75, CacheRead: 0.3, Total: 5.55}
+	if !almostEqual(cost.Input, expected.Input) || !almostEqual(cost.Output, expected.Output) ||
+		!almostEqual(cost.CacheWrite, expected.CacheWrite) || !almostEqual(cost.CacheRead, expected.CacheRead) ||
+		!almostEqual(cost.Total, expected.Total) {
+		t.Errorf("expected %+v, got %+v", expected, cost)
+	}
+
+	batch, err := prices.BatchCost("m", usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !almostEqual(batch.Total, expected.Total/2) {
+		t.Errorf("expected half price, got %v", batch.Total)
+	}
+
+	// custom multipliers, e.g. for 1 hour cache writes
+	prices = PriceTable{"m": {Input: 3, Output: 15, CacheWriteMultiplier: 2}}
+	cost, _ = prices.Cost("m", Usage{CacheCreationInputTokens: 1_000_000})
+	if !almostEqual(cost.CacheWrite, 6) {
+		t.Errorf("expected 6, got %v", cost.CacheWrite)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker("tenant-a", WithPrices(PriceTable{"m": {Input: 1, Output: 2}}), WithBudget(3))
+	if err := tracker.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Add("m", Usage{InputTokens: 1_000_000, OutputTokens: 500_000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Check(); err != nil {
+		t.Fatalf("budget not spent yet: %v", err)
+	}
+	if !almostEqual(tracker.Remaining(), 1) {
+		t.Errorf("expected 1 remaining, got %v", tracker.Remaining())
+	}
+	if _, err := tracker.Add("m", Usage{InputTokens: 1_000_000}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := tracker.Check()
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected a budget error, got %v", err)
+	}
+	if budgetErr.Tracker != "tenant-a" || budgetErr.Budget != 3 || !almostEqual(budgetErr.Spent, 3) {
+		t.Errorf("unexpected error %+v", budgetErr)
+	}
+	if tracker.Usage().InputTokens != 2_000_000 || !almostEqual(tracker.ByModel()["m"].Total, 3) {
+		t.Errorf("unexpected totals %+v %+v", tracker.Usage(), tracker.ByModel())
+	}
+
+	if _, err := tracker.Add("unknown", Usage{InputTokens: 10}); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("expected ErrUnknownModel, got %v", err)
+	}
+	if tracker.Usage().InputTokens != 2_000_010 {
+		t.Errorf("tokens of unpriced models are still counted, got %d", tracker.Usage().InputTokens)
+	}
+
+	tracker.Reset()
+	if tracker.Check() != nil || tracker.Total().Total != 0 {
+		t.Error("expected an empty tracker after Reset")
+	}
+}
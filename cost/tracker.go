@@ -0,0 +1,160 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrBudgetExceeded = errors.New("cost: budget exceeded")
+
+// BudgetExceededError is returned instead of calling the model once a tracker's budget is spent
+type BudgetExceededError struct {
+	Tracker string
+	Budget  float64
+	Spent   float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("cost: budget of %s exceeded: spent $%.6f of $%.6f", e.Tracker, e.Spent, e.Budget)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Tracker accumulates the cost of model calls for one scope, e.g. a client, a session or a tenant
+// It is safe for concurrent use
+type Tracker struct {
+	name   string
+	prices PriceTable
+	budget float64
+
+	mu       sync.Mutex
+	total    Cost
+	byModel  map[string]Cost
+	usage    Usage
+	unpriced map[string]Usage
+}
+
+type TrackerOption func(t *Tracker)
+
+// WithPrices replaces DefaultPrices
+func WithPrices(prices PriceTable) TrackerOption {
+	return func(t *Tracker) {
+		t.prices = prices
+	}
+}
+
+// WithBudget sets a hard limit in USD, zero means no limit
+func WithBudget(budget float64) TrackerOption {
+	return func(t *Tracker) {
+		t.budget = budget
+	}
+}
+
+// NewTracker creates a tracker, name identifies it in BudgetExceededError
+func NewTracker(name string, options ...TrackerOption) *Tracker {
+	t := &Tracker{
+		name:     name,
+		prices:   DefaultPrices,
+		byModel:  map[string]Cost{},
+		unpriced: map[string]Usage{},
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+func (t *Tracker) Name() string {
+	return t.name
+}
+
+// Add records a model call and returns its cost
+// The tokens are counted even when the model has no price, see Unpriced
+func (t *Tracker) Add(model string, usage Usage) (Cost, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.add(usage)
+
+	cost, err := t.prices.Cost(model, usage)
+	if err != nil {
+		unpriced := t.unpriced[model]
+		unpriced.add(usage)
+		t.unpriced[model] = unpriced
+		return Cost{}, err
+	}
+	t.total.Add(cost)
+	modelCost := t.byModel[model]
+	modelCost.Add(cost)
+	t.byModel[model] = modelCost
+	return cost, nil
+}
+
+// Check returns a *BudgetExceededError once the budget is spent
+func (t *Tracker) Check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.budget > 0 && t.total.Total >= t.budget {
+		return &BudgetExceededError{Tracker: t.name, Budget: t.budget, Spent: t.total.Total}
+	}
+	return nil
+}
+
+// Total is the cost recorded so far
+func (t *Tracker) Total() Cost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// ByModel is the cost recorded so far by model id
+func (t *Tracker) ByModel() map[string]Cost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byModel := make(map[string]Cost, len(t.byModel))
+	for model, cost := range t.byModel {
+		byModel[model] = cost
+	}
+	return byModel
+}
+
+// Usage is the token usage recorded so far
+func (t *Tracker) Usage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage
+}
+
+// Unpriced is the usage recorded so far for models without a price, by model id
+// It is not part of Total and does not count against the budget
+func (t *Tracker) Unpriced() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	unpriced := make(map[string]Usage, len(t.unpriced))
+	for model, usage := range t.unpriced {
+		unpriced[model] = usage
+	}
+	return unpriced
+}
+
+// Remaining is the budget left, negative when exceeded and zero without a budget
+func (t *Tracker) Remaining() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.budget == 0 {
+		return 0
+	}
+	return t.budget - t.total.Total
+}
+
+// Reset clears the recorded cost and usage, e.g. at the start of a billing period
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total = Cost{}
+	t.usage = Usage{}
+	t.byModel = map[string]Cost{}
+	t.unpriced = map[string]Usage{}
+}
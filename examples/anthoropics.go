@@ -142,10 +142,10 @@ func streamingWithClientCustom() *models.StreamingResponse {
 		anthropic.NewUserMessage(anthropic.NewTextBlock("Explain quantum entanglement in simple terms.")),
 	}
 
-	response, err := client.StreamMessages(context.TODO(), messages, func(delta string) {
+	response, err := client.StreamMessages(context.TODO(), messages, models.TextHandler(func(delta string) {
 		// Custom handling of each text delta
 		//fmt.Print(delta)
-	})
+	}))
 	if err != nil {
 		panic(err.Error())
 	}
@@ -153,3 +153,38 @@ func streamingWithClientCustom() *models.StreamingResponse {
 
 	return response
 }
+
+// Example with typed stream events - print the text, collect every event and report tool input and usage
+func streamingWithHandlers() (*models.StreamingResponse, *models.BufferHandler) {
+	client := models.NewAnthropicClient()
+
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("What is a quaternion?")),
+	}
+
+	buffer := models.NewBufferHandler()
+	handler := models.Handlers(
+		models.PrintHandler(os.Stdout),
+		buffer,
+		models.StreamHandlerFunc(func(event models.StreamEvent) {
+			switch event := event.(type) {
+			case models.ToolInputDeltaEvent:
+				fmt.Printf("[tool input] %s\n", event.PartialJSON)
+			case models.UsageEvent:
+				fmt.Printf("[usage] %d input, %d output tokens\n", event.InputTokens, event.OutputTokens)
+			case models.RetryEvent:
+				fmt.Printf("[retry] attempt %d after status %d\n", event.Attempt, event.StatusCode)
+			}
+		}),
+	)
+
+	response, err := client.StreamMessages(context.TODO(), messages, handler)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := response.Wait(); err != nil {
+		panic(err.Error())
+	}
+
+	return response, buffer
+}
@@ -116,3 +116,17 @@ func TestStreamingWithClientCustom(t *testing.T) {
 	fmt.Printf("Cache Read Input Tokens: %d\n", response.CacheReadInputTokens)
 	fmt.Printf("--------------------------------\n")
 }
+
+func TestStreamingWithHandlers(t *testing.T) {
+	_, ok := getApiKeyFromEnv()
+	if !ok {
+		t.Skip("Skipping test: ANTHROPIC_API_KEY is not set")
+	}
+	response, buffer := streamingWithHandlers()
+
+	fmt.Printf("\n--------------------------------\n")
+	fmt.Printf("Events: %d\n", len(buffer.Events()))
+	fmt.Printf("Buffered text matches content: %v\n", buffer.Text() == response.Content)
+	fmt.Printf("Stop Reason: %s\n", response.StopReason)
+	fmt.Printf("--------------------------------\n")
+}
@@ -0,0 +1,105 @@
+package hooks
+
+import (
+	"encoding/json"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// BeforeInvocation is emitted when an agent starts handling a new message
+type BeforeInvocation struct {
+	AgentID string
+	// Message is the incoming user message, callbacks may change it before it is added
+	// It is nil when the agent resumes after an interrupt
+	Message *anthropic.MessageParam
+}
+
+// AfterInvocation is emitted when an agent invocation ends, successfully or not
+type AfterInvocation struct {
+	AgentID    string
+	StopReason string
+	// Message is the last assistant message, empty when the invocation failed
+	Message anthropic.MessageParam
+	Err     error
+}
+
+func (*AfterInvocation) reverseCallbacks() {}
+
+// MessageAdded is emitted for every message appended to an agent's history
+type MessageAdded struct {
+	AgentID string
+	Message anthropic.MessageParam
+}
+
+// BeforeModelCall is emitted before each request to the model
+type BeforeModelCall struct {
+	// Params is the request about to be sent, callbacks may change it
+	Params *anthropic.MessageNewParams
+}
+
+// ModelStreamEvent is emitted for every event of the model's response stream
+type ModelStreamEvent struct {
+	Event anthropic.MessageStreamEventUnion
+}
+
+// ModelRetry is emitted when a request is sent again after a failed attempt
+type ModelRetry struct {
+	Model string
+	// Attempt counts the retries, starting at 1
+	Attempt int
+	// StatusCode is the status of the failed attempt, zero for network errors
+	StatusCode int
+}
+
+// AfterModelCall is emitted when the model's response stream ends
+type AfterModelCall struct {
+	Model string
+	// Params is the request that was sent
+	Params anthropic.MessageNewParams
+	// Message is the accumulated response of this request
+	Message    anthropic.Message
+	StopReason string
+	Err        error
+	// Duration covers the request from sending to the end of the stream, retries included
+	Duration time.Duration
+	// TimeToFirstToken runs to the first text or tool input delta, it is zero when none was received
+	TimeToFirstToken time.Duration
+}
+
+func (*AfterModelCall) reverseCallbacks() {}
+
+// BeforeToolCall is emitted before a tool is invoked
+// It is emitted concurrently for the calls of a turn when the agent runs tools in parallel
+type BeforeToolCall struct {
+	AgentID   string
+	ToolUseID string
+	Name      string
+	// Input may be changed by callbacks
+	Input json.RawMessage
+	// Tool is the tool that will be invoked, nil when the model named an unknown tool
+	// Callbacks may swap it for another tool
+	Tool tools.Tool
+	// Cancel, when set by a callback, skips the tool and is sent to the model as an error result
+	Cancel string
+}
+
+// AfterToolCall is emitted after a tool was invoked or cancelled
+// Like BeforeToolCall it may be emitted concurrently, each call has its own event
+type AfterToolCall struct {
+	AgentID   string
+	ToolUseID string
+	Name      string
+	Input     json.RawMessage
+	Tool      tools.Tool
+	// Result is sent to the model, callbacks may change it
+	Result tools.Result
+	// Err is the error returned by the tool, it is already reflected in Result
+	Err error
+	// Status is how the call ended, callbacks changing Result do not change it
+	Status   tools.Status
+	Duration time.Duration
+}
+
+func (*AfterToolCall) reverseCallbacks() {}
@@ -0,0 +1,76 @@
+package hooks
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Callback receives a pointer to the event, so it can change the fields the event documents as mutable
+type Callback[E any] func(ctx context.Context, event *E)
+
+// Provider registers a group of related callbacks, e.g. a tracer or a logger
+type Provider interface {
+	RegisterHooks(registry *Registry)
+}
+
+// Registry holds callbacks by event type
+// A nil *Registry is valid and has no callbacks
+type Registry struct {
+	mu        sync.RWMutex
+	callbacks map[reflect.Type][]any
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{callbacks: map[reflect.Type][]any{}}
+	r.AddProvider(providers...)
+	return r
+}
+
+func (r *Registry) AddProvider(providers ...Provider) {
+	for _, provider := range providers {
+		provider.RegisterHooks(r)
+	}
+}
+
+// Add subscribes callback to events of type E
+func Add[E any](r *Registry, callback Callback[E]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := reflect.TypeFor[E]()
+	r.callbacks[key] = append(r.callbacks[key], callback)
+}
+
+// Has reports whether any callback is subscribed to events of type E
+func Has[E any](r *Registry) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.callbacks[reflect.TypeFor[E]()]) > 0
+}
+
+// Invoke calls the callbacks of the event's type in registration order,
+// After* events call them in reverse order so that cleanup mirrors setup
+func Invoke[E any](ctx context.Context, r *Registry, event *E) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	callbacks := slices.Clone(r.callbacks[reflect.TypeFor[E]()])
+	r.mu.RUnlock()
+
+	if _, ok := any(event).(reversed); ok {
+		slices.Reverse(callbacks)
+	}
+	for _, callback := range callbacks {
+		callback.(Callback[E])(ctx, event)
+	}
+}
+
+// reversed is implemented by events whose callbacks run in reverse registration order
+type reversed interface {
+	reverseCallbacks()
+}
@@ -0,0 +1,63 @@
+package hooks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type recorder struct {
+	calls *[]string
+	name  string
+}
+
+func (r recorder) RegisterHooks(registry *Registry) {
+	Add(registry, func(ctx context.Context, event *BeforeModelCall) {
+		*r.calls = append(*r.calls, "before "+r.name)
+	})
+	Add(registry, func(ctx context.Context, event *AfterModelCall) {
+		*r.calls = append(*r.calls, "after "+r.name)
+	})
+}
+
+func TestRegistry_Order(t *testing.T) {
+	calls := []string{}
+	registry := NewRegistry(recorder{&calls, "a"}, recorder{&calls, "b"})
+	ctx := context.Background()
+
+	Invoke(ctx, registry, &BeforeModelCall{})
+	Invoke(ctx, registry, &AfterModelCall{})
+
+	expected := []string{"before a", "before b", "after b", "after a"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestRegistry_Mutation(t *testing.T) {
+	registry := NewRegistry()
+	Add(registry, func(ctx context.Context, event *BeforeToolCall) {
+		event.Input = []byte(`{"path":"safe.txt"}`)
+		event.Cancel = "denied"
+	})
+	event := &BeforeToolCall{Name: "read", Input: []byte(`{"path":"/etc/passwd"}`)}
+	Invoke(context.Background(), registry, event)
+	if string(event.Input) != `{"path":"safe.txt"}` || event.Cancel != "denied" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestRegistry_Has(t *testing.T) {
+	var registry *Registry
+	if Has[MessageAdded](registry) {
+		t.Error("nil registry has no callbacks")
+	}
+	// a nil registry ignores events
+	Invoke(context.Background(), registry, &MessageAdded{})
+
+	registry = NewRegistry()
+	Add(registry, func(ctx context.Context, event *MessageAdded) {})
+	if !Has[MessageAdded](registry) || Has[AfterToolCall](registry) {
+		t.Error("unexpected Has result")
+	}
+}
@@ -0,0 +1,229 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/yuki5155/go-strands-agents/models"
+)
+
+// Turn is one scripted assistant response
+type Turn struct {
+	Thinking   string
+	Text       string
+	ToolUses   []ToolUse
+	StopReason string
+	// InputTokens and OutputTokens default to 10 and 5
+	InputTokens  int64
+	OutputTokens int64
+	// Status other than 200 answers with an API error instead of a stream
+	Status int
+}
+
+type ToolUse struct {
+	ID    string
+	Name  string
+	Input any
+}
+
+// Request is the decoded body of a request the server received
+type Request struct {
+	Model     string            `json:"model"`
+	MaxTokens int64             `json:"max_tokens"`
+	System    []json.RawMessage `json:"system"`
+	Messages  []json.RawMessage `json:"messages"`
+	Tools     []struct {
+		Name string `json:"name"`
+	} `json:"tools"`
+	Raw []byte `json:"-"`
+}
+
+type Server struct {
+	*httptest.Server
+	t        testing.TB
+	mu       sync.Mutex
+	turns    []Turn
+	requests []Request
+}
+
+// NewServer answers each request with the next turn, the server is closed with the test
+func NewServer(t testing.TB, turns ...Turn) *Server {
+	s := &Server{t: t, turns: turns}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client pointed at the server
+func (s *Server) Client(options ...models.Option) *models.AnthropicClient {
+	options = append([]models.Option{models.WithApiKey("test-key"), models.WithBaseURL(s.URL)}, options...)
+	return models.NewAnthropicClient(options...)
+}
+
+// Requests returns every request received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// AddTurns scripts more responses
+func (s *Server) AddTurns(turns ...Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = append(s.turns, turns...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Raw = body
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	if len(s.turns) == 0 {
+		s.mu.Unlock()
+		s.t.Errorf("fakeapi: unexpected request %d", len(s.requests))
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "no scripted turn left")
+		return
+	}
+	turn := s.turns[0]
+	s.turns = s.turns[1:]
+	s.mu.Unlock()
+
+	if turn.Status != 0 && turn.Status != http.StatusOK {
+		writeError(w, turn.Status, errorType(turn.Status), "scripted error")
+		return
+	}
+	writeStream(w, request.Model, turn)
+}
+
+func writeError(w http.ResponseWriter, status int, errorType string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	// the SDK retries these immediately instead of backing off
+	w.Header().Set("retry-after-ms", "0")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":  "error",
+		"error": map[string]any{"type": errorType, "message": message},
+	})
+}
+
+func errorType(status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case 529:
+		return "overloaded_error"
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	}
+	return "api_error"
+}
+
+func writeStream(w http.ResponseWriter, model string, turn Turn) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+
+	inputTokens, outputTokens := turn.InputTokens, turn.OutputTokens
+	if inputTokens == 0 {
+		inputTokens = 10
+	}
+	if outputTokens == 0 {
+		outputTokens = 5
+	}
+	stopReason := turn.StopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+		if len(turn.ToolUses) > 0 {
+			stopReason = "tool_use"
+		}
+	}
+
+	for _, event := range Events(model, turn, inputTokens, outputTokens, stopReason) {
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], mustJSON(event))
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// Events builds the stream events of a turn
+func Events(model string, turn Turn, inputTokens int64, outputTokens int64, stopReason string) []map[string]any {
+	events := []map[string]any{{
+		"type": "message_start",
+		"message": map[string]any{
+			"id": "msg_test", "type": "message", "role": "assistant", "model": model,
+			"content": []any{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": map[string]any{"input_tokens": inputTokens, "output_tokens": 1},
+		},
+	}}
+	index := 0
+	if turn.Thinking != "" {
+		events = append(events,
+			map[string]any{"type": "content_block_start", "index": index, "content_block": map[string]any{"type": "thinking", "thinking": "", "signature": ""}},
+			map[string]any{"type": "content_block_delta", "index": index, "delta": map[string]any{"type": "thinking_delta", "thinking": turn.Thinking}},
+			map[string]any{"type": "content_block_delta", "index": index, "delta": map[string]any{"type": "signature_delta", "signature": "sig"}},
+			map[string]any{"type": "content_block_stop", "index": index},
+		)
+		index++
+	}
+	if turn.Text != "" {
+		events = append(events,
+			map[string]any{"type": "content_block_start", "index": index, "content_block": map[string]any{"type": "text", "text": ""}},
+		)
+		// split the text so clients see several deltas
+		runes := []rune(turn.Text)
+		half := len(runes) / 2
+		for _, part := range []string{string(runes[:half]), string(runes[half:])} {
+			if part == "" {
+				continue
+			}
+			events = append(events,
+				map[string]any{"type": "content_block_delta", "index": index, "delta": map[string]any{"type": "text_delta", "text": part}},
+			)
+		}
+		events = append(events, map[string]any{"type": "content_block_stop", "index": index})
+		index++
+	}
+	for _, toolUse := range turn.ToolUses {
+		events = append(events,
+			map[string]any{"type": "content_block_start", "index": index, "content_block": map[string]any{"type": "tool_use", "id": toolUse.ID, "name": toolUse.Name, "input": map[string]any{}}},
+			map[string]any{"type": "content_block_delta", "index": index, "delta": map[string]any{"type": "input_json_delta", "partial_json": string(mustJSON(toolUse.Input))}},
+			map[string]any{"type": "content_block_stop", "index": index},
+		)
+		index++
+	}
+	events = append(events,
+		map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": nil},
+			"usage": map[string]any{"output_tokens": outputTokens},
+		},
+		map[string]any{"type": "message_stop"},
+	)
+	return events
+}
+
+func mustJSON(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,93 @@
+// Package logging provides the structured logging helpers shared by the library
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// SensitiveKeys are the attribute keys whose values are redacted, compared case-insensitively with '-' read as '_'
+var SensitiveKeys = []string{"api_key", "apikey", "x_api_key", "authorization", "password", "secret", "access_token", "refresh_token"}
+
+// Discard returns a logger that drops every record, it is the default of clients and agents
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// OrDiscard returns logger, or Discard when it is nil
+func OrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard()
+	}
+	return logger
+}
+
+// Redact wraps logger so that the values of SensitiveKeys attributes, also inside groups, are never written
+func Redact(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return nil
+	}
+	if _, ok := logger.Handler().(*redactingHandler); ok {
+		return logger
+	}
+	return slog.New(&redactingHandler{handler: logger.Handler()})
+}
+
+type redactingHandler struct {
+	handler slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redact(attr))
+		return true
+	})
+	return h.handler.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redact(attr)
+	}
+	return &redactingHandler{handler: h.handler.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{handler: h.handler.WithGroup(name)}
+}
+
+func redact(attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() != slog.KindGroup {
+		return attr
+	}
+	group := attr.Value.Group()
+	redacted := make([]slog.Attr, len(group))
+	for i, member := range group {
+		redacted[i] = redact(member)
+	}
+	return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+}
+
+func isSensitive(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, sensitive := range SensitiveKeys {
+		if key == sensitive {
+			return true
+		}
+	}
+	return false
+}
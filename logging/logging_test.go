@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type credentials struct {
+	user string
+	key  string
+}
+
+func (c credentials) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("user", c.user), slog.String("api_key", c.key))
+}
+
+func TestRedact(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := Redact(slog.New(slog.NewJSONHandler(&buffer, nil)))
+	if Redact(logger) != logger {
+		t.Error("expected a redacting logger to be returned as is")
+	}
+
+	logger.With("Authorization", "Bearer sk-1").Info("request",
+		"X-Api-Key", "sk-2",
+		"input_tokens", 10,
+		slog.Group("config", "model", "m", "password", "sk-3"),
+		"credentials", credentials{user: "alice", key: "sk-4"},
+	)
+	output := buffer.String()
+	if strings.Contains(output, "sk-") {
+		t.Errorf("secret leaked: %s", output)
+	}
+	for _, expected := range []string{`"input_tokens":10`, `"model":"m"`, `"user":"alice"`, `"api_key":"[REDACTED]"`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in %s", expected, output)
+		}
+	}
+}
+
+func TestOrDiscard(t *testing.T) {
+	if OrDiscard(nil).Enabled(t.Context(), slog.LevelError) {
+		t.Error("expected the default logger to be silent")
+	}
+}
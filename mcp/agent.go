@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// AskToolName is the name of the tool made by AgentTool
+const AskToolName = "ask"
+
+// AgentTool serves an agent as a single "ask" tool taking a prompt
+// The agent keeps its history across calls, which run one at a time,
+// and the text it streams is sent to the client as progress messages
+func AgentTool(agent *agents.Agent, description string) tools.Tool {
+	spec := tools.Spec{
+		Name:        AskToolName,
+		Description: description,
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"prompt": map[string]any{"type": "string", "description": "The question or task for the agent"},
+			},
+			"required": []string{"prompt"},
+		},
+	}
+	return tools.NewFunc(spec, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		var params struct {
+			Prompt string `json:"prompt"`
+		}
+		if err := json.Unmarshal(input, &params); err != nil || params.Prompt == "" {
+			return tools.ErrorResult("the prompt is required"), nil
+		}
+
+		var mu sync.Mutex
+		deltas := 0
+		progress := models.TextHandler(func(text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			deltas++
+			ReportProgress(ctx, float64(deltas), 0, text)
+		})
+		result, err := agent.Invoke(agents.ContextWithStreamHandler(ctx, progress), params.Prompt)
+		if err != nil {
+			return tools.Result{}, fmt.Errorf("agent %s: %w", agent.ID, err)
+		}
+		return tools.TextResult(result.Text()), nil
+	})
+}
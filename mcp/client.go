@@ -0,0 +1,480 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRestarts is how often a client reconnects after losing its server within the restart window
+	DefaultMaxRestarts = 3
+	// DefaultRestartWindow is the period in which restarts are counted, a server that crashes less often is always restarted
+	DefaultRestartWindow = 10 * time.Minute
+	// DefaultReconnectTimeout limits the initialize handshake with a restarted server
+	DefaultReconnectTimeout = 30 * time.Second
+)
+
+// RequestHandler answers a request sent by the server
+type RequestHandler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// NotificationHandler receives a notification sent by the server
+// Handlers run one at a time in the order of the notifications, apart from the reading
+// of messages, so they may call the server, e.g. ListTools on "notifications/tools/list_changed"
+type NotificationHandler func(ctx context.Context, params json.RawMessage)
+
+// Client talks to one MCP server, it reconnects and initializes again when the server is lost
+// It is safe for concurrent use
+type Client struct {
+	transport        Transport
+	info             Implementation
+	capabilities     map[string]any
+	maxRestarts      int
+	restartWindow    time.Duration
+	reconnectTimeout time.Duration
+	requests         map[string]RequestHandler
+	notifications    map[string]NotificationHandler
+
+	mu          sync.Mutex
+	ready       chan struct{}
+	connErr     error
+	closed      bool
+	initialized bool
+	generation  int
+	restarts    int
+	// restartTimes are the restarts within the restart window
+	restartTimes []time.Time
+	nextID       int64
+	pending      map[int64]chan *Message
+	server       InitializeResult
+
+	// queued holds the notifications waiting for their handlers, notifying is set while they run
+	notifyMu  sync.Mutex
+	queued    []*Message
+	notifying bool
+}
+
+type ClientOption func(c *Client)
+
+// WithClientInfo sets the name and version sent to the server
+func WithClientInfo(name, version string) ClientOption {
+	return func(c *Client) {
+		c.info = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithMaxRestarts replaces DefaultMaxRestarts, zero disables reconnecting
+func WithMaxRestarts(maxRestarts int) ClientOption {
+	return func(c *Client) {
+		c.maxRestarts = maxRestarts
+	}
+}
+
+// WithRestartWindow replaces DefaultRestartWindow
+func WithRestartWindow(window time.Duration) ClientOption {
+	return func(c *Client) {
+		c.restartWindow = window
+	}
+}
+
+// WithReconnectTimeout replaces DefaultReconnectTimeout, requests fail once a restarted server does not initialize in time
+func WithReconnectTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.reconnectTimeout = timeout
+	}
+}
+
+// WithRequestHandler answers the server's requests of method
+func WithRequestHandler(method string, handler RequestHandler) ClientOption {
+	return func(c *Client) {
+		c.requests[method] = handler
+	}
+}
+
+// WithNotificationHandler receives the server's notifications of method, e.g. "notifications/tools/list_changed"
+func WithNotificationHandler(method string, handler NotificationHandler) ClientOption {
+	return func(c *Client) {
+		c.notifications[method] = handler
+	}
+}
+
+func NewClient(transport Transport, options ...ClientOption) *Client {
+	c := &Client{
+		transport:        transport,
+		info:             Implementation{Name: "go-strands-agents", Version: "0.1.0"},
+		capabilities:     map[string]any{},
+		maxRestarts:      DefaultMaxRestarts,
+		restartWindow:    DefaultRestartWindow,
+		reconnectTimeout: DefaultReconnectTimeout,
+		requests:         map[string]RequestHandler{},
+		notifications:    map[string]NotificationHandler{},
+		ready:            make(chan struct{}),
+		pending:          map[int64]chan *Message{},
+	}
+	c.requests["ping"] = func(ctx context.Context, params json.RawMessage) (any, error) {
+		return struct{}{}, nil
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Start connects to the server and performs the initialize handshake
+func (c *Client) Start(ctx context.Context) error {
+	if err := c.connect(ctx); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// ServerInfo is the result of the last initialize handshake
+func (c *Client) ServerInfo() InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// Restarts counts all the reconnections after the server was lost
+func (c *Client) Restarts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restarts
+}
+
+// Close shuts the connection down, pending and later requests fail with ErrClientClosed
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.connErr = ErrClientClosed
+	c.setReady()
+	c.failPending()
+	c.mu.Unlock()
+	return c.transport.Close()
+}
+
+// Call sends a request and decodes its result into result, which may be nil
+// It waits while the client reconnects
+func (c *Client) Call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	ready := c.ready
+	c.mu.Unlock()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.call(ctx, method, params, result)
+}
+
+// Notify sends a notification
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	message := &Message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		message.Params = data
+	}
+	return c.transport.Send(ctx, message)
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	message := &Message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		message.Params = data
+	}
+
+	c.mu.Lock()
+	if c.connErr != nil {
+		err := c.connErr
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	id := c.nextID
+	generation := c.generation
+	response := make(chan *Message, 1)
+	c.pending[id] = response
+	c.mu.Unlock()
+	message.ID = json.RawMessage(strconv.FormatInt(id, 10))
+
+	if err := c.transport.Send(ctx, message); err != nil {
+		c.forget(id)
+		if ctx.Err() != nil {
+			// the request may have reached the server before ctx ended
+			return c.cancel(ctx, method, id)
+		}
+		if errors.Is(err, ErrSessionExpired) {
+			// reconnect before returning so that the next request uses a new session
+			c.disconnected(generation, err)
+		}
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		c.forget(id)
+		return c.cancel(ctx, method, id)
+	case reply, ok := <-response:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.connErr != nil {
+				return c.connErr
+			}
+			return ErrConnectionClosed
+		}
+		if reply.Error != nil {
+			return reply.Error
+		}
+		if result == nil || len(reply.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(reply.Result, result); err != nil {
+			return fmt.Errorf("mcp: decoding result of %s: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// cancel tells the server to stop working on a request abandoned because ctx ended
+func (c *Client) cancel(ctx context.Context, method string, id int64) error {
+	if method != "initialize" {
+		c.Notify(context.WithoutCancel(ctx), "notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+	}
+	return ctx.Err()
+}
+
+func (c *Client) forget(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// connect opens the transport and initializes the connection
+func (c *Client) connect(ctx context.Context) error {
+	if err := c.transport.Connect(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+	go c.readLoop(generation)
+
+	var result InitializeResult
+	params := InitializeParams{ProtocolVersion: ProtocolVersion, Capabilities: c.capabilities, ClientInfo: c.info}
+	if err := c.call(ctx, "initialize", params, &result); err != nil {
+		c.transport.Close()
+		return fmt.Errorf("mcp: initialize: %w", err)
+	}
+	if err := c.Notify(ctx, "notifications/initialized", nil); err != nil {
+		c.transport.Close()
+		return fmt.Errorf("mcp: initialize: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.server = result
+	c.initialized = true
+	c.setReady()
+	return nil
+}
+
+func (c *Client) readLoop(generation int) {
+	for {
+		message, err := c.transport.Receive()
+		if err != nil {
+			c.disconnected(generation, err)
+			return
+		}
+		c.dispatch(message)
+	}
+}
+
+// disconnected fails the pending requests and reconnects when the connection was lost unexpectedly
+func (c *Client) disconnected(generation int, err error) {
+	c.mu.Lock()
+	c.failPending()
+	if c.closed || generation != c.generation || !c.initialized {
+		c.mu.Unlock()
+		return
+	}
+	c.initialized = false
+	c.ready = make(chan struct{})
+	now := time.Now()
+	c.restartTimes = slices.DeleteFunc(c.restartTimes, func(restart time.Time) bool {
+		return now.Sub(restart) >= c.restartWindow
+	})
+	if len(c.restartTimes) >= c.maxRestarts {
+		c.connErr = fmt.Errorf("%w: %v", ErrConnectionClosed, err)
+		c.setReady()
+		c.mu.Unlock()
+		return
+	}
+	c.restarts++
+	c.restartTimes = append(c.restartTimes, now)
+	c.mu.Unlock()
+
+	c.transport.Close()
+	// a restarted server that never answers must not leave the requests waiting
+	ctx, cancel := context.WithTimeout(context.Background(), c.reconnectTimeout)
+	defer cancel()
+	if err := c.connect(ctx); err != nil {
+		c.fail(err)
+	}
+}
+
+// fail makes every request fail with err until the client is closed
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connErr == nil {
+		c.connErr = err
+	}
+	c.setReady()
+}
+
+// setReady releases the requests waiting for the connection, c.mu must be held
+func (c *Client) setReady() {
+	select {
+	case <-c.ready:
+	default:
+		close(c.ready)
+	}
+}
+
+// failPending closes the channels of the pending requests, c.mu must be held
+func (c *Client) failPending() {
+	for id, response := range c.pending {
+		close(response)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) dispatch(message *Message) {
+	switch {
+	case message.IsResponse():
+		id, err := strconv.ParseInt(string(message.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		response, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			response <- message
+		}
+	case message.IsRequest():
+		go c.answer(message)
+	case message.IsNotification():
+		if _, ok := c.notifications[message.Method]; !ok {
+			return
+		}
+		c.notifyMu.Lock()
+		defer c.notifyMu.Unlock()
+		c.queued = append(c.queued, message)
+		if !c.notifying {
+			c.notifying = true
+			go c.notify()
+		}
+	}
+}
+
+// notify runs the handlers of the queued notifications until the queue is empty
+func (c *Client) notify() {
+	for {
+		c.notifyMu.Lock()
+		if len(c.queued) == 0 {
+			c.notifying = false
+			c.notifyMu.Unlock()
+			return
+		}
+		message := c.queued[0]
+		c.queued = c.queued[1:]
+		c.notifyMu.Unlock()
+		c.notifications[message.Method](context.Background(), message.Params)
+	}
+}
+
+// answer runs the handler of a server request and sends its result or error
+func (c *Client) answer(request *Message) {
+	ctx := context.Background()
+	reply := &Message{JSONRPC: jsonrpcVersion, ID: request.ID}
+	handler, ok := c.requests[request.Method]
+	if !ok {
+		reply.Error = &Error{Code: CodeMethodNotFound, Message: "method not found: " + request.Method}
+		c.transport.Send(ctx, reply)
+		return
+	}
+	result, err := handler(ctx, request.Params)
+	if err != nil {
+		reply.Error = toError(err)
+	} else if reply.Result, err = json.Marshal(result); err != nil {
+		reply.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	c.transport.Send(ctx, reply)
+}
+
+// toError keeps the code of *Error and reports other errors as internal errors
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+// ListTools returns every tool of the server, following the pagination cursors
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	return listAll(ctx, c, "tools/list", func(result ListToolsResult) ([]Tool, string) {
+		return result.Tools, result.NextCursor
+	})
+}
+
+// listAll calls a list method until the server returns no cursor, page extracts the items and the cursor of a result
+func listAll[R any, T any](ctx context.Context, c *Client, method string, page func(result R) ([]T, string)) ([]T, error) {
+	all := []T{}
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result R
+		if err := c.Call(ctx, method, params, &result); err != nil {
+			return nil, err
+		}
+		items, next := page(result)
+		all = append(all, items...)
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+// CallTool runs a tool, a failing tool is reported in the result's IsError, not as an error
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.Call(ctx, "tools/call", CallToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,422 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/mcp"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+var serverBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "mcp-server")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	serverBinary = filepath.Join(dir, "server")
+	build := exec.Command("go", "build", "-o", serverBinary, "./testdata/server")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "building the test server:", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func startClient(t *testing.T, options ...mcp.ClientOption) *mcp.Client {
+	t.Helper()
+	client := mcp.NewClient(mcp.NewStdioTransport(serverBinary, nil), options...)
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClient_Tools(t *testing.T) {
+	client := startClient(t)
+	if info := client.ServerInfo(); info.ServerInfo.Name != "test-server" || info.ProtocolVersion != mcp.ProtocolVersion {
+		t.Errorf("unexpected server info %+v", info)
+	}
+
+	adapted, err := client.Tools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, tool := range adapted {
+		names = append(names, tool.Spec().Name)
+	}
+	if strings.Join(names, ",") != "echo,image,resource,fail,crash,sample" {
+		t.Fatalf("unexpected tools %v", names)
+	}
+	if required := adapted[0].Spec().InputSchema["required"]; fmt.Sprint(required) != "[text]" {
+		t.Errorf("unexpected schema %v", adapted[0].Spec().InputSchema)
+	}
+
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "echo", Input: map[string]any{"text": "hello from mcp"}}}},
+		fakeapi.Turn{Text: "done"},
+	)
+	agent, err := agents.NewAgent(context.Background(), server.Client(), agents.WithTools(adapted...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "echo"); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests[0].Tools) != 6 {
+		t.Errorf("expected 6 tools sent to the model, got %d", len(requests[0].Tools))
+	}
+	if result := string(requests[1].Messages[2]); !strings.Contains(result, "hello from mcp") || strings.Contains(result, `"is_error":true`) {
+		t.Errorf("unexpected tool result %s", result)
+	}
+}
+
+func TestToolResult(t *testing.T) {
+	client := startClient(t)
+	adapted, err := client.Tools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := tools.NewRegistry(adapted...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoke := func(name string) (tools.Result, string) {
+		tool, err := registry.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := tool.Invoke(context.Background(), json.RawMessage(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(result.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result, string(data)
+	}
+
+	if _, content := invoke("image"); content != `[{"source":{"data":"iVBORw0KGgo=","media_type":"image/png","type":"base64"},"type":"image"},{"text":"[audio content omitted]","type":"text"}]` {
+		t.Errorf("unexpected image content %s", content)
+	}
+	if _, content := invoke("resource"); content != `[{"source":{"data":"some notes","media_type":"text/plain","type":"text"},"title":"file:///notes.txt","type":"document"},{"text":"[resource link big: file:///big.bin]","type":"text"}]` {
+		t.Errorf("unexpected resource content %s", content)
+	}
+	if result, _ := invoke("fail"); !result.IsError || result.Text() != "it failed" {
+		t.Errorf("expected an error result, got %+v", result)
+	}
+}
+
+func TestClient_Restart(t *testing.T) {
+	client := startClient(t, mcp.WithMaxRestarts(1))
+	pid := client.ServerInfo().Instructions
+
+	if _, err := client.CallTool(context.Background(), "crash", nil); !errors.Is(err, mcp.ErrConnectionClosed) {
+		t.Fatalf("expected ErrConnectionClosed, got %v", err)
+	}
+	result, err := client.CallTool(context.Background(), "echo", json.RawMessage(`{"text":"back"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Content[0].Text != "back" || client.Restarts() != 1 || client.ServerInfo().Instructions == pid {
+		t.Errorf("expected a new server, got %+v after %d restarts", client.ServerInfo(), client.Restarts())
+	}
+
+	// the restart budget is spent
+	client.CallTool(context.Background(), "crash", nil)
+	if _, err := client.CallTool(context.Background(), "echo", json.RawMessage(`{"text":"gone"}`)); !errors.Is(err, mcp.ErrConnectionClosed) {
+		t.Errorf("expected ErrConnectionClosed, got %v", err)
+	}
+}
+
+func TestClient_RestartWindow(t *testing.T) {
+	client := startClient(t, mcp.WithMaxRestarts(1), mcp.WithRestartWindow(100*time.Millisecond))
+	for i := range 2 {
+		// restarts older than the window no longer count
+		time.Sleep(200 * time.Millisecond)
+		client.CallTool(context.Background(), "crash", nil)
+		if _, err := client.CallTool(context.Background(), "echo", json.RawMessage(`{"text":"back"}`)); err != nil {
+			t.Fatalf("restart %d: %v", i+1, err)
+		}
+	}
+	if client.Restarts() != 2 {
+		t.Errorf("expected 2 restarts, got %d", client.Restarts())
+	}
+}
+
+// silentTransport answers the first initialize, later connections get no answers
+type silentTransport struct {
+	mu       sync.Mutex
+	messages chan *mcp.Message
+	connects int
+}
+
+func (t *silentTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connects++
+	t.messages = make(chan *mcp.Message, 10)
+	return nil
+}
+
+func (t *silentTransport) Send(ctx context.Context, message *mcp.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.connects == 1 && message.Method == "initialize" {
+		t.messages <- &mcp.Message{JSONRPC: "2.0", ID: message.ID, Result: json.RawMessage(`{"protocolVersion":"` + mcp.ProtocolVersion + `","capabilities":{},"serverInfo":{"name":"silent","version":"1"}}`)}
+	}
+	return nil
+}
+
+func (t *silentTransport) Receive() (*mcp.Message, error) {
+	t.mu.Lock()
+	messages := t.messages
+	t.mu.Unlock()
+	message, ok := <-messages
+	if !ok {
+		return nil, mcp.ErrConnectionClosed
+	}
+	return message, nil
+}
+
+// drop loses the connection
+func (t *silentTransport) drop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	close(t.messages)
+}
+
+func (t *silentTransport) connected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connects
+}
+
+func (t *silentTransport) Close() error {
+	return nil
+}
+
+func TestClient_ReconnectTimeout(t *testing.T) {
+	transport := &silentTransport{}
+	client := mcp.NewClient(transport, mcp.WithReconnectTimeout(100*time.Millisecond))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	transport.drop()
+	for deadline := time.Now().Add(5 * time.Second); transport.connected() < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the client did not reconnect")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	if _, err := client.ListTools(ctx); err == nil || ctx.Err() != nil {
+		t.Errorf("expected the reconnect to fail before the call's own deadline, got %v after %v", err, time.Since(started))
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	client := startClient(t)
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListTools(context.Background()); !errors.Is(err, mcp.ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+
+	var rpcErr *mcp.Error
+	client = startClient(t)
+	if _, err := client.CallTool(context.Background(), "missing", nil); !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeInvalidParams {
+		t.Errorf("expected an invalid params error, got %v", err)
+	}
+}
+
+func TestClient_Resources(t *testing.T) {
+	client := startClient(t)
+	resources, err := client.ListResources(context.Background())
+	if err != nil || len(resources) != 2 || resources[0].URI != "file:///notes.txt" {
+		t.Fatalf("unexpected resources %+v %v", resources, err)
+	}
+
+	blocks := []anthropic.ContentBlockParamUnion{}
+	for _, resource := range resources {
+		read, err := client.ReadResource(context.Background(), resource.URI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, mcp.ResourceBlocks(read.Contents...)...)
+	}
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[{"source":{"data":"some notes","media_type":"text/plain","type":"text"},"title":"file:///notes.txt","type":"document"},{"source":{"data":"iVBORw0KGgo=","media_type":"image/png","type":"base64"},"type":"image"}]` {
+		t.Errorf("unexpected blocks %s", data)
+	}
+
+	var rpcErr *mcp.Error
+	if _, err := client.ReadResource(context.Background(), "file:///missing"); !errors.As(err, &rpcErr) || rpcErr.Code != -32002 {
+		t.Errorf("expected a resource not found error, got %v", err)
+	}
+}
+
+func TestClient_Prompts(t *testing.T) {
+	client := startClient(t)
+	prompts, err := client.ListPrompts(context.Background())
+	if err != nil || len(prompts) != 1 || prompts[0].Name != "review" || !prompts[0].Arguments[0].Required {
+		t.Fatalf("unexpected prompts %+v %v", prompts, err)
+	}
+	prompt, err := client.GetPrompt(context.Background(), "review", map[string]string{"code": "package main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "looks good"})
+	agent, err := agents.NewAgent(context.Background(), server.Client(), agents.WithMessages(prompt.MessageParams()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "go on"); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.Requests()[0].Messages
+	if len(messages) != 3 {
+		t.Fatalf("expected the prompt and the invocation, got %d messages", len(messages))
+	}
+	if string(messages[0]) != `{"content":[{"text":"Review this code:","type":"text"},{"source":{"data":"package main","media_type":"text/plain","type":"text"},"title":"file:///main.go","type":"document"}],"role":"user"}` {
+		t.Errorf("unexpected first message %s", messages[0])
+	}
+	if !strings.Contains(string(messages[1]), `"Sure."`) {
+		t.Errorf("unexpected second message %s", messages[1])
+	}
+}
+
+func TestClient_Sampling(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "hi!"})
+	approved := []mcp.CreateMessageParams{}
+	reject := false
+	client := startClient(t, mcp.WithSampling(server.Client(), func(ctx context.Context, params *mcp.CreateMessageParams) error {
+		if reject {
+			return errors.New("not now")
+		}
+		approved = append(approved, *params)
+		params.MaxTokens = 50
+		return nil
+	}))
+
+	result, err := client.CallTool(context.Background(), "sample", nil)
+	if err != nil || result.IsError {
+		t.Fatalf("unexpected result %+v %v", result, err)
+	}
+	var sampled mcp.CreateMessageResult
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &sampled); err != nil {
+		t.Fatal(err)
+	}
+	if sampled.Content.Text != "hi!" || sampled.Role != "assistant" || sampled.StopReason != "endTurn" || sampled.Model == "" {
+		t.Errorf("unexpected sampling result %+v", sampled)
+	}
+	if len(approved) != 1 || approved[0].SystemPrompt != "Be brief" || approved[0].ModelPreferences.Hints[0].Name != "claude-3-haiku" {
+		t.Errorf("unexpected approved requests %+v", approved)
+	}
+	request := server.Requests()[0]
+	if request.MaxTokens != 50 || !strings.Contains(string(request.Messages[0]), "Say hi") {
+		t.Errorf("unexpected model request %+v", request)
+	}
+
+	reject = true
+	result, err = client.CallTool(context.Background(), "sample", nil)
+	if err != nil || !result.IsError || !strings.Contains(result.Content[0].Text, "sampling request rejected: not now") {
+		t.Errorf("expected a rejected sampling request, got %+v %v", result, err)
+	}
+
+	// without an approver the model is never used
+	client = startClient(t, mcp.WithSampling(server.Client(), nil))
+	result, err = client.CallTool(context.Background(), "sample", nil)
+	if err != nil || !result.IsError || !strings.Contains(result.Content[0].Text, "sampling request rejected: no approver") {
+		t.Errorf("expected a rejected sampling request, got %+v %v", result, err)
+	}
+	if len(server.Requests()) != 1 {
+		t.Errorf("expected no model request, got %d", len(server.Requests()))
+	}
+}
+
+// memoryTransport answers initialize and tools/list, the server announces a tool change once initialized
+type memoryTransport struct {
+	messages chan *mcp.Message
+}
+
+func (t *memoryTransport) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (t *memoryTransport) Send(ctx context.Context, message *mcp.Message) error {
+	switch message.Method {
+	case "initialize":
+		t.messages <- &mcp.Message{JSONRPC: "2.0", ID: message.ID, Result: json.RawMessage(`{"protocolVersion":"` + mcp.ProtocolVersion + `","capabilities":{},"serverInfo":{"name":"memory","version":"1"}}`)}
+	case "notifications/initialized":
+		t.messages <- &mcp.Message{JSONRPC: "2.0", Method: "notifications/tools/list_changed"}
+	case "tools/list":
+		t.messages <- &mcp.Message{JSONRPC: "2.0", ID: message.ID, Result: json.RawMessage(`{"tools":[{"name":"echo","inputSchema":{"type":"object"}}]}`)}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Receive() (*mcp.Message, error) {
+	message, ok := <-t.messages
+	if !ok {
+		return nil, mcp.ErrConnectionClosed
+	}
+	return message, nil
+}
+
+func (t *memoryTransport) Close() error {
+	return nil
+}
+
+func TestClient_NotificationHandlerCalls(t *testing.T) {
+	listed := make(chan error, 1)
+	var client *mcp.Client
+	client = mcp.NewClient(&memoryTransport{messages: make(chan *mcp.Message, 10)}, mcp.WithNotificationHandler("notifications/tools/list_changed", func(ctx context.Context, params json.RawMessage) {
+		// the handler calls the server, which needs the read loop to go on
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		_, err := client.ListTools(ctx)
+		listed <- err
+	}))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	select {
+	case err := <-listed:
+		if err != nil {
+			t.Errorf("unexpected error listing the tools from the handler: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the notification handler was not called")
+	}
+}
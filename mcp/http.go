@@ -0,0 +1,474 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultReconnectDelay is the pause before a dropped event stream is opened again
+const DefaultReconnectDelay = time.Second
+
+type httpOptions struct {
+	client         *http.Client
+	header         http.Header
+	reconnectDelay time.Duration
+}
+
+type HTTPOption func(o *httpOptions)
+
+// WithHTTPClient replaces http.DefaultClient, e.g. for a transport that adds OAuth tokens
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(o *httpOptions) {
+		o.client = client
+	}
+}
+
+// WithHeader adds a header to every request, e.g. "Authorization"
+func WithHeader(key, value string) HTTPOption {
+	return func(o *httpOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// WithReconnectDelay replaces DefaultReconnectDelay
+func WithReconnectDelay(delay time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.reconnectDelay = delay
+	}
+}
+
+func newHTTPOptions(options []HTTPOption) httpOptions {
+	o := httpOptions{client: http.DefaultClient, header: http.Header{}, reconnectDelay: DefaultReconnectDelay}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+func (o httpOptions) newRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range o.header {
+		req.Header[key] = append([]string{}, values...)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// statusError describes an unexpected response
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("mcp: unexpected response %s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+// connection is the state of one connection of an HTTP transport
+type connection struct {
+	incoming chan *Message
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	// ctx ends the background streams of the connection
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newConnection() *connection {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &connection{incoming: make(chan *Message), done: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+func (c *connection) deliver(message *Message) bool {
+	select {
+	case c.incoming <- message:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// deliverData parses and delivers a JSON-RPC message, invalid data is skipped
+func (c *connection) deliverData(data []byte) bool {
+	var message Message
+	if json.Unmarshal(data, &message) != nil {
+		return true
+	}
+	return c.deliver(&message)
+}
+
+func (c *connection) close(err error) {
+	c.once.Do(func() {
+		c.err = err
+		c.cancel()
+		close(c.done)
+	})
+}
+
+func (c *connection) receive() (*Message, error) {
+	select {
+	case message := <-c.incoming:
+		return message, nil
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// StreamableHTTPTransport implements the Streamable HTTP transport: messages are POSTed to one endpoint,
+// answers come back as JSON or as an event stream, and a GET stream carries the messages the server starts
+type StreamableHTTPTransport struct {
+	endpoint string
+	options  httpOptions
+
+	mu              sync.Mutex
+	conn            *connection
+	sessionID       string
+	protocolVersion string
+	lastEventID     string
+}
+
+func NewStreamableHTTPTransport(endpoint string, options ...HTTPOption) *StreamableHTTPTransport {
+	return &StreamableHTTPTransport{endpoint: endpoint, options: newHTTPOptions(options)}
+}
+
+// Connect starts a new session, the session ID is assigned by the server on initialize
+func (t *StreamableHTTPTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn = newConnection()
+	t.sessionID, t.protocolVersion, t.lastEventID = "", "", ""
+	return nil
+}
+
+// SessionID is the ID of the current session, empty before initialize
+func (t *StreamableHTTPTransport) SessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// current returns the connection and the headers of its session
+func (t *StreamableHTTPTransport) current() (*connection, http.Header, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil, nil, ErrConnectionClosed
+	}
+	header := http.Header{}
+	if t.sessionID != "" {
+		header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		header.Set("Mcp-Protocol-Version", t.protocolVersion)
+	}
+	return t.conn, header, nil
+}
+
+func (t *StreamableHTTPTransport) Send(ctx context.Context, message *Message) error {
+	conn, session, err := t.current()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := t.options.newRequest(ctx, http.MethodPost, t.endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for key, values := range session {
+		req.Header[key] = values
+	}
+	resp, err := t.options.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		if t.conn == conn && t.sessionID == "" {
+			t.sessionID = id
+		}
+		t.mu.Unlock()
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && session.Get("Mcp-Session-Id") != "":
+		resp.Body.Close()
+		conn.close(ErrSessionExpired)
+		return ErrSessionExpired
+	case resp.StatusCode >= 300:
+		defer resp.Body.Close()
+		return statusError(resp)
+	case resp.StatusCode == http.StatusAccepted || resp.ContentLength == 0:
+		resp.Body.Close()
+		if message.Method == "notifications/initialized" {
+			go t.listen(conn)
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		// the answer may take long, it is read in the background while ctx lasts
+		go func() {
+			defer resp.Body.Close()
+			readEvents(resp.Body, func(event sseEvent) bool {
+				return t.deliver(conn, []byte(event.Data), message.Method)
+			})
+		}()
+		return nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	t.deliver(conn, data, message.Method)
+	return nil
+}
+
+// deliver passes a message on and remembers the protocol version negotiated by initialize
+func (t *StreamableHTTPTransport) deliver(conn *connection, data []byte, method string) bool {
+	if method == "initialize" {
+		var response struct {
+			Result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			} `json:"result"`
+		}
+		if json.Unmarshal(data, &response) == nil && response.Result.ProtocolVersion != "" {
+			t.mu.Lock()
+			if t.conn == conn {
+				t.protocolVersion = response.Result.ProtocolVersion
+			}
+			t.mu.Unlock()
+		}
+	}
+	return conn.deliverData(data)
+}
+
+// listen keeps the GET stream of the session open, resuming after the last event when it drops
+func (t *StreamableHTTPTransport) listen(conn *connection) {
+	for {
+		_, session, err := t.current()
+		if err != nil {
+			return
+		}
+		req, err := t.options.newRequest(conn.ctx, http.MethodGet, t.endpoint, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		for key, values := range session {
+			req.Header[key] = values
+		}
+		t.mu.Lock()
+		if t.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", t.lastEventID)
+		}
+		t.mu.Unlock()
+
+		resp, err := t.options.client.Do(req)
+		switch {
+		case err != nil:
+		case resp.StatusCode == http.StatusMethodNotAllowed:
+			// the server does not offer a stream
+			resp.Body.Close()
+			return
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			conn.close(ErrSessionExpired)
+			return
+		case resp.StatusCode != http.StatusOK:
+			resp.Body.Close()
+		default:
+			readEvents(resp.Body, func(event sseEvent) bool {
+				if event.ID != "" {
+					t.mu.Lock()
+					t.lastEventID = event.ID
+					t.mu.Unlock()
+				}
+				return conn.deliverData([]byte(event.Data))
+			})
+			resp.Body.Close()
+		}
+
+		select {
+		case <-conn.ctx.Done():
+			return
+		case <-time.After(t.options.reconnectDelay):
+		}
+	}
+}
+
+func (t *StreamableHTTPTransport) Receive() (*Message, error) {
+	conn, _, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.receive()
+}
+
+// Close ends the session on the server
+func (t *StreamableHTTPTransport) Close() error {
+	conn, session, err := t.current()
+	if err != nil {
+		return nil
+	}
+	t.mu.Lock()
+	t.conn = nil
+	t.mu.Unlock()
+	conn.close(ErrConnectionClosed)
+
+	if session.Get("Mcp-Session-Id") == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := t.options.newRequest(ctx, http.MethodDelete, t.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range session {
+		req.Header[key] = values
+	}
+	resp, err := t.options.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SSETransport implements the legacy HTTP+SSE transport: the server sends every message over one event stream
+// and names the endpoint the client POSTs its messages to in a first "endpoint" event
+type SSETransport struct {
+	url     string
+	options httpOptions
+
+	mu       sync.Mutex
+	conn     *connection
+	endpoint string
+}
+
+func NewSSETransport(url string, options ...HTTPOption) *SSETransport {
+	return &SSETransport{url: url, options: newHTTPOptions(options)}
+}
+
+// Connect opens the event stream and waits for the endpoint event, the stream outlives ctx until Close
+func (t *SSETransport) Connect(ctx context.Context) error {
+	base, err := url.Parse(t.url)
+	if err != nil {
+		return err
+	}
+	conn := newConnection()
+	req, err := t.options.newRequest(conn.ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.options.client.Do(req)
+	if err != nil {
+		conn.close(err)
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		conn.close(ErrConnectionClosed)
+		return statusError(resp)
+	}
+
+	endpoints := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		readEvents(resp.Body, func(event sseEvent) bool {
+			if event.Event == "endpoint" {
+				if endpoint, err := base.Parse(event.Data); err == nil {
+					// only the first endpoint is used, the reader must not wait for Connect
+					select {
+					case endpoints <- endpoint.String():
+					default:
+					}
+				}
+				return true
+			}
+			return conn.deliverData([]byte(event.Data))
+		})
+		conn.close(fmt.Errorf("%w: event stream ended", ErrConnectionClosed))
+	}()
+
+	select {
+	case endpoint := <-endpoints:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.conn, t.endpoint = conn, endpoint
+		return nil
+	case <-conn.done:
+		return conn.err
+	case <-ctx.Done():
+		conn.close(ctx.Err())
+		return ctx.Err()
+	}
+}
+
+func (t *SSETransport) Send(ctx context.Context, message *Message) error {
+	t.mu.Lock()
+	conn, endpoint := t.conn, t.endpoint
+	t.mu.Unlock()
+	if conn == nil {
+		return ErrConnectionClosed
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := t.options.newRequest(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	resp, err := t.options.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return statusError(resp)
+	}
+	return nil
+}
+
+func (t *SSETransport) Receive() (*Message, error) {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+	if conn == nil {
+		return nil, ErrConnectionClosed
+	}
+	return conn.receive()
+}
+
+func (t *SSETransport) Close() error {
+	t.mu.Lock()
+	conn := t.conn
+	t.conn = nil
+	t.mu.Unlock()
+	if conn != nil {
+		conn.close(ErrConnectionClosed)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/mcp"
+)
+
+// handle answers the requests of the HTTP test servers
+func handle(ctx context.Context, request mcp.Message) (any, error) {
+	switch request.Method {
+	case "initialize":
+		return mcp.InitializeResult{ProtocolVersion: "2025-03-26", ServerInfo: mcp.Implementation{Name: "http-server", Version: "1.0.0"}}, nil
+	case "tools/list":
+		return mcp.ListToolsResult{Tools: []mcp.Tool{{Name: "echo", InputSchema: json.RawMessage(`{"type":"object"}`)}}}, nil
+	case "tools/call":
+		var params mcp.CallToolParams
+		json.Unmarshal(request.Params, &params)
+		if params.Name == "slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return mcp.CallToolResult{Content: []mcp.Content{mcp.TextContent(string(params.Arguments))}}, nil
+	}
+	return nil, &mcp.Error{Code: mcp.CodeMethodNotFound, Message: request.Method}
+}
+
+func reply(request mcp.Message, result any, err error) []byte {
+	response := mcp.Message{JSONRPC: "2.0", ID: request.ID}
+	if err != nil {
+		response.Error = &mcp.Error{Code: mcp.CodeInternalError, Message: err.Error()}
+	} else {
+		response.Result, _ = json.Marshal(result)
+	}
+	data, _ := json.Marshal(response)
+	return data
+}
+
+// streamableServer is a minimal Streamable HTTP server
+type streamableServer struct {
+	mu          sync.Mutex
+	sessions    int
+	session     string
+	headers     []http.Header
+	cancelled   []json.RawMessage
+	lastEventID []string
+	deleted     []string
+}
+
+func (s *streamableServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = "expired"
+}
+
+func (s *streamableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.headers = append(s.headers, r.Header.Clone())
+	session := s.session
+	s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if id := r.Header.Get("Mcp-Session-Id"); id != "" && id != session {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		s.lastEventID = append(s.lastEventID, r.Header.Get("Last-Event-ID"))
+		first := len(s.lastEventID) == 1
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 7\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/tools/list_changed\"}\n\n")
+		w.(http.Flusher).Flush()
+		if !first {
+			// only the first stream drops
+			<-r.Context().Done()
+		}
+		return
+	case http.MethodDelete:
+		s.mu.Lock()
+		s.deleted = append(s.deleted, r.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+		return
+	}
+
+	var request mcp.Message
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !request.IsRequest() {
+		if request.Method == "notifications/cancelled" {
+			s.mu.Lock()
+			s.cancelled = append(s.cancelled, request.Params)
+			s.mu.Unlock()
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if request.Method == "initialize" {
+		s.mu.Lock()
+		s.sessions++
+		s.session = fmt.Sprintf("session-%d", s.sessions)
+		w.Header().Set("Mcp-Session-Id", s.session)
+		s.mu.Unlock()
+	}
+	result, err := handle(r.Context(), request)
+	if request.Method == "tools/list" || request.Method == "tools/call" {
+		// answer as an event stream with a notification first
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\",\"params\":{}}\n\n")
+		fmt.Fprintf(w, "data: %s\n\n", reply(request, result, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply(request, result, err))
+}
+
+func (s *streamableServer) snapshot() (headers []http.Header, cancelled []json.RawMessage, lastEventID []string, deleted []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(headers, s.headers...), append(cancelled, s.cancelled...), append(lastEventID, s.lastEventID...), append(deleted, s.deleted...)
+}
+
+func TestStreamableHTTPTransport(t *testing.T) {
+	server := &streamableServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	changed := make(chan struct{}, 10)
+	transport := mcp.NewStreamableHTTPTransport(httpServer.URL,
+		mcp.WithHeader("Authorization", "Bearer secret"),
+		mcp.WithReconnectDelay(10*time.Millisecond),
+	)
+	client := mcp.NewClient(transport, mcp.WithNotificationHandler("notifications/tools/list_changed", func(ctx context.Context, params json.RawMessage) {
+		changed <- struct{}{}
+	}))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if transport.SessionID() != "session-1" || client.ServerInfo().ServerInfo.Name != "http-server" {
+		t.Errorf("unexpected session %q %+v", transport.SessionID(), client.ServerInfo())
+	}
+
+	adapted, err := client.Tools(context.Background())
+	if err != nil || len(adapted) != 1 {
+		t.Fatalf("unexpected tools %v %v", adapted, err)
+	}
+	result, err := adapted[0].Invoke(context.Background(), json.RawMessage(`{"text":"hi"}`))
+	if err != nil || result.Text() != `{"text":"hi"}` {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+
+	// the GET stream delivers notifications and resumes after the last event when it drops
+	for range 2 {
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification on the GET stream")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "slow", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	server.expire()
+	if _, err := client.ListTools(context.Background()); !errors.Is(err, mcp.ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired, got %v", err)
+	}
+	if _, err := client.ListTools(context.Background()); err != nil {
+		t.Fatalf("expected a new session, got %v", err)
+	}
+	if transport.SessionID() != "session-2" || client.Restarts() != 1 {
+		t.Errorf("unexpected session %q after %d restarts", transport.SessionID(), client.Restarts())
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, cancelled, lastEventID, deleted := server.snapshot()
+	if len(cancelled) != 1 || string(cancelled[0]) != `{"reason":"context deadline exceeded","requestId":4}` {
+		t.Errorf("unexpected cancellations %s", cancelled)
+	}
+	if len(lastEventID) < 2 || lastEventID[0] != "" || lastEventID[1] != "7" {
+		t.Errorf("unexpected Last-Event-ID headers %v", lastEventID)
+	}
+	if len(deleted) != 1 || deleted[0] != "session-2" {
+		t.Errorf("unexpected deleted sessions %v", deleted)
+	}
+	if version := headers[len(headers)-1].Get("Mcp-Protocol-Version"); version != "2025-03-26" {
+		t.Errorf("expected the negotiated version, got %q", version)
+	}
+}
+
+func TestSSETransport(t *testing.T) {
+	outgoing := make(chan []byte, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=abc\n\n")
+		w.(http.Flusher).Flush()
+		// repeated endpoint events are ignored, the first one is used
+		for range 3 {
+			fmt.Fprint(w, "event: endpoint\ndata: /messages?session=other\n\n")
+		}
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case data := <-outgoing:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("POST /messages", func(w http.ResponseWriter, r *http.Request) {
+		var request mcp.Message
+		if r.URL.Query().Get("session") != "abc" || r.Header.Get("X-Team") != "agents" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if request.IsRequest() {
+			result, err := handle(r.Context(), request)
+			outgoing <- reply(request, result, err)
+		}
+	})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	client := mcp.NewClient(mcp.NewSSETransport(httpServer.URL+"/sse", mcp.WithHeader("X-Team", "agents")))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	adapted, err := client.Tools(ctx)
+	if err != nil || len(adapted) != 1 || adapted[0].Spec().Name != "echo" {
+		t.Fatalf("unexpected tools %v %v", adapted, err)
+	}
+	result, err := adapted[0].Invoke(context.Background(), json.RawMessage(`{"text":"over sse"}`))
+	if err != nil || result.Text() != `{"text":"over sse"}` {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+}
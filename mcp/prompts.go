@@ -0,0 +1,29 @@
+package mcp
+
+import (
+	"context"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// ListPrompts returns every prompt of the server, following the pagination cursors
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	return listAll(ctx, c, "prompts/list", func(result ListPromptsResult) ([]Prompt, string) {
+		return result.Prompts, result.NextCursor
+	})
+}
+
+// GetPrompt fills a prompt template with arguments
+func (c *Client) GetPrompt(ctx context.Context, name string, arguments map[string]string) (*GetPromptResult, error) {
+	var result GetPromptResult
+	if err := c.Call(ctx, "prompts/get", GetPromptParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MessageParams converts the prompt into messages, e.g. to seed a conversation with agents.WithMessages
+// Consecutive messages of a role are merged into one message
+func (r *GetPromptResult) MessageParams() []anthropic.MessageParam {
+	return messageParams(r.Messages)
+}
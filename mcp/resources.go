@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// ListResources returns every resource of the server, following the pagination cursors
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	return listAll(ctx, c, "resources/list", func(result ListResourcesResult) ([]Resource, string) {
+		return result.Resources, result.NextCursor
+	})
+}
+
+// ReadResource returns the contents of a resource, ResourceBlocks turns them into content blocks for a message
+func (c *Client) ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error) {
+	var result ReadResourceResult
+	if err := c.Call(ctx, "resources/read", ReadResourceParams{URI: uri}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResourceBlocks converts resource contents into blocks to attach to a user message
+// Text and PDF contents become documents titled with their URI, images image blocks,
+// other binary contents are described in a text block
+func ResourceBlocks(contents ...ResourceContents) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(contents))
+	for _, resource := range contents {
+		blocks = append(blocks, resourceBlock(resource))
+	}
+	return blocks
+}
+
+func resourceBlock(resource ResourceContents) anthropic.ContentBlockParamUnion {
+	if document := resourceDocument(resource); document != nil {
+		return anthropic.ContentBlockParamUnion{OfDocument: document}
+	}
+	if resource.Blob != "" && isImage(resource.MimeType) {
+		return anthropic.ContentBlockParamUnion{OfImage: imageBlock(resource.Blob, resource.MimeType)}
+	}
+	return anthropic.NewTextBlock(omittedResource(resource))
+}
+
+// resourceDocument returns nil for contents that cannot be a document
+func resourceDocument(resource ResourceContents) *anthropic.DocumentBlockParam {
+	document := &anthropic.DocumentBlockParam{Title: anthropic.String(resource.URI)}
+	switch {
+	case resource.Blob == "" && (resource.MimeType == "" || isText(resource.MimeType)):
+		document.Source.OfText = &anthropic.PlainTextSourceParam{Data: resource.Text}
+	case resource.MimeType == "application/pdf":
+		document.Source.OfBase64 = &anthropic.Base64PDFSourceParam{Data: resource.Blob}
+	default:
+		return nil
+	}
+	return document
+}
+
+func omittedResource(resource ResourceContents) string {
+	return fmt.Sprintf("[resource %s (%s) omitted]", resource.URI, resource.MimeType)
+}
+
+func imageBlock(data, mimeType string) *anthropic.ImageBlockParam {
+	return &anthropic.ImageBlockParam{
+		Source: anthropic.ImageBlockParamSourceUnion{OfBase64: &anthropic.Base64ImageSourceParam{
+			Data:      data,
+			MediaType: anthropic.Base64ImageSourceMediaType(mimeType),
+		}},
+	}
+}
+
+// isImage reports whether the API takes images of mimeType
+func isImage(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// contentBlock converts the content of a prompt or sampling message
+func contentBlock(content Content) anthropic.ContentBlockParamUnion {
+	switch content.Type {
+	case "text":
+		return anthropic.NewTextBlock(content.Text)
+	case "image":
+		return anthropic.ContentBlockParamUnion{OfImage: imageBlock(content.Data, content.MimeType)}
+	case "resource":
+		if content.Resource != nil {
+			return resourceBlock(*content.Resource)
+		}
+	case "resource_link":
+		return anthropic.NewTextBlock(fmt.Sprintf("[resource link %s: %s]", content.Name, content.URI))
+	}
+	return anthropic.NewTextBlock(fmt.Sprintf("[%s content omitted]", content.Type))
+}
+
+// messageParams converts prompt or sampling messages, consecutive messages of a role are merged
+func messageParams(messages []PromptMessage) []anthropic.MessageParam {
+	params := []anthropic.MessageParam{}
+	for _, message := range messages {
+		role := anthropic.MessageParamRoleUser
+		if strings.EqualFold(message.Role, "assistant") {
+			role = anthropic.MessageParamRoleAssistant
+		}
+		block := contentBlock(message.Content)
+		if last := len(params) - 1; last >= 0 && params[last].Role == role {
+			params[last].Content = append(params[last].Content, block)
+			continue
+		}
+		params = append(params, anthropic.MessageParam{Role: role, Content: []anthropic.ContentBlockParamUnion{block}})
+	}
+	return params
+}
@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/models"
+)
+
+// SamplingApprover decides whether a server may use the model, e.g. by asking the user
+// It may change params, an error rejects the request
+type SamplingApprover func(ctx context.Context, params *CreateMessageParams) error
+
+// WithSampling answers the server's sampling/createMessage requests with client,
+// so that servers use the model and the credentials of the client
+// approve is called before every request, nil rejects every request
+// so that servers never spend tokens without a decision of the caller
+// The model preferences of the server are ignored, client's model answers
+func WithSampling(client *models.AnthropicClient, approve SamplingApprover) ClientOption {
+	return func(c *Client) {
+		c.capabilities["sampling"] = map[string]any{}
+		c.requests["sampling/createMessage"] = func(ctx context.Context, raw json.RawMessage) (any, error) {
+			var params CreateMessageParams
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+			}
+			if approve == nil {
+				return nil, &Error{Code: CodeRequestRejected, Message: "sampling request rejected: no approver"}
+			}
+			if err := approve(ctx, &params); err != nil {
+				return nil, &Error{Code: CodeRequestRejected, Message: fmt.Sprintf("sampling request rejected: %v", err)}
+			}
+			return createMessage(ctx, client, params)
+		}
+	}
+}
+
+func createMessage(ctx context.Context, client *models.AnthropicClient, params CreateMessageParams) (*CreateMessageResult, error) {
+	options := []models.StreamOption{
+		models.WithSystem(params.SystemPrompt),
+		models.WithCallMaxTokens(params.MaxTokens),
+	}
+	if params.Temperature != nil {
+		options = append(options, models.WithTemperature(*params.Temperature))
+	}
+	if len(params.StopSequences) > 0 {
+		options = append(options, models.WithStopSequences(params.StopSequences...))
+	}
+	response, err := client.StreamMessages(ctx, messageParams(params.Messages), nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Wait(); err != nil {
+		return nil, err
+	}
+	return &CreateMessageResult{
+		Role:       "assistant",
+		Content:    TextContent(response.Content),
+		Model:      response.Model,
+		StopReason: samplingStopReason(response.StopReason),
+	}, nil
+}
+
+// samplingStopReason converts the API's stop reasons into the ones of MCP
+func samplingStopReason(stopReason string) string {
+	switch anthropic.StopReason(stopReason) {
+	case anthropic.StopReasonEndTurn:
+		return "endTurn"
+	case anthropic.StopReasonMaxTokens:
+		return "maxTokens"
+	case anthropic.StopReasonStopSequence:
+		return "stopSequence"
+	}
+	return stopReason
+}
@@ -0,0 +1,329 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const (
+	// DefaultSessionIdleTimeout is how long an HTTP session is kept without requests
+	DefaultSessionIdleTimeout = 30 * time.Minute
+	// DefaultMaxSessions limits the HTTP sessions held at once
+	DefaultMaxSessions = 1000
+)
+
+// Server serves the tools of a registry to MCP clients over stdio (ServeStdio) or Streamable HTTP (Handler)
+type Server struct {
+	tools          *tools.Registry
+	info           Implementation
+	instructions   string
+	allowedOrigins []string
+	idleTimeout    time.Duration
+	maxSessions    int
+}
+
+type ServerOption func(s *Server)
+
+// WithServerInfo names the server in the initialize result
+func WithServerInfo(name, version string) ServerOption {
+	return func(s *Server) {
+		s.info = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithInstructions tells clients how to use the server
+func WithInstructions(instructions string) ServerOption {
+	return func(s *Server) {
+		s.instructions = instructions
+	}
+}
+
+// WithAllowedOrigins lets browsers on the given origins, e.g. "https://app.example.com", call the HTTP handler
+// Requests with another Origin than the server's own are rejected to prevent DNS rebinding
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.allowedOrigins = append(s.allowedOrigins, origins...)
+	}
+}
+
+// WithSessionIdleTimeout drops HTTP sessions without requests for the given duration
+func WithSessionIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithMaxSessions limits the HTTP sessions held at once, initialize fails once they are all in use
+func WithMaxSessions(n int) ServerOption {
+	return func(s *Server) {
+		s.maxSessions = n
+	}
+}
+
+// NewServer serves the tools of registry, tools registered later are listed too
+func NewServer(registry *tools.Registry, options ...ServerOption) *Server {
+	s := &Server{
+		tools:       registry,
+		info:        Implementation{Name: "go-strands-agents", Version: "0.1.0"},
+		idleTimeout: DefaultSessionIdleTimeout,
+		maxSessions: DefaultMaxSessions,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServeStdio serves one client over newline-delimited JSON until r ends, e.g. os.Stdin and os.Stdout
+// Requests run concurrently, the running ones are cancelled when r ends or ctx is done
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session := newServerSession("")
+	encoder := json.NewEncoder(w)
+	var writeMu sync.Mutex
+	send := func(message *Message) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return encoder.Encode(message)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		message := &Message{}
+		if err := json.Unmarshal(scanner.Bytes(), message); err != nil {
+			send(parseError(err))
+			continue
+		}
+		// notifications are handled and requests registered in order, so that a cancellation
+		// right after its request finds it
+		answer := s.start(ctx, session, message)
+		if answer == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if response := answer(send); response != nil {
+				send(response)
+			}
+		}()
+	}
+	return scanner.Err()
+}
+
+// serverSession tracks the running requests of one client so that they can be cancelled
+type serverSession struct {
+	id      string
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	// lastUsed is guarded by the mutex of the HTTP handler
+	lastUsed time.Time
+}
+
+func newServerSession(id string) *serverSession {
+	return &serverSession{id: id, running: map[string]context.CancelFunc{}}
+}
+
+func (s *serverSession) start(id json.RawMessage, cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[string(id)] = cancel
+}
+
+// finish reports false when the request was cancelled by the client, it must not be answered then
+func (s *serverSession) finish(id json.RawMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.running[string(id)]
+	delete(s.running, string(id))
+	return ok
+}
+
+func (s *serverSession) cancel(id json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.running[string(id)]; ok {
+		cancel()
+		delete(s.running, string(id))
+	}
+}
+
+// busy reports running requests, a session is not idle while it has some
+func (s *serverSession) busy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.running) > 0
+}
+
+func (s *serverSession) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, cancel := range s.running {
+		cancel()
+		delete(s.running, id)
+	}
+}
+
+// handle answers a request, send carries the notifications about it
+// It returns nil for notifications, responses and cancelled requests
+func (s *Server) handle(ctx context.Context, session *serverSession, message *Message, send func(*Message) error) *Message {
+	if answer := s.start(ctx, session, message); answer != nil {
+		return answer(send)
+	}
+	return nil
+}
+
+// start handles notifications and registers requests in the session, answer then runs the request
+// It returns nil for notifications and responses
+func (s *Server) start(ctx context.Context, session *serverSession, message *Message) (answer func(send func(*Message) error) *Message) {
+	if message.IsNotification() {
+		if message.Method == "notifications/cancelled" {
+			var params CancelledParams
+			if json.Unmarshal(message.Params, &params) == nil {
+				session.cancel(params.RequestID)
+			}
+		}
+		return nil
+	}
+	if !message.IsRequest() {
+		// the server sends no requests
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	session.start(message.ID, cancel)
+	return func(send func(*Message) error) *Message {
+		defer cancel()
+		return s.answer(ctx, session, message, send)
+	}
+}
+
+func (s *Server) answer(ctx context.Context, session *serverSession, message *Message, send func(*Message) error) *Message {
+	result, err := s.respond(ctx, message, send)
+	if !session.finish(message.ID) {
+		return nil
+	}
+	response := &Message{JSONRPC: jsonrpcVersion, ID: message.ID}
+	if err == nil {
+		response.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		response.Result, response.Error = nil, rpcErr
+	}
+	return response
+}
+
+func (s *Server) respond(ctx context.Context, message *Message, send func(*Message) error) (any, error) {
+	switch message.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		version := params.ProtocolVersion
+		if !slices.Contains(supportedVersions, version) {
+			version = ProtocolVersion
+		}
+		return InitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]json.RawMessage{"tools": json.RawMessage(`{}`)},
+			ServerInfo:      s.info,
+			Instructions:    s.instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return s.listTools()
+	case "tools/call":
+		var params CallToolParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(ctx, params, send)
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + message.Method}
+}
+
+func (s *Server) listTools() (*ListToolsResult, error) {
+	result := &ListToolsResult{Tools: []Tool{}}
+	for _, tool := range s.tools.List() {
+		spec := tool.Spec()
+		schema := spec.InputSchema
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return nil, fmt.Errorf("mcp: input schema of %s: %w", spec.Name, err)
+		}
+		result.Tools = append(result.Tools, Tool{Name: spec.Name, Description: spec.Description, InputSchema: data})
+	}
+	return result, nil
+}
+
+// callTool runs a tool, its errors are reported to the client as error results
+func (s *Server) callTool(ctx context.Context, params CallToolParams, send func(*Message) error) (*CallToolResult, error) {
+	tool, err := s.tools.Get(params.Name)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	if params.Meta != nil && len(params.Meta.ProgressToken) > 0 {
+		ctx = context.WithValue(ctx, progressContextKey{}, &progressReporter{token: params.Meta.ProgressToken, send: send})
+	}
+	input := params.Arguments
+	if len(input) == 0 {
+		input = json.RawMessage(`{}`)
+	}
+	result, err := tool.Invoke(ctx, input)
+	if err != nil {
+		result = tools.ErrorResult(err.Error())
+	}
+	return callToolResult(result), nil
+}
+
+func parseError(err error) *Message {
+	return &Message{JSONRPC: jsonrpcVersion, ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}}
+}
+
+type progressContextKey struct{}
+
+type progressReporter struct {
+	token json.RawMessage
+	send  func(*Message) error
+}
+
+// ReportProgress sends notifications/progress about the tool call running with ctx
+// progress must increase with every call, total is 0 when unknown
+// Nothing is sent when the client did not ask for progress or the transport cannot carry it
+func ReportProgress(ctx context.Context, progress, total float64, message string) {
+	reporter, ok := ctx.Value(progressContextKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+	params, err := json.Marshal(ProgressParams{ProgressToken: reporter.token, Progress: progress, Total: total, Message: message})
+	if err != nil {
+		return
+	}
+	reporter.send(&Message{JSONRPC: jsonrpcVersion, Method: "notifications/progress", Params: params})
+}
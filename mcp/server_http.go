@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRequestSize limits the body of the messages POSTed to the server
+const maxRequestSize = 4 << 20
+
+// Handler serves the Streamable HTTP transport, every call returns a handler with its own sessions
+// Tool calls are answered with an event stream carrying their progress when the client accepts one,
+// other requests with JSON, the server starts no GET stream
+// Sessions end with a DELETE request or after the idle timeout, and requests from browsers on other
+// origins are rejected unless they are allowed with WithAllowedOrigins
+func (s *Server) Handler() http.Handler {
+	return &streamableHandler{server: s, sessions: map[string]*serverSession{}}
+}
+
+type streamableHandler struct {
+	server   *Server
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+func (h *streamableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.allowOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		h.post(w, r)
+	case http.MethodDelete:
+		session := h.session(w, r)
+		if session == nil {
+			return
+		}
+		h.mu.Lock()
+		delete(h.sessions, session.id)
+		h.mu.Unlock()
+		session.cancelAll()
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// allowOrigin accepts requests without an Origin, which do not come from browsers,
+// and requests from the origin of the server or an allowed one
+// A page on another origin could otherwise reach a local server through DNS rebinding
+func (h *streamableHandler) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(h.server.allowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// session finds the session named by the request, it answers the request when there is none
+func (h *streamableHandler) session(w http.ResponseWriter, r *http.Request) *serverSession {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		http.Error(w, "missing Mcp-Session-Id header", http.StatusBadRequest)
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session, ok := h.sessions[id]
+	if ok && h.expired(session, time.Now()) {
+		delete(h.sessions, id)
+		ok = false
+	}
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return nil
+	}
+	session.lastUsed = time.Now()
+	return session
+}
+
+// expired reports sessions idle for longer than the timeout, h.mu must be held
+func (h *streamableHandler) expired(session *serverSession, now time.Time) bool {
+	return h.server.idleTimeout > 0 && now.Sub(session.lastUsed) > h.server.idleTimeout && !session.busy()
+}
+
+// add starts a session, idle sessions are dropped first to make room for it
+func (h *streamableHandler) add(session *serverSession) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for id, other := range h.sessions {
+		if h.expired(other, now) {
+			delete(h.sessions, id)
+		}
+	}
+	if h.server.maxSessions > 0 && len(h.sessions) >= h.server.maxSessions {
+		return false
+	}
+	session.lastUsed = now
+	h.sessions[session.id] = session
+	return true
+}
+
+func (h *streamableHandler) post(w http.ResponseWriter, r *http.Request) {
+	message := &Message{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(message); err != nil {
+		writeJSON(w, http.StatusBadRequest, parseError(err))
+		return
+	}
+
+	var session *serverSession
+	if message.Method == "initialize" {
+		session = newServerSession(newSessionID())
+		if !h.add(session) {
+			http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Mcp-Session-Id", session.id)
+	} else if session = h.session(w, r); session == nil {
+		return
+	}
+
+	if !message.IsRequest() {
+		h.server.handle(r.Context(), session, message, discard)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if message.Method != "tools/call" || !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		if response := h.server.handle(r.Context(), session, message, discard); response != nil {
+			writeJSON(w, http.StatusOK, response)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	var writeMu sync.Mutex
+	send := func(message *Message) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return writeEvent(w, sseEvent{Event: "message", Data: string(data)})
+	}
+	if response := h.server.handle(r.Context(), session, message, send); response != nil {
+		send(response)
+	}
+}
+
+func discard(*Message) error {
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, message *Message) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(message)
+}
+
+func newSessionID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,313 @@
+package mcp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/mcp"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// serverTools returns an echo tool and a wait tool that blocks until its call is cancelled
+func serverTools(t *testing.T) (*tools.Registry, chan struct{}, chan struct{}) {
+	t.Helper()
+	started, cancelled := make(chan struct{}, 1), make(chan struct{}, 1)
+	echo := tools.NewFunc(tools.Spec{
+		Name:        "echo",
+		Description: "echoes text",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}, "required": []string{"text"}},
+	}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		var params struct{ Text string }
+		json.Unmarshal(input, &params)
+		if params.Text == "" {
+			return tools.Result{}, errors.New("no text")
+		}
+		return tools.TextResult(params.Text), nil
+	})
+	wait := tools.NewFunc(tools.Spec{Name: "wait", Description: "waits until cancelled"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled <- struct{}{}
+		return tools.Result{}, ctx.Err()
+	})
+	registry, err := tools.NewRegistry(echo, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry, started, cancelled
+}
+
+func TestServer_Stdio(t *testing.T) {
+	registry, started, cancelled := serverTools(t)
+	server := mcp.NewServer(registry, mcp.WithServerInfo("stdio-server", "2.0.0"))
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ServeStdio(context.Background(), requests, responses)
+		responses.Close()
+	}()
+
+	scanner := bufio.NewScanner(responseReader)
+	send := func(message string) {
+		t.Helper()
+		if _, err := io.WriteString(requestWriter, message+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exchange := func(request string) string {
+		t.Helper()
+		send(request)
+		if !scanner.Scan() {
+			t.Fatal("no response")
+		}
+		return scanner.Text()
+	}
+
+	if response := exchange(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`); response != `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-03-26","capabilities":{"tools":{}},"serverInfo":{"name":"stdio-server","version":"2.0.0"}}}` {
+		t.Errorf("unexpected initialize response %s", response)
+	}
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if response := exchange(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); response != `{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"echo","description":"echoes text","inputSchema":{"properties":{"text":{"type":"string"}},"required":["text"],"type":"object"}},{"name":"wait","description":"waits until cancelled","inputSchema":{"type":"object"}}]}}` {
+		t.Errorf("unexpected tools %s", response)
+	}
+	if response := exchange(`{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"echo","arguments":{}}}`); response != `{"jsonrpc":"2.0","id":"a","result":{"content":[{"type":"text","text":"no text"}],"isError":true}}` {
+		t.Errorf("unexpected error result %s", response)
+	}
+	if response := exchange(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"missing"}}`); !strings.Contains(response, `"code":-32602`) {
+		t.Errorf("expected invalid params, got %s", response)
+	}
+	if response := exchange(`not json`); !strings.Contains(response, `"code":-32700`) {
+		t.Errorf("expected a parse error, got %s", response)
+	}
+
+	// a cancelled request is not answered
+	send(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"wait"}}`)
+	<-started
+	send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":4,"reason":"user"}}`)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tool call was not cancelled")
+	}
+	if response := exchange(`{"jsonrpc":"2.0","id":5,"method":"ping"}`); response != `{"jsonrpc":"2.0","id":5,"result":{}}` {
+		t.Errorf("unexpected ping response %s", response)
+	}
+
+	requestWriter.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_HTTP(t *testing.T) {
+	registry, started, cancelled := serverTools(t)
+	api := fakeapi.NewServer(t, fakeapi.Turn{Text: "the answer is 42"})
+	agent, err := agents.NewAgent(context.Background(), api.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register(mcp.AgentTool(agent, "asks the agent"))
+	httpServer := httptest.NewServer(mcp.NewServer(registry).Handler())
+	defer httpServer.Close()
+
+	var mu sync.Mutex
+	progress := []mcp.ProgressParams{}
+	transport := mcp.NewStreamableHTTPTransport(httpServer.URL)
+	client := mcp.NewClient(transport, mcp.WithNotificationHandler("notifications/progress", func(ctx context.Context, params json.RawMessage) {
+		var notification mcp.ProgressParams
+		json.Unmarshal(params, &notification)
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, notification)
+	}))
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// served tools look the same as the ones of the registry
+	adapted, err := client.Tools(context.Background())
+	if err != nil || len(adapted) != 3 {
+		t.Fatalf("unexpected tools %v %v", adapted, err)
+	}
+	for _, tool := range adapted {
+		original, _ := registry.Get(tool.Spec().Name)
+		served, _ := json.Marshal(tools.ToolParam(tool.Spec()))
+		expected, _ := json.Marshal(tools.ToolParam(original.Spec()))
+		if string(served) != string(expected) {
+			t.Errorf("tool %s served as %s, expected %s", tool.Spec().Name, served, expected)
+		}
+	}
+	result, err := adapted[1].Invoke(context.Background(), json.RawMessage(`{"text":"over http"}`))
+	if err != nil || result.Text() != "over http" {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+
+	var answer mcp.CallToolResult
+	params := mcp.CallToolParams{Name: mcp.AskToolName, Arguments: json.RawMessage(`{"prompt":"what is the answer?"}`), Meta: &mcp.Meta{ProgressToken: json.RawMessage(`"p1"`)}}
+	if err := client.Call(context.Background(), "tools/call", params, &answer); err != nil {
+		t.Fatal(err)
+	}
+	if len(answer.Content) != 1 || answer.Content[0].Text != "the answer is 42" {
+		t.Errorf("unexpected answer %+v", answer)
+	}
+	// notification handlers run apart from the read loop and may still be running
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		streamed := ""
+		for _, notification := range progress {
+			streamed += notification.Message
+		}
+		mu.Unlock()
+		if streamed == "the answer is 42" {
+			break
+		}
+	}
+	mu.Lock()
+	streamed := ""
+	for i, notification := range progress {
+		streamed += notification.Message
+		if string(notification.ProgressToken) != `"p1"` || notification.Progress != float64(i+1) {
+			t.Errorf("unexpected progress %+v", notification)
+		}
+	}
+	mu.Unlock()
+	if len(progress) < 2 || streamed != "the answer is 42" {
+		t.Errorf("expected the answer as progress, got %+v", progress)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := client.CallTool(ctx, "wait", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled call, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tool call was not cancelled")
+	}
+
+	session := transport.SessionID()
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, httpServer.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Mcp-Session-Id", session)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the session to be deleted, got %s", resp.Status)
+	}
+}
+
+func TestServer_HTTPSessions(t *testing.T) {
+	registry, _, _ := serverTools(t)
+	post := func(url, session, origin, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+	const ping = `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	server := httptest.NewServer(mcp.NewServer(registry, mcp.WithAllowedOrigins("https://app.example.com"), mcp.WithMaxSessions(1), mcp.WithSessionIdleTimeout(100*time.Millisecond)).Handler())
+	defer server.Close()
+
+	for origin, status := range map[string]int{
+		"https://evil.example.com": http.StatusForbidden,
+		"http://localhost":         http.StatusForbidden,
+		"https://app.example.com":  http.StatusOK,
+		server.URL:                 http.StatusOK,
+		"":                         http.StatusOK,
+	} {
+		resp := post(server.URL, "", origin, initialize)
+		if resp.StatusCode != status {
+			t.Errorf("expected %d for origin %q, got %s", status, origin, resp.Status)
+		}
+		// the session is deleted to leave room for the next one
+		if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+			req, _ := http.NewRequest(http.MethodDelete, server.URL, nil)
+			req.Header.Set("Mcp-Session-Id", id)
+			if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected delete %v %v", resp, err)
+			}
+			if resp := post(server.URL, id, "", ping); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("expected the deleted session to be unknown, got %s", resp.Status)
+			}
+		}
+	}
+
+	session := post(server.URL, "", "", initialize).Header.Get("Mcp-Session-Id")
+	if resp := post(server.URL, "", "", initialize); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the session limit to be reached, got %s", resp.Status)
+	}
+	if resp := post(server.URL, session, "", ping); resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected ping %s", resp.Status)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if resp := post(server.URL, "", "", initialize); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the idle session to make room, got %s", resp.Status)
+	}
+	if resp := post(server.URL, session, "", ping); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the idle session to expire, got %s", resp.Status)
+	}
+}
+
+func TestServer_StdioCancelRightAfterRequest(t *testing.T) {
+	// on one thread a goroutine started per message would run the cancellation before its request
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	for range 20 {
+		registry, _, _ := serverTools(t)
+		ctx, stop := context.WithCancel(context.Background())
+		input := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"wait"}}` + "\n" +
+			`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}` + "\n")
+		var output bytes.Buffer
+		done := make(chan error, 1)
+		go func() {
+			done <- mcp.NewServer(registry).ServeStdio(ctx, input, &output)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			stop()
+			t.Fatal("the cancellation was lost")
+		}
+		stop()
+		if output.Len() != 0 {
+			t.Errorf("expected the cancelled request not to be answered, got %s", output.String())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long a server process may take to exit after its stdin is closed
+const DefaultShutdownTimeout = 5 * time.Second
+
+// StdioTransport runs a server as a subprocess and exchanges newline-delimited JSON over its stdin and stdout
+type StdioTransport struct {
+	command         string
+	args            []string
+	env             []string
+	dir             string
+	stderr          io.Writer
+	shutdownTimeout time.Duration
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+type StdioOption func(t *StdioTransport)
+
+// WithEnv adds environment variables in "KEY=value" form to the environment of the process
+func WithEnv(env ...string) StdioOption {
+	return func(t *StdioTransport) {
+		t.env = append(t.env, env...)
+	}
+}
+
+func WithDir(dir string) StdioOption {
+	return func(t *StdioTransport) {
+		t.dir = dir
+	}
+}
+
+// WithStderr receives the logs of the server, they are dropped by default
+func WithStderr(w io.Writer) StdioOption {
+	return func(t *StdioTransport) {
+		t.stderr = w
+	}
+}
+
+// WithShutdownTimeout replaces DefaultShutdownTimeout, the process is killed afterwards
+func WithShutdownTimeout(timeout time.Duration) StdioOption {
+	return func(t *StdioTransport) {
+		t.shutdownTimeout = timeout
+	}
+}
+
+func NewStdioTransport(command string, args []string, options ...StdioOption) *StdioTransport {
+	t := &StdioTransport{command: command, args: args, shutdownTimeout: DefaultShutdownTimeout}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// Connect starts the process, it outlives ctx until Close
+func (t *StdioTransport) Connect(ctx context.Context) error {
+	cmd := exec.Command(t.command, t.args...)
+	cmd.Dir = t.dir
+	cmd.Stderr = t.stderr
+	if len(t.env) > 0 {
+		cmd.Env = append(os.Environ(), t.env...)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cmd, t.stdin, t.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+func (t *StdioTransport) Send(ctx context.Context, message *Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	stdin := t.stdin
+	t.mu.Unlock()
+	if stdin == nil {
+		return ErrConnectionClosed
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = stdin.Write(append(data, '\n'))
+	return err
+}
+
+// Receive skips lines that are not JSON-RPC messages, some servers print to stdout
+func (t *StdioTransport) Receive() (*Message, error) {
+	t.mu.Lock()
+	stdout := t.stdout
+	t.mu.Unlock()
+	if stdout == nil {
+		return nil, ErrConnectionClosed
+	}
+	for {
+		line, err := stdout.ReadBytes('\n')
+		if len(line) > 0 {
+			var message Message
+			if json.Unmarshal(line, &message) == nil && message.JSONRPC == jsonrpcVersion {
+				return &message, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close closes stdin and waits for the process to exit, it is killed after the shutdown timeout
+func (t *StdioTransport) Close() error {
+	t.mu.Lock()
+	cmd, stdin := t.cmd, t.stdin
+	t.cmd, t.stdin, t.stdout = nil, nil, nil
+	t.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+
+	stdin.Close()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(t.shutdownTimeout):
+		if err := cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-exited
+		return nil
+	}
+}
@@ -0,0 +1,169 @@
+// Command server is a tiny MCP server over stdio for the tests of the mcp package
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   any             `json:"error,omitempty"`
+}
+
+var tools = []map[string]any{
+	{"name": "echo", "description": "echoes text", "inputSchema": map[string]any{
+		"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}, "required": []string{"text"},
+	}},
+	{"name": "image", "description": "returns an image", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "resource", "description": "returns an embedded resource", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "fail", "description": "always fails", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "crash", "description": "exits the server", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "sample", "description": "asks the client's model", "inputSchema": map[string]any{"type": "object"}},
+}
+
+var resources = []map[string]any{
+	{"uri": "file:///notes.txt", "name": "notes", "mimeType": "text/plain"},
+	{"uri": "file:///logo.png", "name": "logo", "mimeType": "image/png"},
+}
+
+var (
+	encoder = json.NewEncoder(os.Stdout)
+	scanner = bufio.NewScanner(os.Stdin)
+)
+
+func main() {
+	// noise on stdout must be skipped by the client
+	fmt.Println("starting test server")
+	for scanner.Scan() {
+		var request message
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil || len(request.ID) == 0 {
+			continue
+		}
+		result, rpcErr := handle(request)
+		encoder.Encode(message{JSONRPC: "2.0", ID: request.ID, Result: result, Error: rpcErr})
+	}
+}
+
+func handle(request message) (any, any) {
+	switch request.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}, "prompts": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "test-server", "version": "1.0.0", "pid": os.Getpid()},
+			"instructions":    fmt.Sprintf("pid %d", os.Getpid()),
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(request.Params, &params)
+		// two pages to exercise pagination
+		if params.Cursor == "" {
+			return map[string]any{"tools": tools[:2], "nextCursor": "page-2"}, nil
+		}
+		return map[string]any{"tools": tools[2:]}, nil
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, map[string]any{"code": -32602, "message": err.Error()}
+		}
+		return call(params.Name, params.Arguments)
+	case "resources/list":
+		return map[string]any{"resources": resources}, nil
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(request.Params, &params)
+		switch params.URI {
+		case "file:///notes.txt":
+			return map[string]any{"contents": []any{map[string]any{"uri": params.URI, "mimeType": "text/plain", "text": "some notes"}}}, nil
+		case "file:///logo.png":
+			return map[string]any{"contents": []any{map[string]any{"uri": params.URI, "mimeType": "image/png", "blob": "iVBORw0KGgo="}}}, nil
+		}
+		return nil, map[string]any{"code": -32002, "message": "resource not found: " + params.URI}
+	case "prompts/list":
+		return map[string]any{"prompts": []any{map[string]any{
+			"name": "review", "description": "reviews code",
+			"arguments": []any{map[string]any{"name": "code", "required": true}},
+		}}}, nil
+	case "prompts/get":
+		var params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		json.Unmarshal(request.Params, &params)
+		if params.Name != "review" {
+			return nil, map[string]any{"code": -32602, "message": "unknown prompt: " + params.Name}
+		}
+		return map[string]any{"messages": []any{
+			map[string]any{"role": "user", "content": map[string]any{"type": "text", "text": "Review this code:"}},
+			map[string]any{"role": "user", "content": map[string]any{"type": "resource", "resource": map[string]any{"uri": "file:///main.go", "mimeType": "text/x-go", "text": params.Arguments["code"]}}},
+			map[string]any{"role": "assistant", "content": map[string]any{"type": "text", "text": "Sure."}},
+		}}, nil
+	}
+	return nil, map[string]any{"code": -32601, "message": "method not found: " + request.Method}
+}
+
+func call(name string, arguments map[string]any) (any, any) {
+	switch name {
+	case "echo":
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprint(arguments["text"])}}}, nil
+	case "image":
+		return map[string]any{"content": []any{
+			map[string]any{"type": "image", "data": "iVBORw0KGgo=", "mimeType": "image/png"},
+			map[string]any{"type": "audio", "data": "AAAA", "mimeType": "audio/wav"},
+		}}, nil
+	case "resource":
+		return map[string]any{"content": []any{
+			map[string]any{"type": "resource", "resource": map[string]any{"uri": "file:///notes.txt", "mimeType": "text/plain", "text": "some notes"}},
+			map[string]any{"type": "resource_link", "uri": "file:///big.bin", "name": "big"},
+		}}, nil
+	case "fail":
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": "it failed"}}, "isError": true}, nil
+	case "crash":
+		os.Exit(1)
+	case "sample":
+		response := sample()
+		if response.Error != nil {
+			return map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprint(response.Error)}}, "isError": true}, nil
+		}
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": string(response.Params)}}}, nil
+	}
+	return nil, map[string]any{"code": -32602, "message": "unknown tool: " + name}
+}
+
+// sample sends sampling/createMessage to the client and waits for its response, the result is returned in Params
+func sample() message {
+	encoder.Encode(message{JSONRPC: "2.0", ID: json.RawMessage(`"sample-1"`), Method: "sampling/createMessage", Params: json.RawMessage(`{
+		"messages": [{"role": "user", "content": {"type": "text", "text": "Say hi"}}],
+		"systemPrompt": "Be brief",
+		"maxTokens": 100,
+		"modelPreferences": {"hints": [{"name": "claude-3-haiku"}]}
+	}`)})
+	for scanner.Scan() {
+		var response struct {
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  any             `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &response) == nil && string(response.ID) == `"sample-1"` {
+			return message{Params: response.Result, Error: response.Error}
+		}
+	}
+	os.Exit(1)
+	return message{}
+}
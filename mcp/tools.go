@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// Tools lists the server's tools as tools for agents and tools.Registry
+func (c *Client) Tools(ctx context.Context) ([]tools.Tool, error) {
+	listed, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	adapted := make([]tools.Tool, 0, len(listed))
+	for _, tool := range listed {
+		spec, err := toolSpec(tool)
+		if err != nil {
+			return nil, err
+		}
+		adapted = append(adapted, &remoteTool{client: c, spec: spec})
+	}
+	return adapted, nil
+}
+
+// remoteTool forwards calls to tools/call
+type remoteTool struct {
+	client *Client
+	spec   tools.Spec
+}
+
+func (t *remoteTool) Spec() tools.Spec {
+	return t.spec
+}
+
+func (t *remoteTool) Invoke(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+	result, err := t.client.CallTool(ctx, t.spec.Name, input)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	return ToolResult(result), nil
+}
+
+func toolSpec(tool Tool) (tools.Spec, error) {
+	spec := tools.Spec{Name: tool.Name, Description: tool.Description}
+	if spec.Description == "" {
+		spec.Description = tool.Title
+	}
+	if len(tool.InputSchema) > 0 {
+		if err := json.Unmarshal(tool.InputSchema, &spec.InputSchema); err != nil {
+			return tools.Spec{}, fmt.Errorf("mcp: input schema of %s: %w", tool.Name, err)
+		}
+	}
+	return spec, nil
+}
+
+// ToolResult converts an MCP result into tool_result content
+// Text becomes text blocks, images image blocks and embedded text or PDF resources documents,
+// content the API cannot take is described in a text block
+func ToolResult(result *CallToolResult) tools.Result {
+	converted := tools.Result{IsError: result.IsError}
+	for _, content := range result.Content {
+		converted.Content = append(converted.Content, toolResultContent(content))
+	}
+	if len(converted.Content) == 0 && len(result.StructuredContent) > 0 {
+		converted.Content = append(converted.Content, textContent(string(result.StructuredContent)))
+	}
+	return converted
+}
+
+func toolResultContent(content Content) anthropic.ToolResultBlockParamContentUnion {
+	switch content.Type {
+	case "text":
+		return textContent(content.Text)
+	case "image":
+		return anthropic.ToolResultBlockParamContentUnion{OfImage: imageBlock(content.Data, content.MimeType)}
+	case "resource":
+		if content.Resource == nil {
+			break
+		}
+		if document := resourceDocument(*content.Resource); document != nil {
+			return anthropic.ToolResultBlockParamContentUnion{OfDocument: document}
+		}
+		return textContent(omittedResource(*content.Resource))
+	case "resource_link":
+		return textContent(fmt.Sprintf("[resource link %s: %s]", content.Name, content.URI))
+	}
+	return textContent(fmt.Sprintf("[%s content omitted]", content.Type))
+}
+
+// callToolResult converts a tool's result for MCP clients, the inverse of ToolResult
+func callToolResult(result tools.Result) *CallToolResult {
+	converted := &CallToolResult{Content: []Content{}, IsError: result.IsError}
+	for _, block := range result.Content {
+		switch {
+		case block.OfText != nil:
+			converted.Content = append(converted.Content, TextContent(block.OfText.Text))
+		case block.OfImage != nil && block.OfImage.Source.OfBase64 != nil:
+			source := block.OfImage.Source.OfBase64
+			converted.Content = append(converted.Content, Content{Type: "image", Data: source.Data, MimeType: string(source.MediaType)})
+		case block.OfImage != nil && block.OfImage.Source.OfURL != nil:
+			converted.Content = append(converted.Content, Content{Type: "resource_link", URI: block.OfImage.Source.OfURL.URL, Name: "image"})
+		case block.OfDocument != nil:
+			converted.Content = append(converted.Content, documentContent(block.OfDocument))
+		}
+	}
+	return converted
+}
+
+// documentContent embeds a document as a resource named by its title
+func documentContent(document *anthropic.DocumentBlockParam) Content {
+	uri := "document"
+	if document.Title.Valid() {
+		uri = document.Title.Value
+	}
+	switch source := document.Source; {
+	case source.OfText != nil:
+		return Content{Type: "resource", Resource: &ResourceContents{URI: uri, MimeType: "text/plain", Text: source.OfText.Data}}
+	case source.OfBase64 != nil:
+		return Content{Type: "resource", Resource: &ResourceContents{URI: uri, MimeType: "application/pdf", Blob: source.OfBase64.Data}}
+	case source.OfURL != nil:
+		return Content{Type: "resource_link", URI: source.OfURL.URL, Name: uri}
+	}
+	return TextContent(fmt.Sprintf("[document %s omitted]", uri))
+}
+
+func isText(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" || strings.HasSuffix(mimeType, "+json")
+}
+
+func textContent(text string) anthropic.ToolResultBlockParamContentUnion {
+	return anthropic.ToolResultBlockParamContentUnion{OfText: &anthropic.TextBlockParam{Text: text}}
+}
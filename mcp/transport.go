@@ -0,0 +1,23 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrConnectionClosed = errors.New("mcp: connection closed")
+	ErrClientClosed     = errors.New("mcp: client closed")
+	// ErrSessionExpired is returned when an HTTP server no longer knows the session, the client then starts a new one
+	ErrSessionExpired = errors.New("mcp: session expired")
+)
+
+// Transport carries JSON-RPC messages between a client and a server
+// Connect may be called again after Close to reconnect
+type Transport interface {
+	Connect(ctx context.Context) error
+	Send(ctx context.Context, message *Message) error
+	// Receive blocks until the next message, it returns an error once the connection is lost or closed
+	Receive() (*Message, error)
+	Close() error
+}
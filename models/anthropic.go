@@ -2,9 +2,19 @@ package models
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/yuki5155/go-strands-agents/cost"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/logging"
 	"github.com/yuki5155/go-strands-agents/utils"
 )
 
@@ -12,6 +22,25 @@ type AnthropicConfig struct {
 	ModelId   string
 	MaxTokens int64
 	ApiKey    string
+	BaseURL   string
+	// CostTrackers are charged for every call of the client
+	CostTrackers []*cost.Tracker
+	// Hooks receives the model call events of every call of the client
+	Hooks *hooks.Registry
+	// Logger receives requests, retries, stop reasons and token usage, it is silent by default
+	Logger *slog.Logger
+	// Recorder receives the raw events of every call of the client
+	Recorder *StreamRecorder
+}
+
+// LogValue keeps the api key out of logs
+func (c AnthropicConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("model", c.ModelId),
+		slog.Int64("max_tokens", c.MaxTokens),
+		slog.String("base_url", c.BaseURL),
+		slog.String("api_key", logging.Redacted),
+	)
 }
 
 type Option func(c *AnthropicConfig)
@@ -47,6 +76,35 @@ func WithApiKey(apiKey string) Option {
 	}
 }
 
+// default is empty, the SDK then uses ANTHROPIC_BASE_URL or the public API
+func WithBaseURL(baseURL string) Option {
+	return func(c *AnthropicConfig) {
+		c.BaseURL = baseURL
+	}
+}
+
+// WithCostTracker charges every call of the client to tracker, a spent budget makes calls fail
+func WithCostTracker(tracker *cost.Tracker) Option {
+	return func(c *AnthropicConfig) {
+		c.CostTrackers = append(c.CostTrackers, tracker)
+	}
+}
+
+// WithHookRegistry emits the model call events of every call of the client to registry,
+// e.g. for metrics exporters that must see calls made outside of agents
+func WithHookRegistry(registry *hooks.Registry) Option {
+	return func(c *AnthropicConfig) {
+		c.Hooks = registry
+	}
+}
+
+// WithLogger sets the logger of the client, attributes such as api keys are redacted
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *AnthropicConfig) {
+		c.Logger = logging.Redact(logger)
+	}
+}
+
 func NewAnthropicConfig(options ...Option) *AnthropicConfig {
 	// Set defaults
 	config := &AnthropicConfig{
@@ -75,6 +133,18 @@ type StreamingResponse struct {
 	CacheCreationInputTokens int64
 	CacheReadInputTokens     int64
 	Channel                  chan string
+	// Message accumulates every content block, including tool_use and thinking blocks
+	Message anthropic.Message
+	// Err is set when the stream failed, read it after Channel is closed
+	Err error
+	// RequestStart is when the request was sent, FirstEvent and FirstDelta when the first event
+	// and the first text or tool input delta arrived, and Completed when the stream ended
+	RequestStart time.Time
+	FirstEvent   time.Time
+	FirstDelta   time.Time
+	Completed    time.Time
+	// Blocks times every content block in order
+	Blocks []BlockTiming
 }
 
 // NewStreamingResponse creates a new StreamingResponse with the given model
@@ -90,9 +160,20 @@ func (r *StreamingResponse) GetChannel() chan string {
 	return r.Channel
 }
 
+// Wait drains the channel until the stream is finished and returns its error
+func (r *StreamingResponse) Wait() error {
+	for range r.Channel {
+	}
+	return r.Err
+}
+
 // ProcessEvent processes a streaming event and updates the response accordingly
 // Returns the text delta for content_block_delta events, empty string otherwise
 func (r *StreamingResponse) ProcessEvent(event anthropic.MessageStreamEventUnion) string {
+	r.recordTiming(event, time.Now())
+	if err := r.Message.Accumulate(event); err != nil && r.Err == nil {
+		r.Err = err
+	}
 	switch event.Type {
 	case "message_start":
 		messageStart := event.AsMessageStart()
@@ -113,6 +194,10 @@ func (r *StreamingResponse) ProcessEvent(event anthropic.MessageStreamEventUnion
 		}
 	case "content_block_delta":
 		delta := event.AsContentBlockDelta()
+		if delta.Delta.Text == "" {
+			// input_json, thinking and signature deltas only go to Message
+			return ""
+		}
 		r.Content += delta.Delta.Text
 		if r.Channel != nil {
 			r.Channel <- delta.Delta.Text
@@ -150,33 +235,168 @@ func NewAnthropicClient(options ...Option) *AnthropicClient {
 		config.ApiKey = key
 	}
 
+	requestOptions := []option.RequestOption{
+		option.WithAPIKey(config.ApiKey),
+	}
+	if config.BaseURL != "" {
+		requestOptions = append(requestOptions, option.WithBaseURL(config.BaseURL))
+	}
+	logging.OrDiscard(logging.Redact(config.Logger)).Debug("anthropic client created", "config", config)
 	return &AnthropicClient{
-		Client: anthropic.NewClient(
-			option.WithAPIKey(config.ApiKey),
-		),
+		Client: anthropic.NewClient(requestOptions...),
 		Config: config,
 	}
 }
 
-// StreamMessages sends messages and streams the response with optional callback for each text delta
-func (c *AnthropicClient) StreamMessages(ctx context.Context, messages []anthropic.MessageParam, onDelta func(string)) (*StreamingResponse, error) {
+// streamConfig holds the request and the settings of one StreamMessages call
+type streamConfig struct {
+	params           anthropic.MessageNewParams
+	prefill          string
+	maxContinuations int
+	hooks            *hooks.Registry
+	costTrackers     []*cost.Tracker
+}
+
+// StreamOption adjusts the request sent by StreamMessages
+type StreamOption func(c *streamConfig)
+
+func WithSystem(system string) StreamOption {
+	return func(c *streamConfig) {
+		if system != "" {
+			c.params.System = []anthropic.TextBlockParam{{Text: system}}
+		}
+	}
+}
+
+func WithTools(tools []anthropic.ToolUnionParam) StreamOption {
+	return func(c *streamConfig) {
+		c.params.Tools = tools
+	}
+}
+
+// WithCallMaxTokens replaces the client's MaxTokens for this call
+func WithCallMaxTokens(maxTokens int64) StreamOption {
+	return func(c *streamConfig) {
+		if maxTokens > 0 {
+			c.params.MaxTokens = maxTokens
+		}
+	}
+}
+
+func WithTemperature(temperature float64) StreamOption {
+	return func(c *streamConfig) {
+		c.params.Temperature = anthropic.Float(temperature)
+	}
+}
+
+func WithStopSequences(sequences ...string) StreamOption {
+	return func(c *streamConfig) {
+		c.params.StopSequences = sequences
+	}
+}
+
+// WithPrefill starts the assistant response with prefill, e.g. "{" to force JSON
+// The prefill is part of Content and Message, trailing whitespace is dropped because the API rejects it
+func WithPrefill(prefill string) StreamOption {
+	return func(c *streamConfig) {
+		c.prefill = strings.TrimRightFunc(prefill, unicode.IsSpace)
+	}
+}
+
+// WithContinuation re-issues the request with the partial assistant message
+// when the response stops on max_tokens or pause_turn, at most maxContinuations times
+// The parts are merged into one response and their usage is summed
+func WithContinuation(maxContinuations int) StreamOption {
+	return func(c *streamConfig) {
+		c.maxContinuations = maxContinuations
+	}
+}
+
+// WithHooks emits the model call events of the request to registry, in addition to the client's registry
+func WithHooks(registry *hooks.Registry) StreamOption {
+	return func(c *streamConfig) {
+		c.hooks = registry
+	}
+}
+
+// WithCallCostTrackers charges this call to trackers in addition to the client's trackers,
+// e.g. the trackers of a session or a tenant
+func WithCallCostTrackers(trackers ...*cost.Tracker) StreamOption {
+	return func(c *streamConfig) {
+		c.costTrackers = append(c.costTrackers, trackers...)
+	}
+}
+
+// StreamMessages sends messages and streams the response, handler receives its typed events and may be nil
+func (c *AnthropicClient) StreamMessages(ctx context.Context, messages []anthropic.MessageParam, handler StreamHandler, options ...StreamOption) (*StreamingResponse, error) {
 	response := NewStreamingResponse(c.Config.ModelId)
+	config := &streamConfig{params: anthropic.MessageNewParams{
+		MaxTokens: c.Config.MaxTokens,
+		Messages:  messages,
+		Model:     anthropic.Model(c.Config.ModelId),
+	}}
+	for _, option := range options {
+		option(config)
+	}
+	trackers := append(slices.Clip(c.Config.CostTrackers), config.costTrackers...)
+	registries := hookRegistries(c.Config.Hooks, config.hooks)
+	logger := logging.OrDiscard(logging.Redact(c.Config.Logger))
+	if err := checkBudgets(trackers); err != nil {
+		logger.WarnContext(ctx, "model call refused", "error", err)
+		return nil, err
+	}
 
 	go func() {
 		defer close(response.Channel)
 
-		stream := c.Client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-			MaxTokens: c.Config.MaxTokens,
-			Messages:  messages,
-			Model:     anthropic.Model(c.Config.ModelId),
-		})
-		defer stream.Close()
-
-		for stream.Next() {
-			event := stream.Current()
-			delta := response.ProcessEvent(event)
-			if delta != "" && onDelta != nil {
-				onDelta(delta)
+		if config.prefill != "" {
+			response.Message.Content = []anthropic.ContentBlockUnion{textBlock(config.prefill)}
+			response.Content = config.prefill
+			response.Channel <- config.prefill
+			if handler != nil {
+				handler.HandleEvent(TextDeltaEvent{Text: config.prefill})
+			}
+		}
+		for continuation := 0; ; continuation++ {
+			if continuation > 0 {
+				if err := checkBudgets(trackers); err != nil {
+					logger.WarnContext(ctx, "model continuation refused", "error", err)
+					response.Err = err
+					return
+				}
+			}
+			params := config.params
+			if len(response.Message.Content) > 0 {
+				params.Messages = append(slices.Clip(messages), response.partialMessage())
+			}
+			part := &StreamingResponse{Model: response.Model, Channel: response.Channel}
+			invokeHooks(ctx, registries, &hooks.BeforeModelCall{Params: &params})
+			logger.DebugContext(ctx, "model request",
+				"model", params.Model,
+				"messages", len(params.Messages),
+				"tools", len(params.Tools),
+				"continuation", continuation,
+			)
+			c.stream(ctx, params, part, handler, registries, logger)
+			after := &hooks.AfterModelCall{
+				Model:            string(params.Model),
+				Params:           params,
+				Message:          part.Message,
+				StopReason:       part.StopReason,
+				Err:              part.Err,
+				Duration:         part.Latency(),
+				TimeToFirstToken: part.TimeToFirstToken(),
+			}
+			invokeHooks(ctx, registries, after)
+			logModelCall(ctx, logger, after)
+			charge(ctx, logger, trackers, c.Config.ModelId, part)
+			response.merge(part)
+
+			if response.Err != nil || continuation >= config.maxContinuations {
+				return
+			}
+			if response.StopReason != string(anthropic.StopReasonMaxTokens) && response.StopReason != string(anthropic.StopReasonPauseTurn) {
+				return
 			}
 		}
 	}()
@@ -184,27 +404,174 @@ func (c *AnthropicClient) StreamMessages(ctx context.Context, messages []anthrop
 	return response, nil
 }
 
-// StreamSimpleMessage is a convenience method for sending a single text message
-func (c *AnthropicClient) StreamSimpleMessage(ctx context.Context, text string, printToConsole bool) (*StreamingResponse, error) {
-	messages := []anthropic.MessageParam{
-		anthropic.NewUserMessage(anthropic.NewTextBlock(text)),
+func checkBudgets(trackers []*cost.Tracker) error {
+	for _, tracker := range trackers {
+		if err := tracker.Check(); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	var onDelta func(string)
-	if printToConsole {
-		onDelta = func(delta string) {
-			//fmt.Print(delta)
+// charge adds the usage of one request to every tracker
+// The response is already paid for, so a model without a price is logged and never fails the call
+func charge(ctx context.Context, logger *slog.Logger, trackers []*cost.Tracker, model string, response *StreamingResponse) {
+	usage := cost.Usage{
+		InputTokens:              response.InputTokens,
+		OutputTokens:             response.OutputTokens,
+		CacheCreationInputTokens: response.CacheCreationInputTokens,
+		CacheReadInputTokens:     response.CacheReadInputTokens,
+	}
+	for _, tracker := range trackers {
+		if _, err := tracker.Add(model, usage); err != nil {
+			logger.WarnContext(ctx, "model call not priced", "tracker", tracker.Name(), "model", model, "error", err)
 		}
 	}
+}
 
-	response, err := c.StreamMessages(ctx, messages, onDelta)
-	if err != nil {
-		return nil, err
+func logModelCall(ctx context.Context, logger *slog.Logger, call *hooks.AfterModelCall) {
+	if call.Err != nil {
+		logger.ErrorContext(ctx, "model request failed", "model", call.Model, "duration", call.Duration, "error", call.Err)
+		return
 	}
+	usage := call.Message.Usage
+	logger.DebugContext(ctx, "model response",
+		"model", call.Model,
+		"stop_reason", call.StopReason,
+		"input_tokens", usage.InputTokens,
+		"output_tokens", usage.OutputTokens,
+		"cache_creation_input_tokens", usage.CacheCreationInputTokens,
+		"cache_read_input_tokens", usage.CacheReadInputTokens,
+		"duration", call.Duration,
+		"time_to_first_token", call.TimeToFirstToken,
+	)
+}
 
+// hookRegistries drops nil and repeated registries
+func hookRegistries(registries ...*hooks.Registry) []*hooks.Registry {
+	unique := []*hooks.Registry{}
+	for _, registry := range registries {
+		if registry != nil && !slices.Contains(unique, registry) {
+			unique = append(unique, registry)
+		}
+	}
+	return unique
+}
+
+func invokeHooks[E any](ctx context.Context, registries []*hooks.Registry, event *E) {
+	for _, registry := range registries {
+		hooks.Invoke(ctx, registry, event)
+	}
+}
+
+// stream sends one request and processes its events into response
+func (c *AnthropicClient) stream(ctx context.Context, params anthropic.MessageNewParams, response *StreamingResponse, handler StreamHandler, registries []*hooks.Registry, logger *slog.Logger) {
+	response.RequestStart = time.Now()
+	onRetry := func(attempt int, statusCode int) {
+		logger.InfoContext(ctx, "model request retry", "model", params.Model, "attempt", attempt, "status_code", statusCode)
+		if handler != nil {
+			handler.HandleEvent(RetryEvent{Attempt: attempt, StatusCode: statusCode})
+		}
+		invokeHooks(ctx, registries, &hooks.ModelRetry{Model: string(params.Model), Attempt: attempt, StatusCode: statusCode})
+	}
+	stream := c.Client.Messages.NewStreaming(ctx, params, retryMiddleware(onRetry))
+	defer stream.Close()
+
+	for stream.Next() {
+		event := stream.Current()
+		if c.Config.Recorder != nil {
+			if err := c.Config.Recorder.Record(event); err != nil {
+				logger.WarnContext(ctx, "stream recording failed", "error", err)
+			}
+		}
+		invokeHooks(ctx, registries, &hooks.ModelStreamEvent{Event: event})
+		response.ProcessEvent(event)
+		emit(handler, event, response)
+	}
+	if err := stream.Err(); err != nil {
+		response.Err = err
+	}
+	if response.Completed.IsZero() {
+		response.Completed = time.Now()
+	}
+	if response.Err != nil && handler != nil {
+		handler.HandleEvent(ErrorEvent{Err: response.Err})
+	}
+}
+
+// partialMessage returns the assistant message received so far, for the model to continue
+// Trailing whitespace, which the API rejects, is only dropped from the request, the response keeps the streamed text
+func (r *StreamingResponse) partialMessage() anthropic.MessageParam {
+	message := r.Message.ToParam()
+	message.Role = anthropic.MessageParamRoleAssistant
+	if last := len(message.Content) - 1; message.Content[last].OfText != nil {
+		text := strings.TrimRightFunc(message.Content[last].OfText.Text, unicode.IsSpace)
+		if text == "" && last > 0 {
+			message.Content = message.Content[:last]
+		} else {
+			message.Content[last] = anthropic.NewTextBlock(text)
+		}
+	}
+	return message
+}
+
+// merge appends a continuation to the response
+func (r *StreamingResponse) merge(part *StreamingResponse) {
+	if r.MessageID == "" {
+		r.MessageID = part.MessageID
+	}
+	r.Role = part.Role
+	r.Content += part.Content
+	r.ContentBlockType = part.ContentBlockType
+	r.ContentBlockIndex = part.ContentBlockIndex
+	r.StopReason = part.StopReason
+	r.StopSequence = part.StopSequence
+	r.InputTokens += part.InputTokens
+	r.OutputTokens += part.OutputTokens
+	r.CacheCreationInputTokens += part.CacheCreationInputTokens
+	r.CacheReadInputTokens += part.CacheReadInputTokens
+	if r.Err == nil {
+		r.Err = part.Err
+	}
+	r.mergeTiming(part)
+
+	message := part.Message
+	message.ID = r.MessageID
+	message.Content = r.Message.Content
+	for _, block := range part.Message.Content {
+		last := len(message.Content) - 1
+		if last >= 0 && block.Type == "text" && message.Content[last].Type == "text" {
+			// the continuation of a cut off text block arrives as a new block
+			message.Content[last] = textBlock(message.Content[last].Text + block.Text)
+			continue
+		}
+		message.Content = append(message.Content, block)
+	}
+	message.Usage.InputTokens += r.Message.Usage.InputTokens
+	message.Usage.OutputTokens += r.Message.Usage.OutputTokens
+	message.Usage.CacheCreationInputTokens += r.Message.Usage.CacheCreationInputTokens
+	message.Usage.CacheReadInputTokens += r.Message.Usage.CacheReadInputTokens
+	r.Message = message
+}
+
+// textBlock builds a text block through JSON, the SDK reads blocks back from their raw JSON
+func textBlock(text string) anthropic.ContentBlockUnion {
+	var block anthropic.ContentBlockUnion
+	data, _ := json.Marshal(map[string]string{"type": "text", "text": text})
+	_ = block.UnmarshalJSON(data)
+	return block
+}
+
+// StreamSimpleMessage is a convenience method for sending a single text message
+func (c *AnthropicClient) StreamSimpleMessage(ctx context.Context, text string, printToConsole bool) (*StreamingResponse, error) {
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock(text)),
+	}
+
+	var handler StreamHandler
 	if printToConsole {
-		// fmt.Println() // newline at the end
+		handler = PrintHandler(os.Stdout)
 	}
 
-	return response, nil
+	return c.StreamMessages(ctx, messages, handler)
 }
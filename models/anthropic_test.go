@@ -81,6 +81,10 @@ func TestNewStreamingResponse(t *testing.T) {
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
 			response := NewStreamingResponse(testcase.model)
+			if response.Channel == nil {
+				t.Fatal("expected a channel")
+			}
+			response.Channel = nil
 			if !reflect.DeepEqual(response, testcase.expected) {
 				t.Errorf("expected %+v, got %+v", testcase.expected, response)
 			}
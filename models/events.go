@@ -0,0 +1,258 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// StreamEvent is one of the typed events delivered to a StreamHandler
+type StreamEvent interface {
+	streamEvent()
+}
+
+// MessageStartEvent starts a response, continuations start a new one
+type MessageStartEvent struct {
+	MessageID   string
+	Model       string
+	InputTokens int64
+}
+
+// BlockStartEvent starts a content block, ToolUseID and ToolName are set for tool_use blocks
+type BlockStartEvent struct {
+	Index     int
+	Type      string
+	ToolUseID string
+	ToolName  string
+}
+
+// BlockStopEvent ends a content block, Block holds its accumulated content
+type BlockStopEvent struct {
+	Index int
+	Block anthropic.ContentBlockUnion
+}
+
+type TextDeltaEvent struct {
+	Index int
+	Text  string
+}
+
+type ThinkingDeltaEvent struct {
+	Index    int
+	Thinking string
+}
+
+// ToolInputDeltaEvent carries a fragment of the JSON input of a tool_use block
+type ToolInputDeltaEvent struct {
+	Index       int
+	PartialJSON string
+}
+
+// ToolResultEvent is emitted by agents once a tool has run
+type ToolResultEvent struct {
+	ToolUseID string
+	Name      string
+	Result    tools.Result
+}
+
+// UsageEvent reports the token usage of the response so far
+type UsageEvent struct {
+	InputTokens              int64
+	OutputTokens             int64
+	CacheCreationInputTokens int64
+	CacheReadInputTokens     int64
+}
+
+type MessageStopEvent struct {
+	StopReason   string
+	StopSequence string
+}
+
+// ErrorEvent reports that the stream failed, the error is also in StreamingResponse.Err
+type ErrorEvent struct {
+	Err error
+}
+
+// RetryEvent reports that the request is sent again after a failed attempt
+type RetryEvent struct {
+	// Attempt counts the retries, starting at 1
+	Attempt int
+	// StatusCode is the status of the failed attempt, zero for network errors
+	StatusCode int
+}
+
+func (MessageStartEvent) streamEvent()   {}
+func (BlockStartEvent) streamEvent()     {}
+func (BlockStopEvent) streamEvent()      {}
+func (TextDeltaEvent) streamEvent()      {}
+func (ThinkingDeltaEvent) streamEvent()  {}
+func (ToolInputDeltaEvent) streamEvent() {}
+func (ToolResultEvent) streamEvent()     {}
+func (UsageEvent) streamEvent()          {}
+func (MessageStopEvent) streamEvent()    {}
+func (ErrorEvent) streamEvent()          {}
+func (RetryEvent) streamEvent()          {}
+
+// StreamHandler receives the events of a streaming call in order
+type StreamHandler interface {
+	HandleEvent(event StreamEvent)
+}
+
+// StreamHandlerFunc adapts a function to StreamHandler
+type StreamHandlerFunc func(event StreamEvent)
+
+func (f StreamHandlerFunc) HandleEvent(event StreamEvent) {
+	f(event)
+}
+
+// TextHandler calls fn for every text delta
+func TextHandler(fn func(text string)) StreamHandler {
+	return StreamHandlerFunc(func(event StreamEvent) {
+		if delta, ok := event.(TextDeltaEvent); ok {
+			fn(delta.Text)
+		}
+	})
+}
+
+// Handlers combines handlers, nil handlers are skipped
+func Handlers(handlers ...StreamHandler) StreamHandler {
+	return StreamHandlerFunc(func(event StreamEvent) {
+		for _, handler := range handlers {
+			if handler != nil {
+				handler.HandleEvent(event)
+			}
+		}
+	})
+}
+
+// PrintHandler writes text deltas to w, e.g. os.Stdout, and a newline when the message stops
+func PrintHandler(w io.Writer) StreamHandler {
+	return StreamHandlerFunc(func(event StreamEvent) {
+		switch event := event.(type) {
+		case TextDeltaEvent:
+			fmt.Fprint(w, event.Text)
+		case MessageStopEvent:
+			fmt.Fprintln(w)
+		case ErrorEvent:
+			fmt.Fprintf(w, "\nerror: %v\n", event.Err)
+		}
+	})
+}
+
+// BufferHandler collects events and text, it is safe to read while the stream runs
+type BufferHandler struct {
+	mu     sync.Mutex
+	events []StreamEvent
+	text   strings.Builder
+}
+
+func NewBufferHandler() *BufferHandler {
+	return &BufferHandler{}
+}
+
+func (b *BufferHandler) HandleEvent(event StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+	if delta, ok := event.(TextDeltaEvent); ok {
+		b.text.WriteString(delta.Text)
+	}
+}
+
+// Events returns the events received so far
+func (b *BufferHandler) Events() []StreamEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]StreamEvent{}, b.events...)
+}
+
+// Text joins the text deltas received so far
+func (b *BufferHandler) Text() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.text.String()
+}
+
+// ChannelHandler forwards events to ch, sends block until ch is read
+func ChannelHandler(ch chan<- StreamEvent) StreamHandler {
+	return StreamHandlerFunc(func(event StreamEvent) {
+		ch <- event
+	})
+}
+
+// emit converts an SDK event into typed events, response has already processed it
+func emit(handler StreamHandler, event anthropic.MessageStreamEventUnion, response *StreamingResponse) {
+	if handler == nil {
+		return
+	}
+	switch event.Type {
+	case "message_start":
+		start := event.AsMessageStart()
+		handler.HandleEvent(MessageStartEvent{
+			MessageID:   start.Message.ID,
+			Model:       string(start.Message.Model),
+			InputTokens: start.Message.Usage.InputTokens,
+		})
+	case "content_block_start":
+		start := event.AsContentBlockStart()
+		handler.HandleEvent(BlockStartEvent{
+			Index:     int(start.Index),
+			Type:      start.ContentBlock.Type,
+			ToolUseID: start.ContentBlock.ID,
+			ToolName:  start.ContentBlock.Name,
+		})
+		if start.ContentBlock.Text != "" {
+			handler.HandleEvent(TextDeltaEvent{Index: int(start.Index), Text: start.ContentBlock.Text})
+		}
+	case "content_block_delta":
+		delta := event.AsContentBlockDelta()
+		index := int(delta.Index)
+		switch delta.Delta.Type {
+		case "text_delta":
+			handler.HandleEvent(TextDeltaEvent{Index: index, Text: delta.Delta.Text})
+		case "thinking_delta":
+			handler.HandleEvent(ThinkingDeltaEvent{Index: index, Thinking: delta.Delta.Thinking})
+		case "input_json_delta":
+			handler.HandleEvent(ToolInputDeltaEvent{Index: index, PartialJSON: delta.Delta.PartialJSON})
+		}
+	case "content_block_stop":
+		stop := event.AsContentBlockStop()
+		stopEvent := BlockStopEvent{Index: int(stop.Index)}
+		if len(response.Message.Content) > 0 {
+			stopEvent.Block = response.Message.Content[len(response.Message.Content)-1]
+		}
+		handler.HandleEvent(stopEvent)
+	case "message_delta":
+		handler.HandleEvent(UsageEvent{
+			InputTokens:              response.InputTokens,
+			OutputTokens:             response.OutputTokens,
+			CacheCreationInputTokens: response.CacheCreationInputTokens,
+			CacheReadInputTokens:     response.CacheReadInputTokens,
+		})
+	case "message_stop":
+		handler.HandleEvent(MessageStopEvent{StopReason: response.StopReason, StopSequence: response.StopSequence})
+	}
+}
+
+// retryMiddleware calls onRetry before every attempt after the first
+func retryMiddleware(onRetry func(attempt int, statusCode int)) option.RequestOption {
+	lastStatus := 0
+	return option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if attempt, _ := strconv.Atoi(req.Header.Get("X-Stainless-Retry-Count")); attempt > 0 {
+			onRetry(attempt, lastStatus)
+		}
+		res, err := next(req)
+		lastStatus = 0
+		if res != nil {
+			lastStatus = res.StatusCode
+		}
+		return res, err
+	})
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// RecordedEvent is one line of a stream recording
+type RecordedEvent struct {
+	Time time.Time `json:"time"`
+	// Event is the raw JSON of the event as received from the API
+	Event json.RawMessage `json:"event"`
+}
+
+// StreamRecorder writes the raw events of every stream as JSONL, it is safe for concurrent use
+type StreamRecorder struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewStreamRecorder(w io.Writer) *StreamRecorder {
+	return &StreamRecorder{encoder: json.NewEncoder(w)}
+}
+
+// Record writes one event with the current time
+func (r *StreamRecorder) Record(event anthropic.MessageStreamEventUnion) error {
+	raw := json.RawMessage(event.RawJSON())
+	if len(raw) == 0 {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		raw = data
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(RecordedEvent{Time: time.Now(), Event: raw})
+}
+
+// WithStreamRecording records the raw events of every call of the client to w as JSONL, see ReplayRecording
+func WithStreamRecording(w io.Writer) Option {
+	return func(c *AnthropicConfig) {
+		c.Recorder = NewStreamRecorder(w)
+	}
+}
+
+// LoadRecording reads the events of a recording
+func LoadRecording(r io.Reader) ([]RecordedEvent, error) {
+	events := []RecordedEvent{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("models: recording line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// ReplayRecording feeds a recording through ProcessEvent to reproduce a stream offline
+// Every message_start starts a new response, handler receives the typed events and may be nil
+func ReplayRecording(r io.Reader, handler StreamHandler) ([]*StreamingResponse, error) {
+	events, err := LoadRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	responses := []*StreamingResponse{}
+	var response *StreamingResponse
+	for i, recorded := range events {
+		var event anthropic.MessageStreamEventUnion
+		if err := event.UnmarshalJSON(recorded.Event); err != nil {
+			return nil, fmt.Errorf("models: recorded event %d: %w", i, err)
+		}
+		if response == nil || event.Type == "message_start" {
+			response = &StreamingResponse{Model: string(event.Message.Model)}
+			responses = append(responses, response)
+		}
+		response.ProcessEvent(event)
+		emit(handler, event, response)
+	}
+	return responses, nil
+}
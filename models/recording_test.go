@@ -0,0 +1,66 @@
+package models_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/models"
+)
+
+func TestReplayRecording(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Thinking: "hmm", Text: "let me look", ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "x"}}}},
+		fakeapi.Turn{Text: "found it", InputTokens: 30},
+	)
+	var recording bytes.Buffer
+	client := server.Client(models.WithStreamRecording(&recording))
+	originals := []*models.StreamingResponse{}
+	for _, prompt := range []string{"look", "again"} {
+		response, err := client.StreamMessages(context.Background(), userMessages(prompt), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := response.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		originals = append(originals, response)
+	}
+
+	events, err := models.LoadRecording(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Time.IsZero() || !strings.Contains(string(events[0].Event), `"type":"message_start"`) {
+		t.Fatalf("unexpected recording %s", recording.String())
+	}
+
+	buffer := models.NewBufferHandler()
+	replayed, err := models.ReplayRecording(bytes.NewReader(recording.Bytes()), buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(replayed))
+	}
+	for i, response := range replayed {
+		original := originals[i]
+		if response.Model != original.Model || response.Content != original.Content || response.StopReason != original.StopReason ||
+			response.InputTokens != original.InputTokens || response.OutputTokens != original.OutputTokens {
+			t.Errorf("expected %+v, got %+v", original, response)
+		}
+		if !reflect.DeepEqual(response.Message.ToParam(), original.Message.ToParam()) {
+			t.Errorf("expected message %+v, got %+v", original.Message.ToParam(), response.Message.ToParam())
+		}
+	}
+	if buffer.Text() != "let me lookfound it" {
+		t.Errorf("unexpected replayed text %q", buffer.Text())
+	}
+
+	if _, err := models.ReplayRecording(strings.NewReader("{\"time\":\"2025-01-01T00:00:00Z\",\"event\":{}}\nnot json\n"), nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
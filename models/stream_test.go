@@ -0,0 +1,425 @@
+package models_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/cost"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/models"
+)
+
+func userMessages(text string) []anthropic.MessageParam {
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+}
+
+// lastMessage decodes the last message of a request
+func lastMessage(t *testing.T, request fakeapi.Request) anthropic.MessageParam {
+	t.Helper()
+	var message anthropic.MessageParam
+	if err := json.Unmarshal(request.Messages[len(request.Messages)-1], &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestStreamMessages_Prefill(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: `"a": 1}`})
+	deltas := ""
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("json please"),
+		models.TextHandler(func(delta string) { deltas += delta }),
+		models.WithPrefill("{ \n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != `{"a": 1}` || deltas != response.Content {
+		t.Errorf("unexpected content %q, deltas %q", response.Content, deltas)
+	}
+	if len(response.Message.Content) != 1 || response.Message.Content[0].Text != `{"a": 1}` {
+		t.Errorf("unexpected message %+v", response.Message.Content)
+	}
+	prefill := lastMessage(t, server.Requests()[0])
+	if prefill.Role != anthropic.MessageParamRoleAssistant || prefill.Content[0].OfText.Text != "{" {
+		t.Errorf("unexpected prefill message %+v", prefill)
+	}
+}
+
+func TestStreamMessages_CallOptions(t *testing.T) {
+	temperature := func(value float64) *float64 { return &value }
+	testcases := []struct {
+		name          string
+		options       []models.StreamOption
+		maxTokens     int64
+		temperature   *float64
+		stopSequences []string
+	}{
+		{name: "defaults", maxTokens: models.DefaultMaxTokens},
+		{name: "max tokens", options: []models.StreamOption{models.WithCallMaxTokens(50)}, maxTokens: 50},
+		{name: "zero max tokens keeps the client's", options: []models.StreamOption{models.WithCallMaxTokens(0)}, maxTokens: models.DefaultMaxTokens},
+		{name: "temperature", options: []models.StreamOption{models.WithTemperature(0.7)}, maxTokens: models.DefaultMaxTokens, temperature: temperature(0.7)},
+		{name: "zero temperature is sent", options: []models.StreamOption{models.WithTemperature(0)}, maxTokens: models.DefaultMaxTokens, temperature: temperature(0)},
+		{
+			name:          "stop sequences",
+			options:       []models.StreamOption{models.WithStopSequences("END", "\n\nHuman:")},
+			maxTokens:     models.DefaultMaxTokens,
+			stopSequences: []string{"END", "\n\nHuman:"},
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			server := fakeapi.NewServer(t, fakeapi.Turn{Text: "ok"})
+			response, err := server.Client().StreamMessages(context.Background(), userMessages("hi"),
+				models.TextHandler(func(string) {}), testcase.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := response.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			var request struct {
+				MaxTokens     int64    `json:"max_tokens"`
+				Temperature   *float64 `json:"temperature"`
+				StopSequences []string `json:"stop_sequences"`
+			}
+			if err := json.Unmarshal(server.Requests()[0].Raw, &request); err != nil {
+				t.Fatal(err)
+			}
+			if request.MaxTokens != testcase.maxTokens {
+				t.Errorf("expected max_tokens %d, got %d", testcase.maxTokens, request.MaxTokens)
+			}
+			if !reflect.DeepEqual(request.Temperature, testcase.temperature) {
+				t.Errorf("expected temperature %v, got %v", testcase.temperature, request.Temperature)
+			}
+			if !reflect.DeepEqual(request.StopSequences, testcase.stopSequences) {
+				t.Errorf("expected stop_sequences %q, got %q", testcase.stopSequences, request.StopSequences)
+			}
+		})
+	}
+}
+
+func TestStreamMessages_Continuation(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Text: "Hello ", StopReason: "max_tokens", InputTokens: 10, OutputTokens: 3},
+		fakeapi.Turn{Text: "wor", StopReason: "max_tokens", InputTokens: 12, OutputTokens: 2},
+		fakeapi.Turn{Text: "ld!", InputTokens: 14, OutputTokens: 1},
+	)
+	streamed := ""
+	handler := models.StreamHandlerFunc(func(event models.StreamEvent) {
+		if delta, ok := event.(models.TextDeltaEvent); ok {
+			streamed += delta.Text
+		}
+	})
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("greet"), handler,
+		models.WithContinuation(5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != "Hello world!" || response.StopReason != "end_turn" {
+		t.Errorf("unexpected content %q stop %q", response.Content, response.StopReason)
+	}
+	// the trailing space dropped from the partial message stays in the streamed text
+	if streamed != response.Content || response.Message.Content[0].Text != response.Content {
+		t.Errorf("expected the content as streamed %q, got %q and %q", streamed, response.Content, response.Message.Content[0].Text)
+	}
+	if response.InputTokens != 36 || response.OutputTokens != 6 {
+		t.Errorf("expected summed usage, got %d/%d", response.InputTokens, response.OutputTokens)
+	}
+	if response.Message.Usage.InputTokens != 36 || len(response.Message.Content) != 1 {
+		t.Errorf("unexpected message %+v", response.Message)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	partial := lastMessage(t, requests[1])
+	if partial.Role != anthropic.MessageParamRoleAssistant || partial.Content[0].OfText.Text != "Hello" {
+		t.Errorf("unexpected partial message %+v", partial)
+	}
+	if text := lastMessage(t, requests[2]).Content[0].OfText.Text; text != "Hello wor" {
+		t.Errorf("unexpected partial text %q", text)
+	}
+}
+
+func TestStreamMessages_ContinuationCap(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Text: "one", StopReason: "max_tokens"},
+		fakeapi.Turn{Text: " two", StopReason: "max_tokens"},
+	)
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("count"), nil,
+		models.WithContinuation(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != "one two" || response.StopReason != "max_tokens" {
+		t.Errorf("unexpected content %q stop %q", response.Content, response.StopReason)
+	}
+	if len(server.Requests()) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(server.Requests()))
+	}
+}
+
+func TestStreamMessages_Hooks(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "hi"})
+	registry := hooks.NewRegistry()
+	hooks.Add(registry, func(ctx context.Context, event *hooks.BeforeModelCall) {
+		event.Params.System = []anthropic.TextBlockParam{{Text: "added by a hook"}}
+	})
+	events := 0
+	hooks.Add(registry, func(ctx context.Context, event *hooks.ModelStreamEvent) {
+		events++
+	})
+	var after *hooks.AfterModelCall
+	hooks.Add(registry, func(ctx context.Context, event *hooks.AfterModelCall) {
+		after = event
+	})
+
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("hello"), nil, models.WithHooks(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if system := server.Requests()[0].System; len(system) != 1 || !strings.Contains(string(system[0]), "added by a hook") {
+		t.Errorf("unexpected system %s", system)
+	}
+	if events == 0 {
+		t.Error("expected stream events")
+	}
+	if after == nil || after.StopReason != "end_turn" || after.Message.Content[0].Text != "hi" {
+		t.Errorf("unexpected after event %+v", after)
+	}
+}
+
+func TestStreamMessages_CostBudget(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Text: "one", InputTokens: 1_000_000, OutputTokens: 100_000},
+	)
+	prices := cost.WithPrices(cost.PriceTable{models.DefaultModelId: {Input: 3, Output: 15}})
+	clientTracker := cost.NewTracker("client", prices)
+	tenantTracker := cost.NewTracker("tenant", prices, cost.WithBudget(4))
+	client := server.Client(models.WithCostTracker(clientTracker))
+
+	response, err := client.StreamMessages(context.Background(), userMessages("hi"), nil, models.WithCallCostTrackers(tenantTracker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tracker := range []*cost.Tracker{clientTracker, tenantTracker} {
+		if total := tracker.Total().Total; total < 4.4999 || total > 4.5001 {
+			t.Errorf("%s: expected $4.5, got %v", tracker.Name(), total)
+		}
+	}
+
+	// the tenant budget is spent, the next call is not sent
+	_, err = client.StreamMessages(context.Background(), userMessages("again"), nil, models.WithCallCostTrackers(tenantTracker))
+	var budgetErr *cost.BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Tracker != "tenant" {
+		t.Errorf("expected a budget error, got %v", err)
+	}
+	if len(server.Requests()) != 1 {
+		t.Errorf("expected 1 request, got %d", len(server.Requests()))
+	}
+
+	// calls that are not charged to the tenant still go through the client tracker
+	server.AddTurns(fakeapi.Turn{Text: "two"})
+	response, err = client.StreamMessages(context.Background(), userMessages("other tenant"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamMessages_UnpricedModel(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Text: "priced later", InputTokens: 10, OutputTokens: 5})
+	tracker := cost.NewTracker("client")
+	var logs bytes.Buffer
+	client := server.Client(
+		models.WithModelId("claude-3-opus-20240229"),
+		models.WithCostTracker(tracker),
+		models.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	response, err := client.StreamMessages(context.Background(), userMessages("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatalf("an unpriced model must not fail the call: %v", err)
+	}
+	if response.Message.Content[0].Text != "priced later" {
+		t.Errorf("unexpected response %+v", response.Message)
+	}
+	unpriced := tracker.Unpriced()["claude-3-opus-20240229"]
+	if unpriced.InputTokens != 10 || unpriced.OutputTokens != 5 || tracker.Total().Total != 0 {
+		t.Errorf("expected the usage recorded as unpriced, got %+v %+v", tracker.Unpriced(), tracker.Total())
+	}
+	if !strings.Contains(logs.String(), "model call not priced") {
+		t.Errorf("expected a warning, got %q", logs.String())
+	}
+}
+
+func eventTypes(events []models.StreamEvent) []string {
+	types := []string{}
+	for _, event := range events {
+		types = append(types, strings.TrimPrefix(fmt.Sprintf("%T", event), "models."))
+	}
+	return types
+}
+
+func TestStreamMessages_Handler(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Status: 529},
+		fakeapi.Turn{Thinking: "hmm", Text: "ok", ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "x"}}}},
+	)
+	buffer := models.NewBufferHandler()
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("hi"), buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"RetryEvent",
+		"MessageStartEvent",
+		"BlockStartEvent", "ThinkingDeltaEvent", "BlockStopEvent",
+		"BlockStartEvent", "TextDeltaEvent", "TextDeltaEvent", "BlockStopEvent",
+		"BlockStartEvent", "ToolInputDeltaEvent", "BlockStopEvent",
+		"UsageEvent",
+		"MessageStopEvent",
+	}
+	events := buffer.Events()
+	if types := eventTypes(events); !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	if retry := events[0].(models.RetryEvent); retry.Attempt != 1 || retry.StatusCode != 529 {
+		t.Errorf("unexpected retry %+v", retry)
+	}
+	if start := events[9].(models.BlockStartEvent); start.ToolUseID != "tu_1" || start.ToolName != "lookup" {
+		t.Errorf("unexpected block start %+v", start)
+	}
+	if stop := events[11].(models.BlockStopEvent); string(stop.Block.Input) != `{"q":"x"}` {
+		t.Errorf("unexpected tool input %s", stop.Block.Input)
+	}
+	if stop := events[13].(models.MessageStopEvent); stop.StopReason != "tool_use" {
+		t.Errorf("unexpected stop %+v", stop)
+	}
+	if buffer.Text() != "ok" {
+		t.Errorf("unexpected text %q", buffer.Text())
+	}
+}
+
+func TestStreamMessages_HandlerError(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Status: 400})
+	ch := make(chan models.StreamEvent, 10)
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("hi"), models.ChannelHandler(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err == nil {
+		t.Fatal("expected an error")
+	}
+	close(ch)
+	events := []models.StreamEvent{}
+	for event := range ch {
+		events = append(events, event)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %v", eventTypes(events))
+	}
+	if event, ok := events[0].(models.ErrorEvent); !ok || event.Err != response.Err {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestStreamMessages_Logger(t *testing.T) {
+	server := fakeapi.NewServer(t, fakeapi.Turn{Status: 529}, fakeapi.Turn{Text: "ok"})
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	response, err := server.Client(models.WithLogger(logger)).StreamMessages(context.Background(), userMessages("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buffer.String()
+	if strings.Contains(output, "test-key") {
+		t.Errorf("api key leaked: %s", output)
+	}
+	expected := []string{
+		`"msg":"anthropic client created"`,
+		`"api_key":"[REDACTED]"`,
+		`"msg":"model request retry","model":"claude-sonnet-4-5-20250929","attempt":1,"status_code":529`,
+		`"stop_reason":"end_turn","input_tokens":10,"output_tokens":5`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("expected %s in %s", line, output)
+		}
+	}
+}
+
+func TestStreamMessages_Timing(t *testing.T) {
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Thinking: "hmm", Text: "ok", ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "x"}}}},
+	)
+	response, err := server.Client().StreamMessages(context.Background(), userMessages("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.RequestStart.IsZero() || response.FirstEvent.Before(response.RequestStart) ||
+		response.FirstDelta.Before(response.FirstEvent) || response.Completed.Before(response.FirstDelta) {
+		t.Errorf("unexpected timestamps %s %s %s %s", response.RequestStart, response.FirstEvent, response.FirstDelta, response.Completed)
+	}
+	if response.TimeToFirstToken() <= 0 || response.Latency() < response.TimeToFirstToken() {
+		t.Errorf("unexpected ttft %s and latency %s", response.TimeToFirstToken(), response.Latency())
+	}
+	types := []string{}
+	for _, block := range response.Blocks {
+		types = append(types, block.Type)
+		if block.FirstDelta.IsZero() || block.Stop.Before(block.FirstDelta) {
+			t.Errorf("unexpected block timing %+v", block)
+		}
+	}
+	if expected := []string{"thinking", "text", "tool_use"}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected blocks %v, got %v", expected, types)
+	}
+	// the thinking delta is not a first token
+	if !response.FirstDelta.Equal(response.Blocks[1].FirstDelta) {
+		t.Errorf("expected the first text delta, got %s", response.FirstDelta)
+	}
+}
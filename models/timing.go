@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// BlockTiming times one content block of a response
+type BlockTiming struct {
+	// Index is the index of the block in the response it arrived in, continuations start again at 0
+	Index int
+	Type  string
+	Start time.Time
+	// FirstDelta is zero for blocks without deltas
+	FirstDelta time.Time
+	Stop       time.Time
+}
+
+// Duration is the time from the start to the stop of the block
+func (b BlockTiming) Duration() time.Duration {
+	if b.Stop.IsZero() {
+		return 0
+	}
+	return b.Stop.Sub(b.Start)
+}
+
+// TimeToFirstToken is the time from sending the request to the first text or tool input delta,
+// zero when no delta was received
+func (r *StreamingResponse) TimeToFirstToken() time.Duration {
+	if r.RequestStart.IsZero() || r.FirstDelta.IsZero() {
+		return 0
+	}
+	return r.FirstDelta.Sub(r.RequestStart)
+}
+
+// Latency is the time from sending the request to the end of the stream, retries included
+func (r *StreamingResponse) Latency() time.Duration {
+	if r.RequestStart.IsZero() || r.Completed.IsZero() {
+		return 0
+	}
+	return r.Completed.Sub(r.RequestStart)
+}
+
+// OutputTokensPerSecond is the generation throughput from the first delta to the end of the stream
+func (r *StreamingResponse) OutputTokensPerSecond() float64 {
+	if r.FirstDelta.IsZero() || r.Completed.IsZero() || !r.Completed.After(r.FirstDelta) {
+		return 0
+	}
+	return float64(r.OutputTokens) / r.Completed.Sub(r.FirstDelta).Seconds()
+}
+
+// recordTiming updates the timestamps with an event received at now
+func (r *StreamingResponse) recordTiming(event anthropic.MessageStreamEventUnion, now time.Time) {
+	if r.FirstEvent.IsZero() {
+		r.FirstEvent = now
+	}
+	switch event.Type {
+	case "content_block_start":
+		r.Blocks = append(r.Blocks, BlockTiming{Index: int(event.Index), Type: event.ContentBlock.Type, Start: now})
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" || event.Delta.Type == "input_json_delta" {
+			if r.FirstDelta.IsZero() {
+				r.FirstDelta = now
+			}
+		}
+		if block := r.block(int(event.Index)); block != nil && block.FirstDelta.IsZero() {
+			block.FirstDelta = now
+		}
+	case "content_block_stop":
+		if block := r.block(int(event.Index)); block != nil {
+			block.Stop = now
+		}
+	case "message_stop":
+		r.Completed = now
+	}
+}
+
+// block returns the timing of the last block with index
+func (r *StreamingResponse) block(index int) *BlockTiming {
+	for i := len(r.Blocks) - 1; i >= 0; i-- {
+		if r.Blocks[i].Index == index {
+			return &r.Blocks[i]
+		}
+	}
+	return nil
+}
+
+// mergeTiming keeps the first start and delta and the last completion of the parts
+func (r *StreamingResponse) mergeTiming(part *StreamingResponse) {
+	if r.RequestStart.IsZero() {
+		r.RequestStart = part.RequestStart
+	}
+	if r.FirstEvent.IsZero() {
+		r.FirstEvent = part.FirstEvent
+	}
+	if r.FirstDelta.IsZero() {
+		r.FirstDelta = part.FirstDelta
+	}
+	r.Completed = part.Completed
+	r.Blocks = append(r.Blocks, part.Blocks...)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamingResponse_Timing(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	response := &StreamingResponse{
+		OutputTokens: 100,
+		RequestStart: start,
+		FirstEvent:   start.Add(200 * time.Millisecond),
+		FirstDelta:   start.Add(500 * time.Millisecond),
+		Completed:    start.Add(2500 * time.Millisecond),
+		Blocks:       []BlockTiming{{Index: 0, Type: "text", Start: start.Add(300 * time.Millisecond), Stop: start.Add(2 * time.Second)}},
+	}
+	if ttft := response.TimeToFirstToken(); ttft != 500*time.Millisecond {
+		t.Errorf("expected 500ms, got %s", ttft)
+	}
+	if latency := response.Latency(); latency != 2500*time.Millisecond {
+		t.Errorf("expected 2.5s, got %s", latency)
+	}
+	if throughput := response.OutputTokensPerSecond(); throughput != 50 {
+		t.Errorf("expected 50 tokens/s, got %v", throughput)
+	}
+	if duration := response.Blocks[0].Duration(); duration != 1700*time.Millisecond {
+		t.Errorf("expected 1.7s, got %s", duration)
+	}
+
+	empty := &StreamingResponse{RequestStart: start}
+	if empty.TimeToFirstToken() != 0 || empty.Latency() != 0 || empty.OutputTokensPerSecond() != 0 {
+		t.Error("expected zero measurements without deltas")
+	}
+}
@@ -0,0 +1,521 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// FileRepository stores every session in its own directory
+//
+//	<root>/<session id>/session.json
+//	<root>/<session id>/agents/<agent id>/agent.json
+//	<root>/<session id>/agents/<agent id>/messages.jsonl
+//	<root>/<session id>/agents/<agent id>/branches.json
+//
+// Messages are appended to messages.jsonl, a last line cut off by a crash is ignored
+type FileRepository struct {
+	root string
+	mu   sync.RWMutex
+	// counts caches the number of stored messages per agent directory, so that appending does not read the history
+	counts map[string]int
+}
+
+func NewFileRepository(root string) (*FileRepository, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileRepository{root: root, counts: map[string]int{}}, nil
+}
+
+func (r *FileRepository) CreateSession(ctx context.Context, session *Session) error {
+	if err := validateID(session.ID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := r.sessionDir(session.ID)
+	if _, err := os.Stat(dir); err == nil {
+		return ErrAlreadyExists
+	}
+	now := time.Now().UTC()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	session.UpdatedAt = now
+	if err := os.MkdirAll(filepath.Join(dir, "agents"), 0o755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "session.json"), session)
+}
+
+func (r *FileRepository) ReadSession(ctx context.Context, sessionID string) (*Session, error) {
+	if err := validateID(sessionID); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.readSession(sessionID)
+}
+
+func (r *FileRepository) ListSessions(ctx context.Context, userID string, opts ListOptions) ([]Session, error) {
+	return r.findSessions(userID, func(Session) (bool, error) { return true, nil }, opts)
+}
+
+func (r *FileRepository) SearchSessions(ctx context.Context, userID string, query string, opts ListOptions) ([]Session, error) {
+	query = strings.ToLower(query)
+	return r.findSessions(userID, func(session Session) (bool, error) {
+		if strings.Contains(strings.ToLower(session.Title), query) {
+			return true, nil
+		}
+		agents, err := os.ReadDir(filepath.Join(r.sessionDir(session.ID), "agents"))
+		if err != nil {
+			return false, err
+		}
+		for _, agent := range agents {
+			messages, err := r.readMessages(session.ID, agent.Name())
+			if err != nil {
+				return false, err
+			}
+			for _, message := range messages {
+				param, err := message.ToMessageParam()
+				if err != nil {
+					return false, err
+				}
+				if strings.Contains(strings.ToLower(messageText(param)), query) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}, opts)
+}
+
+func (r *FileRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	if err := validateID(sessionID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := r.sessionDir(sessionID)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	for key := range r.counts {
+		if strings.HasPrefix(key, dir+string(filepath.Separator)) {
+			delete(r.counts, key)
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+func (r *FileRepository) CreateAgent(ctx context.Context, agent *SessionAgent) error {
+	if err := validateID(agent.SessionID); err != nil {
+		return err
+	}
+	if err := validateID(agent.AgentID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.readSession(agent.SessionID); err != nil {
+		return err
+	}
+	dir := r.agentDir(agent.SessionID, agent.AgentID)
+	if _, err := os.Stat(dir); err == nil {
+		return ErrAlreadyExists
+	}
+	now := time.Now().UTC()
+	if agent.CreatedAt.IsZero() {
+		agent.CreatedAt = now
+	}
+	agent.UpdatedAt = now
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "agent.json"), agent)
+}
+
+func (r *FileRepository) ReadAgent(ctx context.Context, sessionID string, agentID string) (*SessionAgent, error) {
+	if err := validateID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateID(agentID); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	agent := &SessionAgent{}
+	if err := readJSON(filepath.Join(r.agentDir(sessionID, agentID), "agent.json"), agent); err != nil {
+		return nil, err
+	}
+	// a nil state is written as null
+	if string(agent.State) == "null" {
+		agent.State = nil
+	}
+	return agent, nil
+}
+
+func (r *FileRepository) UpdateAgent(ctx context.Context, agent *SessionAgent) error {
+	if err := validateID(agent.SessionID); err != nil {
+		return err
+	}
+	if err := validateID(agent.AgentID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(r.agentDir(agent.SessionID, agent.AgentID), "agent.json")
+	existing := &SessionAgent{}
+	if err := readJSON(path, existing); err != nil {
+		return err
+	}
+	agent.CreatedAt = existing.CreatedAt
+	agent.UpdatedAt = time.Now().UTC()
+	if err := writeJSON(path, agent); err != nil {
+		return err
+	}
+	return r.touchSession(agent.SessionID, agent.UpdatedAt)
+}
+
+func (r *FileRepository) AppendMessages(ctx context.Context, sessionID string, agentID string, messages []anthropic.MessageParam) ([]SessionMessage, error) {
+	if err := validateID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateID(agentID); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := r.agentDir(sessionID, agentID)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	count, ok := r.counts[dir]
+	if !ok {
+		var err error
+		if count, err = r.repairMessages(dir); err != nil {
+			return nil, err
+		}
+	}
+	appended, err := encodeMessages(sessionID, agentID, count, messages)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, message := range appended {
+		if err := encoder.Encode(message); err != nil {
+			return nil, err
+		}
+	}
+	if err := appendFile(filepath.Join(dir, "messages.jsonl"), buf.Bytes()); err != nil {
+		// the file may hold part of the messages now, it is checked again on the next append
+		delete(r.counts, dir)
+		return nil, err
+	}
+	r.counts[dir] = count + len(appended)
+	if err := r.touchSession(sessionID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return appended, nil
+}
+
+func (r *FileRepository) ListMessages(ctx context.Context, sessionID string, agentID string, opts ListOptions) ([]SessionMessage, error) {
+	if err := validateID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateID(agentID); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := os.Stat(r.agentDir(sessionID, agentID)); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	messages, err := r.readMessages(sessionID, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(messages, opts), nil
+}
+
+func (r *FileRepository) SaveBranches(ctx context.Context, branches ...*SessionBranch) error {
+	if len(branches) == 0 {
+		return nil
+	}
+	sessionID, agentID, err := branchesOwner(branches)
+	if err != nil {
+		return err
+	}
+	if err := validateID(sessionID); err != nil {
+		return err
+	}
+	if err := validateID(agentID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := r.agentDir(sessionID, agentID)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	stored, err := r.readBranches(sessionID, agentID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, branch := range branches {
+		branch.UpdatedAt = now
+		replaced := false
+		for i, existing := range stored {
+			if existing.BranchID == branch.BranchID {
+				branch.CreatedAt = existing.CreatedAt
+				stored[i] = *branch
+				replaced = true
+			}
+		}
+		if !replaced {
+			if branch.CreatedAt.IsZero() {
+				branch.CreatedAt = now
+			}
+			stored = append(stored, *branch)
+		}
+	}
+	// the file is replaced at once, so either every branch is saved or none
+	return writeJSON(filepath.Join(dir, "branches.json"), stored)
+}
+
+func (r *FileRepository) ListBranches(ctx context.Context, sessionID string, agentID string) ([]SessionBranch, error) {
+	if err := validateID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateID(agentID); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := os.Stat(r.agentDir(sessionID, agentID)); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return r.readBranches(sessionID, agentID)
+}
+
+func (r *FileRepository) sessionDir(sessionID string) string {
+	return filepath.Join(r.root, sessionID)
+}
+
+func (r *FileRepository) agentDir(sessionID string, agentID string) string {
+	return filepath.Join(r.root, sessionID, "agents", agentID)
+}
+
+func (r *FileRepository) readSession(sessionID string) (*Session, error) {
+	session := &Session{}
+	if err := readJSON(filepath.Join(r.sessionDir(sessionID), "session.json"), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *FileRepository) touchSession(sessionID string, updatedAt time.Time) error {
+	session, err := r.readSession(sessionID)
+	if err != nil {
+		return err
+	}
+	session.UpdatedAt = updatedAt
+	return writeJSON(filepath.Join(r.sessionDir(sessionID), "session.json"), session)
+}
+
+func (r *FileRepository) readMessages(sessionID string, agentID string) ([]SessionMessage, error) {
+	messages, _, err := readMessageFile(filepath.Join(r.agentDir(sessionID, agentID), "messages.jsonl"))
+	return messages, err
+}
+
+// repairMessages cuts a torn last line off the history in dir, so that appended messages start on their own line,
+// and returns the number of stored messages
+func (r *FileRepository) repairMessages(dir string) (int, error) {
+	path := filepath.Join(dir, "messages.jsonl")
+	messages, size, err := readMessageFile(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() > size {
+		if err := os.Truncate(path, size); err != nil {
+			return 0, err
+		}
+	}
+	return len(messages), nil
+}
+
+// readMessageFile reads the messages of a history and the size of its complete lines
+// A last line without a newline was cut off while it was appended and is ignored
+func readMessageFile(path string) ([]SessionMessage, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []SessionMessage{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	messages := []SessionMessage{}
+	var size int64
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return messages, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		size += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var message SessionMessage
+		if err := json.Unmarshal(line, &message); err != nil {
+			return nil, 0, err
+		}
+		messages = append(messages, message)
+	}
+}
+
+func (r *FileRepository) readBranches(sessionID string, agentID string) ([]SessionBranch, error) {
+	branches := []SessionBranch{}
+	err := readJSON(filepath.Join(r.agentDir(sessionID, agentID), "branches.json"), &branches)
+	if errors.Is(err, ErrNotFound) {
+		return []SessionBranch{}, nil
+	}
+	return branches, err
+}
+
+func (r *FileRepository) findSessions(userID string, match func(Session) (bool, error), opts ListOptions) ([]Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries, err := os.ReadDir(r.root)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		session, err := r.readSession(entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if session.UserID != userID {
+			continue
+		}
+		ok, err := match(*session)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return paginate(sessions, opts), nil
+}
+
+func validateID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("session: invalid id %q", id)
+	}
+	return nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// appendFile writes data at the end of path and syncs it, the file is cut back to its old size when that fails
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(info.Size())
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
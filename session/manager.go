@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// historyPageSize is how many messages Manager loads per query
+const historyPageSize = 100
+
+// Manager keeps the history of agents in one session in sync with a Repository
+// Switching storage only means passing a different Repository to NewManager
+type Manager struct {
+	repo      Repository
+	sessionID string
+	userID    string
+}
+
+func NewManager(repo Repository, sessionID string, userID string) *Manager {
+	return &Manager{
+		repo:      repo,
+		sessionID: sessionID,
+		userID:    userID,
+	}
+}
+
+func (m *Manager) SessionID() string {
+	return m.sessionID
+}
+
+func (m *Manager) Repository() Repository {
+	return m.repo
+}
+
+// InitializeAgent creates the session and agent when they do not exist yet
+// and returns the history that was stored for the agent
+func (m *Manager) InitializeAgent(ctx context.Context, agentID string) ([]anthropic.MessageParam, error) {
+	err := m.repo.CreateSession(ctx, &Session{ID: m.sessionID, UserID: m.userID})
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return nil, err
+	}
+	err = m.repo.CreateAgent(ctx, &SessionAgent{SessionID: m.sessionID, AgentID: agentID})
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return nil, err
+	}
+
+	history := []anthropic.MessageParam{}
+	for offset := 0; ; offset += historyPageSize {
+		page, err := m.LoadMessages(ctx, agentID, ListOptions{Limit: historyPageSize, Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, page...)
+		if len(page) < historyPageSize {
+			return history, nil
+		}
+	}
+}
+
+// AppendMessages persists messages added to the agent's history
+func (m *Manager) AppendMessages(ctx context.Context, agentID string, messages ...anthropic.MessageParam) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	_, err := m.repo.AppendMessages(ctx, m.sessionID, agentID, messages)
+	return err
+}
+
+// LoadState returns the state stored for the agent, nil when nothing was saved yet
+func (m *Manager) LoadState(ctx context.Context, agentID string) (json.RawMessage, error) {
+	agent, err := m.repo.ReadAgent(ctx, m.sessionID, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return agent.State, nil
+}
+
+// SaveState replaces the state stored for the agent
+func (m *Manager) SaveState(ctx context.Context, agentID string, state json.RawMessage) error {
+	return m.repo.UpdateAgent(ctx, &SessionAgent{SessionID: m.sessionID, AgentID: agentID, State: state})
+}
+
+// LoadMessages returns one page of the agent's history
+func (m *Manager) LoadMessages(ctx context.Context, agentID string, opts ListOptions) ([]anthropic.MessageParam, error) {
+	stored, err := m.repo.ListMessages(ctx, m.sessionID, agentID, opts)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]anthropic.MessageParam, 0, len(stored))
+	for _, message := range stored {
+		param, err := message.ToMessageParam()
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, param)
+	}
+	return messages, nil
+}
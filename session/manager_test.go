@@ -0,0 +1,72 @@
+package session
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManager_InitializeAgent(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		manager := NewManager(repo, "s1", "alice")
+
+		history, err := manager.InitializeAgent(ctx, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 0 {
+			t.Fatalf("expected empty history, got %d messages", len(history))
+		}
+
+		texts := []string{}
+		for i := 0; i < historyPageSize+5; i++ {
+			texts = append(texts, "message")
+		}
+		if err := manager.AppendMessages(ctx, "default", textMessages(texts...)...); err != nil {
+			t.Fatal(err)
+		}
+
+		// a second manager over the same repository resumes the session
+		history, err = NewManager(repo, "s1", "alice").InitializeAgent(ctx, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != len(texts) {
+			t.Errorf("expected %d messages, got %d", len(texts), len(history))
+		}
+		sessions, err := repo.ListSessions(ctx, "alice", ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 {
+			t.Errorf("expected 1 session, got %d", len(sessions))
+		}
+	})
+}
+
+func TestManager_State(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		manager := NewManager(repo, "s1", "alice")
+		if _, err := manager.InitializeAgent(ctx, "default"); err != nil {
+			t.Fatal(err)
+		}
+		state, err := manager.LoadState(ctx, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state) != 0 {
+			t.Errorf("expected no state, got %s", state)
+		}
+		if err := manager.SaveState(ctx, "default", []byte(`{"user_id":"u1"}`)); err != nil {
+			t.Fatal(err)
+		}
+		state, err = manager.LoadState(ctx, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(state) != `{"user_id":"u1"}` {
+			t.Errorf("unexpected state %s", state)
+		}
+	})
+}
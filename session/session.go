@@ -0,0 +1,152 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/codec"
+)
+
+var (
+	ErrNotFound      = errors.New("session: not found")
+	ErrAlreadyExists = errors.New("session: already exists")
+)
+
+// Session is a single conversation owned by a user
+type Session struct {
+	ID        string
+	UserID    string
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SessionAgent is the persisted state of one agent taking part in a session
+type SessionAgent struct {
+	SessionID string
+	AgentID   string
+	State     json.RawMessage
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SessionMessage is a single message of an agent's history
+// Message holds the versioned encoding written by codec.MarshalMessage
+type SessionMessage struct {
+	SessionID string
+	AgentID   string
+	Index     int
+	Message   json.RawMessage
+	CreatedAt time.Time
+}
+
+// ToMessageParam decodes the stored message
+func (m SessionMessage) ToMessageParam() (anthropic.MessageParam, error) {
+	return codec.UnmarshalMessage(m.Message)
+}
+
+// SessionBranch is one line of an agent's conversation tree
+// The branch shares the first ForkIndex messages of its parent and continues
+// with the messages at MessageIndexes in the agent's history
+type SessionBranch struct {
+	SessionID      string
+	AgentID        string
+	BranchID       string
+	ParentID       string
+	ForkIndex      int
+	MessageIndexes []int
+	Current        bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// ListOptions paginates list and search calls, a zero Limit means no limit
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// Repository stores sessions, agents and their message history
+// FileRepository and SQLiteRepository both implement it
+type Repository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	ReadSession(ctx context.Context, sessionID string) (*Session, error)
+	// ListSessions returns the sessions of a user, most recently updated first
+	ListSessions(ctx context.Context, userID string, opts ListOptions) ([]Session, error)
+	// SearchSessions matches query against session titles and message contents
+	SearchSessions(ctx context.Context, userID string, query string, opts ListOptions) ([]Session, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+
+	CreateAgent(ctx context.Context, agent *SessionAgent) error
+	ReadAgent(ctx context.Context, sessionID string, agentID string) (*SessionAgent, error)
+	UpdateAgent(ctx context.Context, agent *SessionAgent) error
+
+	// AppendMessages stores all messages or none of them
+	AppendMessages(ctx context.Context, sessionID string, agentID string, messages []anthropic.MessageParam) ([]SessionMessage, error)
+	// ListMessages returns the history of an agent in order
+	ListMessages(ctx context.Context, sessionID string, agentID string, opts ListOptions) ([]SessionMessage, error)
+
+	// SaveBranches creates the branches of one agent or replaces the stored ones with the same ids,
+	// it saves all of them or none
+	SaveBranches(ctx context.Context, branches ...*SessionBranch) error
+	// ListBranches returns the branches of an agent in creation order
+	ListBranches(ctx context.Context, sessionID string, agentID string) ([]SessionBranch, error)
+}
+
+// branchesOwner returns the session and agent of branches, which must all belong to the same agent
+func branchesOwner(branches []*SessionBranch) (string, string, error) {
+	sessionID, agentID := branches[0].SessionID, branches[0].AgentID
+	for _, branch := range branches[1:] {
+		if branch.SessionID != sessionID || branch.AgentID != agentID {
+			return "", "", fmt.Errorf("session: branches of agent %q and %q saved together", agentID, branch.AgentID)
+		}
+	}
+	return sessionID, agentID, nil
+}
+
+func encodeMessages(sessionID string, agentID string, start int, messages []anthropic.MessageParam) ([]SessionMessage, error) {
+	now := time.Now().UTC()
+	encoded := make([]SessionMessage, 0, len(messages))
+	for i, message := range messages {
+		data, err := codec.MarshalMessage(message)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, SessionMessage{
+			SessionID: sessionID,
+			AgentID:   agentID,
+			Index:     start + i,
+			Message:   data,
+			CreatedAt: now,
+		})
+	}
+	return encoded, nil
+}
+
+// messageText joins the text blocks of a message, it is what search matches against
+func messageText(message anthropic.MessageParam) string {
+	var parts []string
+	for _, block := range message.Content {
+		if block.OfText != nil {
+			parts = append(parts, block.OfText.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// paginate applies opts to a slice that is already sorted
+func paginate[T any](items []T, opts ListOptions) []T {
+	if opts.Offset >= len(items) {
+		return []T{}
+	}
+	items = items[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(items) {
+		items = items[:opts.Limit]
+	}
+	return items
+}
@@ -0,0 +1,376 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	_ "modernc.org/sqlite"
+)
+
+// repositoryFactories lists every Repository implementation the shared tests run against
+var repositoryFactories = []struct {
+	name string
+	new  func(t *testing.T) Repository
+}{
+	{
+		name: "file",
+		new: func(t *testing.T) Repository {
+			repo, err := NewFileRepository(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return repo
+		},
+	},
+	{
+		name: "sqlite",
+		new: func(t *testing.T) Repository {
+			// the package does not import a driver, the tests use the pure Go modernc.org/sqlite
+			if !slices.Contains(sql.Drivers(), "sqlite") {
+				t.Fatal("the sqlite driver is not registered")
+			}
+			db, err := sql.Open("sqlite", ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// every connection to :memory: is a new database
+			db.SetMaxOpenConns(1)
+			t.Cleanup(func() { db.Close() })
+			repo, err := NewSQLiteRepository(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return repo
+		},
+	},
+}
+
+func forEachRepository(t *testing.T, test func(t *testing.T, repo Repository)) {
+	for _, factory := range repositoryFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			test(t, factory.new(t))
+		})
+	}
+}
+
+func textMessages(texts ...string) []anthropic.MessageParam {
+	messages := []anthropic.MessageParam{}
+	for i, text := range texts {
+		if i%2 == 0 {
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(text)))
+		} else {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(text)))
+		}
+	}
+	return messages
+}
+
+func createSessionWithAgent(t *testing.T, repo Repository, sessionID string, userID string, title string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := repo.CreateSession(ctx, &Session{ID: sessionID, UserID: userID, Title: title}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateAgent(ctx, &SessionAgent{SessionID: sessionID, AgentID: "default"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sessionIDs(sessions []Session) []string {
+	ids := []string{}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func TestRepository_Sessions(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		if err := repo.CreateSession(ctx, &Session{ID: "s1", UserID: "alice", Title: "first"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.CreateSession(ctx, &Session{ID: "s1", UserID: "alice"}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("expected ErrAlreadyExists, got %v", err)
+		}
+		session, err := repo.ReadSession(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.UserID != "alice" || session.Title != "first" || session.CreatedAt.IsZero() {
+			t.Errorf("unexpected session %+v", session)
+		}
+		if _, err := repo.ReadSession(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if err := repo.DeleteSession(ctx, "s1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.ReadSession(ctx, "s1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := repo.DeleteSession(ctx, "s1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRepository_ListAndSearchSessions(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		createSessionWithAgent(t, repo, "s1", "alice", "Trip to Kyoto")
+		createSessionWithAgent(t, repo, "s2", "alice", "Quaternions")
+		createSessionWithAgent(t, repo, "s3", "bob", "Kyoto food")
+		time.Sleep(time.Millisecond)
+		if _, err := repo.AppendMessages(ctx, "s2", "default", textMessages("what is a rotation matrix?", "a 100% linear map")); err != nil {
+			t.Fatal(err)
+		}
+
+		testcases := []struct {
+			name     string
+			query    string
+			opts     ListOptions
+			expected []string
+		}{
+			{name: "list most recently updated first", expected: []string{"s2", "s1"}},
+			{name: "list with limit", opts: ListOptions{Limit: 1}, expected: []string{"s2"}},
+			{name: "list with offset", opts: ListOptions{Offset: 1}, expected: []string{"s1"}},
+			{name: "search title", query: "kyoto", expected: []string{"s1"}},
+			{name: "search message content", query: "rotation", expected: []string{"s2"}},
+			{name: "search escapes wildcards", query: "100%", expected: []string{"s2"}},
+			{name: "search without match", query: "paris", expected: []string{}},
+		}
+		for _, testcase := range testcases {
+			t.Run(testcase.name, func(t *testing.T) {
+				var sessions []Session
+				var err error
+				if testcase.query == "" {
+					sessions, err = repo.ListSessions(ctx, "alice", testcase.opts)
+				} else {
+					sessions, err = repo.SearchSessions(ctx, "alice", testcase.query, testcase.opts)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := sessionIDs(sessions); !slices.Equal(got, testcase.expected) {
+					t.Errorf("expected %v, got %v", testcase.expected, got)
+				}
+			})
+		}
+	})
+}
+
+func TestRepository_Agents(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		if err := repo.CreateAgent(ctx, &SessionAgent{SessionID: "missing", AgentID: "a"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for missing session, got %v", err)
+		}
+		createSessionWithAgent(t, repo, "s1", "alice", "")
+		if err := repo.CreateAgent(ctx, &SessionAgent{SessionID: "s1", AgentID: "default"}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("expected ErrAlreadyExists, got %v", err)
+		}
+		if err := repo.UpdateAgent(ctx, &SessionAgent{SessionID: "s1", AgentID: "default", State: []byte(`{"cart":["apple"]}`)}); err != nil {
+			t.Fatal(err)
+		}
+		agent, err := repo.ReadAgent(ctx, "s1", "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(agent.State) != `{"cart":["apple"]}` {
+			t.Errorf("unexpected state %s", agent.State)
+		}
+		if err := repo.UpdateAgent(ctx, &SessionAgent{SessionID: "s1", AgentID: "other"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRepository_Messages(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		createSessionWithAgent(t, repo, "s1", "alice", "")
+		if _, err := repo.AppendMessages(ctx, "s1", "missing", textMessages("hi")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, err := repo.AppendMessages(ctx, "s1", "default", textMessages("one", "two")); err != nil {
+			t.Fatal(err)
+		}
+		appended, err := repo.AppendMessages(ctx, "s1", "default", textMessages("three", "four", "five"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appended[0].Index != 2 || appended[2].Index != 4 {
+			t.Errorf("expected indexes to continue the history, got %d..%d", appended[0].Index, appended[2].Index)
+		}
+
+		testcases := []struct {
+			name     string
+			opts     ListOptions
+			expected []string
+		}{
+			{name: "all", expected: []string{"one", "two", "three", "four", "five"}},
+			{name: "first page", opts: ListOptions{Limit: 2}, expected: []string{"one", "two"}},
+			{name: "second page", opts: ListOptions{Limit: 2, Offset: 2}, expected: []string{"three", "four"}},
+			{name: "past the end", opts: ListOptions{Limit: 2, Offset: 10}, expected: []string{}},
+		}
+		for _, testcase := range testcases {
+			t.Run(testcase.name, func(t *testing.T) {
+				messages, err := repo.ListMessages(ctx, "s1", "default", testcase.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, message := range messages {
+					param, err := message.ToMessageParam()
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, messageText(param))
+				}
+				if !slices.Equal(got, testcase.expected) {
+					t.Errorf("expected %v, got %v", testcase.expected, got)
+				}
+			})
+		}
+	})
+}
+
+func TestRepository_Branches(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo Repository) {
+		ctx := context.Background()
+		createSessionWithAgent(t, repo, "s1", "alice", "")
+		if err := repo.SaveBranches(ctx, &SessionBranch{SessionID: "s1", AgentID: "missing", BranchID: "main"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		branches := []*SessionBranch{
+			{SessionID: "s1", AgentID: "default", BranchID: "main", MessageIndexes: []int{0, 1}},
+			{SessionID: "s1", AgentID: "default", BranchID: "edit", ParentID: "main", ForkIndex: 1, MessageIndexes: []int{2}, Current: true},
+		}
+		if err := repo.SaveBranches(ctx, branches...); err != nil {
+			t.Fatal(err)
+		}
+		// saving again replaces the branch
+		branches[0].MessageIndexes = []int{0, 1, 3}
+		if err := repo.SaveBranches(ctx, branches[0]); err != nil {
+			t.Fatal(err)
+		}
+		// branches of different agents are not saved together
+		other := &SessionBranch{SessionID: "s1", AgentID: "other", BranchID: "main"}
+		if err := repo.SaveBranches(ctx, &SessionBranch{SessionID: "s1", AgentID: "default", BranchID: "third"}, other); err == nil {
+			t.Error("expected branches of different agents to be rejected")
+		}
+
+		stored, err := repo.ListBranches(ctx, "s1", "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2 {
+			t.Fatalf("expected 2 branches, got %d", len(stored))
+		}
+		if stored[0].BranchID != "main" || !slices.Equal(stored[0].MessageIndexes, []int{0, 1, 3}) || stored[0].Current {
+			t.Errorf("unexpected main branch %+v", stored[0])
+		}
+		if stored[1].BranchID != "edit" || stored[1].ParentID != "main" || stored[1].ForkIndex != 1 || !stored[1].Current {
+			t.Errorf("unexpected edit branch %+v", stored[1])
+		}
+	})
+}
+
+func TestFileRepository_InvalidID(t *testing.T) {
+	repo, err := NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []string{"", "..", "a/b", `a\b`}
+	for _, testcase := range testcases {
+		if err := repo.CreateSession(context.Background(), &Session{ID: testcase}); err == nil {
+			t.Errorf("expected error for id %q", testcase)
+		}
+	}
+}
+
+func TestFileRepository_TornMessage(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	repo, err := NewFileRepository(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createSessionWithAgent(t, repo, "s1", "alice", "")
+	if _, err := repo.AppendMessages(ctx, "s1", "default", textMessages("one", "two")); err != nil {
+		t.Fatal(err)
+	}
+	// a crash while appending leaves part of a line behind
+	path := filepath.Join(root, "s1", "agents", "default", "messages.jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"SessionID":"s1","Age`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	reopened, err := NewFileRepository(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages, err := reopened.ListMessages(ctx, "s1", "default", ListOptions{}); err != nil || len(messages) != 2 {
+		t.Fatalf("expected the torn line to be ignored, got %d messages and %v", len(messages), err)
+	}
+	appended, err := reopened.AppendMessages(ctx, "s1", "default", textMessages("three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := reopened.ListMessages(ctx, "s1", "default", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appended[0].Index != 2 || len(messages) != 3 {
+		t.Errorf("expected the message to replace the torn line, got index %d and %d messages", appended[0].Index, len(messages))
+	}
+
+	// a session created again with the same id starts a new history
+	if err := reopened.DeleteSession(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	createSessionWithAgent(t, reopened, "s1", "alice", "")
+	if appended, err := reopened.AppendMessages(ctx, "s1", "default", textMessages("again")); err != nil || appended[0].Index != 0 {
+		t.Errorf("expected index 0, got %+v and %v", appended, err)
+	}
+}
+
+func TestSessionMessage_ToMessageParam(t *testing.T) {
+	testcases := []struct {
+		name    string
+		message string
+	}{
+		{
+			name:    "versioned encoding",
+			message: `{"schema_version":1,"role":"user","content":[{"type":"text","text":"hello"}]}`,
+		},
+		{
+			name:    "sdk encoding written before the codec existed",
+			message: `{"content":[{"text":"hello","type":"text"}],"role":"user"}`,
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			param, err := SessionMessage{Message: []byte(testcase.message)}.ToMessageParam()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if messageText(param) != "hello" || param.Role != anthropic.MessageParamRoleUser {
+				t.Errorf("unexpected message %+v", param)
+			}
+		})
+	}
+}
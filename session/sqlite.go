@@ -0,0 +1,482 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+// sqliteSchema is applied by NewSQLiteRepository, every statement is idempotent
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		title      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS sessions_user_updated ON sessions (user_id, updated_at DESC)`,
+	`CREATE TABLE IF NOT EXISTS agents (
+		session_id TEXT NOT NULL,
+		agent_id   TEXT NOT NULL,
+		state      BLOB,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (session_id, agent_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS messages (
+		session_id   TEXT NOT NULL,
+		agent_id     TEXT NOT NULL,
+		idx          INTEGER NOT NULL,
+		message      BLOB NOT NULL,
+		content_text TEXT NOT NULL DEFAULT '',
+		created_at   INTEGER NOT NULL,
+		PRIMARY KEY (session_id, agent_id, idx)
+	)`,
+	`CREATE TABLE IF NOT EXISTS branches (
+		session_id      TEXT NOT NULL,
+		agent_id        TEXT NOT NULL,
+		branch_id       TEXT NOT NULL,
+		parent_id       TEXT NOT NULL DEFAULT '',
+		fork_index      INTEGER NOT NULL,
+		message_indexes TEXT NOT NULL,
+		is_current      INTEGER NOT NULL DEFAULT 0,
+		created_at      INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL,
+		PRIMARY KEY (session_id, agent_id, branch_id)
+	)`,
+}
+
+// SQLiteRepository stores sessions in SQLite tables for sessions, agents, messages and branches
+//
+// The repository only depends on database/sql, open db with a pure Go driver
+// such as modernc.org/sqlite to stay free of cgo:
+//
+//	db, err := sql.Open("sqlite", "sessions.db")
+//	repo, err := session.NewSQLiteRepository(ctx, db)
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(ctx context.Context, db *sql.DB) (*SQLiteRepository, error) {
+	for _, statement := range sqliteSchema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) CreateSession(ctx context.Context, session *Session) error {
+	now := time.Now().UTC()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	session.UpdatedAt = now
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		exists, err := rowExists(ctx, tx, `SELECT 1 FROM sessions WHERE id = ?`, session.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyExists
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO sessions (id, user_id, title, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			session.ID, session.UserID, session.Title, toUnix(session.CreatedAt), toUnix(session.UpdatedAt),
+		)
+		return err
+	})
+}
+
+func (r *SQLiteRepository) ReadSession(ctx context.Context, sessionID string) (*Session, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, title, created_at, updated_at FROM sessions WHERE id = ?`, sessionID,
+	)
+	session, err := scanSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return session, err
+}
+
+func (r *SQLiteRepository) ListSessions(ctx context.Context, userID string, opts ListOptions) ([]Session, error) {
+	return r.querySessions(ctx,
+		`SELECT id, user_id, title, created_at, updated_at FROM sessions
+		WHERE user_id = ?
+		ORDER BY updated_at DESC LIMIT ? OFFSET ?`,
+		userID, sqlLimit(opts), opts.Offset,
+	)
+}
+
+func (r *SQLiteRepository) SearchSessions(ctx context.Context, userID string, query string, opts ListOptions) ([]Session, error) {
+	pattern := "%" + escapeLike(query) + "%"
+	return r.querySessions(ctx,
+		`SELECT id, user_id, title, created_at, updated_at FROM sessions s
+		WHERE s.user_id = ? AND (
+			s.title LIKE ? ESCAPE '\' OR EXISTS (
+				SELECT 1 FROM messages m WHERE m.session_id = s.id AND m.content_text LIKE ? ESCAPE '\'
+			)
+		)
+		ORDER BY s.updated_at DESC LIMIT ? OFFSET ?`,
+		userID, pattern, pattern, sqlLimit(opts), opts.Offset,
+	)
+}
+
+func (r *SQLiteRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, sessionID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		for _, table := range []string{"agents", "messages", "branches"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE session_id = ?`, sessionID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) CreateAgent(ctx context.Context, agent *SessionAgent) error {
+	now := time.Now().UTC()
+	if agent.CreatedAt.IsZero() {
+		agent.CreatedAt = now
+	}
+	agent.UpdatedAt = now
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		exists, err := rowExists(ctx, tx, `SELECT 1 FROM sessions WHERE id = ?`, agent.SessionID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		exists, err = rowExists(ctx, tx,
+			`SELECT 1 FROM agents WHERE session_id = ? AND agent_id = ?`, agent.SessionID, agent.AgentID,
+		)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyExists
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO agents (session_id, agent_id, state, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			agent.SessionID, agent.AgentID, []byte(agent.State), toUnix(agent.CreatedAt), toUnix(agent.UpdatedAt),
+		)
+		return err
+	})
+}
+
+func (r *SQLiteRepository) ReadAgent(ctx context.Context, sessionID string, agentID string) (*SessionAgent, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT session_id, agent_id, state, created_at, updated_at FROM agents WHERE session_id = ? AND agent_id = ?`,
+		sessionID, agentID,
+	)
+	agent := &SessionAgent{}
+	var state []byte
+	var createdAt, updatedAt int64
+	err := row.Scan(&agent.SessionID, &agent.AgentID, &state, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	agent.State = state
+	agent.CreatedAt = fromUnix(createdAt)
+	agent.UpdatedAt = fromUnix(updatedAt)
+	return agent, nil
+}
+
+func (r *SQLiteRepository) UpdateAgent(ctx context.Context, agent *SessionAgent) error {
+	updatedAt := time.Now().UTC()
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE agents SET state = ?, updated_at = ? WHERE session_id = ? AND agent_id = ?`,
+			[]byte(agent.State), toUnix(updatedAt), agent.SessionID, agent.AgentID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		var createdAt int64
+		if err := tx.QueryRowContext(ctx,
+			`SELECT created_at FROM agents WHERE session_id = ? AND agent_id = ?`, agent.SessionID, agent.AgentID,
+		).Scan(&createdAt); err != nil {
+			return err
+		}
+		agent.CreatedAt = fromUnix(createdAt)
+		agent.UpdatedAt = updatedAt
+		return touchSessionTx(ctx, tx, agent.SessionID, updatedAt)
+	})
+}
+
+func (r *SQLiteRepository) AppendMessages(ctx context.Context, sessionID string, agentID string, messages []anthropic.MessageParam) ([]SessionMessage, error) {
+	var appended []SessionMessage
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		exists, err := rowExists(ctx, tx,
+			`SELECT 1 FROM agents WHERE session_id = ? AND agent_id = ?`, sessionID, agentID,
+		)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		var next int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT COALESCE(MAX(idx) + 1, 0) FROM messages WHERE session_id = ? AND agent_id = ?`, sessionID, agentID,
+		).Scan(&next); err != nil {
+			return err
+		}
+		appended, err = encodeMessages(sessionID, agentID, next, messages)
+		if err != nil {
+			return err
+		}
+		for i, message := range appended {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO messages (session_id, agent_id, idx, message, content_text, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+				message.SessionID, message.AgentID, message.Index, []byte(message.Message), messageText(messages[i]), toUnix(message.CreatedAt),
+			); err != nil {
+				return err
+			}
+		}
+		return touchSessionTx(ctx, tx, sessionID, time.Now().UTC())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appended, nil
+}
+
+func (r *SQLiteRepository) ListMessages(ctx context.Context, sessionID string, agentID string, opts ListOptions) ([]SessionMessage, error) {
+	exists, err := rowExists(ctx, r.db,
+		`SELECT 1 FROM agents WHERE session_id = ? AND agent_id = ?`, sessionID, agentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT session_id, agent_id, idx, message, created_at FROM messages
+		WHERE session_id = ? AND agent_id = ?
+		ORDER BY idx LIMIT ? OFFSET ?`,
+		sessionID, agentID, sqlLimit(opts), opts.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []SessionMessage{}
+	for rows.Next() {
+		var message SessionMessage
+		var data []byte
+		var createdAt int64
+		if err := rows.Scan(&message.SessionID, &message.AgentID, &message.Index, &data, &createdAt); err != nil {
+			return nil, err
+		}
+		message.Message = data
+		message.CreatedAt = fromUnix(createdAt)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (r *SQLiteRepository) SaveBranches(ctx context.Context, branches ...*SessionBranch) error {
+	if len(branches) == 0 {
+		return nil
+	}
+	sessionID, agentID, err := branchesOwner(branches)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		exists, err := rowExists(ctx, tx,
+			`SELECT 1 FROM agents WHERE session_id = ? AND agent_id = ?`, sessionID, agentID,
+		)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		for _, branch := range branches {
+			indexes, err := json.Marshal(branch.MessageIndexes)
+			if err != nil {
+				return err
+			}
+			var createdAt int64
+			err = tx.QueryRowContext(ctx,
+				`SELECT created_at FROM branches WHERE session_id = ? AND agent_id = ? AND branch_id = ?`,
+				branch.SessionID, branch.AgentID, branch.BranchID,
+			).Scan(&createdAt)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				if branch.CreatedAt.IsZero() {
+					branch.CreatedAt = now
+				}
+			case err != nil:
+				return err
+			default:
+				branch.CreatedAt = fromUnix(createdAt)
+			}
+			branch.UpdatedAt = now
+			// an upsert keeps the rowid, which orders branches created at the same time
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO branches
+				(session_id, agent_id, branch_id, parent_id, fork_index, message_indexes, is_current, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (session_id, agent_id, branch_id) DO UPDATE SET
+				parent_id = excluded.parent_id, fork_index = excluded.fork_index, message_indexes = excluded.message_indexes,
+				is_current = excluded.is_current, updated_at = excluded.updated_at`,
+				branch.SessionID, branch.AgentID, branch.BranchID, branch.ParentID, branch.ForkIndex,
+				string(indexes), branch.Current, toUnix(branch.CreatedAt), toUnix(branch.UpdatedAt),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) ListBranches(ctx context.Context, sessionID string, agentID string) ([]SessionBranch, error) {
+	exists, err := rowExists(ctx, r.db,
+		`SELECT 1 FROM agents WHERE session_id = ? AND agent_id = ?`, sessionID, agentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT session_id, agent_id, branch_id, parent_id, fork_index, message_indexes, is_current, created_at, updated_at
+		FROM branches WHERE session_id = ? AND agent_id = ?
+		ORDER BY created_at, rowid`,
+		sessionID, agentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []SessionBranch{}
+	for rows.Next() {
+		var branch SessionBranch
+		var indexes string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(
+			&branch.SessionID, &branch.AgentID, &branch.BranchID, &branch.ParentID, &branch.ForkIndex,
+			&indexes, &branch.Current, &createdAt, &updatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(indexes), &branch.MessageIndexes); err != nil {
+			return nil, err
+		}
+		branch.CreatedAt = fromUnix(createdAt)
+		branch.UpdatedAt = fromUnix(updatedAt)
+		branches = append(branches, branch)
+	}
+	return branches, rows.Err()
+}
+
+func (r *SQLiteRepository) querySessions(ctx context.Context, query string, args ...any) ([]Session, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLiteRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func rowExists(ctx context.Context, q queryer, query string, args ...any) (bool, error) {
+	var one int
+	err := q.QueryRowContext(ctx, query, args...).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func touchSessionTx(ctx context.Context, tx *sql.Tx, sessionID string, updatedAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE sessions SET updated_at = ? WHERE id = ?`, toUnix(updatedAt), sessionID)
+	return err
+}
+
+func scanSession(row interface{ Scan(dest ...any) error }) (*Session, error) {
+	session := &Session{}
+	var createdAt, updatedAt int64
+	if err := row.Scan(&session.ID, &session.UserID, &session.Title, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	session.CreatedAt = fromUnix(createdAt)
+	session.UpdatedAt = fromUnix(updatedAt)
+	return session, nil
+}
+
+// sqlLimit maps a zero Limit to SQLite's "no limit"
+func sqlLimit(opts ListOptions) int {
+	if opts.Limit <= 0 {
+		return -1
+	}
+	return opts.Limit
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func toUnix(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+func fromUnix(n int64) time.Time {
+	return time.Unix(0, n).UTC()
+}
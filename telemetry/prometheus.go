@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// DefaultNamespace prefixes the names of the Prometheus metrics
+const DefaultNamespace = "strands_agents"
+
+// Label names of the Prometheus metrics, any of them can be dropped with WithoutLabels
+const (
+	LabelModel      = "model"
+	LabelStopReason = "stop_reason"
+	LabelTokenType  = "type"
+	LabelTool       = "tool"
+	LabelStatus     = "status"
+)
+
+// PrometheusExporter records model and tool calls as Prometheus metrics
+// It is a hooks.Provider, add it to agents with agents.WithHooks, or to a client with models.WithHookRegistry
+// to also count calls made outside of agents; adding it to both counts the calls of the agent twice
+type PrometheusExporter struct {
+	namespace     string
+	constLabels   prometheus.Labels
+	buckets       []float64
+	droppedLabels []string
+
+	requests          *prometheus.CounterVec
+	requestErrors     *prometheus.CounterVec
+	tokens            *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	timeToFirstToken  *prometheus.HistogramVec
+	retries           *prometheus.CounterVec
+	rateLimited       *prometheus.CounterVec
+	toolCalls         *prometheus.CounterVec
+	toolCallDurations *prometheus.HistogramVec
+}
+
+type PrometheusOption func(e *PrometheusExporter)
+
+// WithNamespace replaces DefaultNamespace
+func WithNamespace(namespace string) PrometheusOption {
+	return func(e *PrometheusExporter) {
+		e.namespace = namespace
+	}
+}
+
+// WithConstLabels adds labels with fixed values to every metric, e.g. the service name
+func WithConstLabels(labels prometheus.Labels) PrometheusOption {
+	return func(e *PrometheusExporter) {
+		e.constLabels = labels
+	}
+}
+
+// WithBuckets sets the buckets in seconds of the latency histograms, the default is prometheus.DefBuckets
+func WithBuckets(buckets []float64) PrometheusOption {
+	return func(e *PrometheusExporter) {
+		e.buckets = buckets
+	}
+}
+
+// WithoutLabels drops labels from every metric that has them,
+// e.g. LabelTool when tool names are generated and would blow up the number of series
+func WithoutLabels(labels ...string) PrometheusOption {
+	return func(e *PrometheusExporter) {
+		e.droppedLabels = append(e.droppedLabels, labels...)
+	}
+}
+
+// NewPrometheusExporter creates the metrics and registers them on registerer
+func NewPrometheusExporter(registerer prometheus.Registerer, options ...PrometheusOption) (*PrometheusExporter, error) {
+	e := &PrometheusExporter{
+		namespace: DefaultNamespace,
+		buckets:   prometheus.DefBuckets,
+	}
+	for _, option := range options {
+		option(e)
+	}
+
+	e.requests = e.counter("model_requests_total", "Model requests by model and stop reason.", LabelModel, LabelStopReason)
+	e.requestErrors = e.counter("model_request_errors_total", "Model requests that failed after all retries.", LabelModel)
+	e.tokens = e.counter("model_tokens_total", "Tokens by model and type: input, output, cache_creation or cache_read.", LabelModel, LabelTokenType)
+	e.requestDuration = e.histogram("model_request_duration_seconds", "Duration of model requests including retries.", LabelModel)
+	e.timeToFirstToken = e.histogram("model_time_to_first_token_seconds", "Time from sending a model request to the first content delta.", LabelModel)
+	e.retries = e.counter("model_retries_total", "Model requests sent again after a failed attempt.", LabelModel)
+	e.rateLimited = e.counter("model_rate_limited_total", "Model responses with status 429.", LabelModel)
+	e.toolCalls = e.counter("tool_calls_total", "Tool calls by tool and status: success, error, timeout, panic or cancelled.", LabelTool, LabelStatus)
+	e.toolCallDurations = e.histogram("tool_call_duration_seconds", "Duration of tool calls.", LabelTool)
+
+	collectors := []prometheus.Collector{
+		e.requests, e.requestErrors, e.tokens, e.requestDuration, e.timeToFirstToken,
+		e.retries, e.rateLimited, e.toolCalls, e.toolCallDurations,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *PrometheusExporter) RegisterHooks(registry *hooks.Registry) {
+	hooks.Add(registry, e.afterModelCall)
+	hooks.Add(registry, e.modelRetry)
+	hooks.Add(registry, e.afterToolCall)
+}
+
+func (e *PrometheusExporter) afterModelCall(ctx context.Context, event *hooks.AfterModelCall) {
+	model := prometheus.Labels{LabelModel: event.Model}
+	if event.Err != nil {
+		e.requestErrors.With(e.labels(model)).Inc()
+		var apiErr *anthropic.Error
+		if errors.As(event.Err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			e.rateLimited.With(e.labels(model)).Inc()
+		}
+	} else {
+		e.requests.With(e.labels(prometheus.Labels{LabelModel: event.Model, LabelStopReason: event.StopReason})).Inc()
+	}
+
+	usage := event.Message.Usage
+	for tokenType, tokens := range map[string]int64{
+		"input":          usage.InputTokens,
+		"output":         usage.OutputTokens,
+		"cache_creation": usage.CacheCreationInputTokens,
+		"cache_read":     usage.CacheReadInputTokens,
+	} {
+		if tokens > 0 {
+			e.tokens.With(e.labels(prometheus.Labels{LabelModel: event.Model, LabelTokenType: tokenType})).Add(float64(tokens))
+		}
+	}
+
+	e.requestDuration.With(e.labels(model)).Observe(event.Duration.Seconds())
+	if event.TimeToFirstToken > 0 {
+		e.timeToFirstToken.With(e.labels(model)).Observe(event.TimeToFirstToken.Seconds())
+	}
+}
+
+func (e *PrometheusExporter) modelRetry(ctx context.Context, event *hooks.ModelRetry) {
+	model := prometheus.Labels{LabelModel: event.Model}
+	e.retries.With(e.labels(model)).Inc()
+	if event.StatusCode == http.StatusTooManyRequests {
+		e.rateLimited.With(e.labels(model)).Inc()
+	}
+}
+
+func (e *PrometheusExporter) afterToolCall(ctx context.Context, event *hooks.AfterToolCall) {
+	status := event.Status
+	switch {
+	case status != "":
+	case event.Result.IsError:
+		status = tools.StatusError
+	default:
+		status = tools.StatusSuccess
+	}
+	e.toolCalls.With(e.labels(prometheus.Labels{LabelTool: event.Name, LabelStatus: string(status)})).Inc()
+	e.toolCallDurations.With(e.labels(prometheus.Labels{LabelTool: event.Name})).Observe(event.Duration.Seconds())
+}
+
+func (e *PrometheusExporter) counter(name, help string, labels ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   e.namespace,
+		Name:        name,
+		Help:        help,
+		ConstLabels: e.constLabels,
+	}, e.labelNames(labels))
+}
+
+func (e *PrometheusExporter) histogram(name, help string, labels ...string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   e.namespace,
+		Name:        name,
+		Help:        help,
+		ConstLabels: e.constLabels,
+		Buckets:     e.buckets,
+	}, e.labelNames(labels))
+}
+
+// labelNames removes the dropped labels
+func (e *PrometheusExporter) labelNames(labels []string) []string {
+	names := []string{}
+	for _, label := range labels {
+		if !slices.Contains(e.droppedLabels, label) {
+			names = append(names, label)
+		}
+	}
+	return names
+}
+
+// labels removes the values of the dropped labels
+func (e *PrometheusExporter) labels(values prometheus.Labels) prometheus.Labels {
+	for _, label := range e.droppedLabels {
+		delete(values, label)
+	}
+	return values
+}
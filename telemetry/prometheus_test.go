@@ -0,0 +1,147 @@
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"testing"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/telemetry"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const model = models.DefaultModelId
+
+// gatheredValue returns the value of a counter, or the sample count of a histogram, whose labels are exactly labels
+func gatheredValue(t *testing.T, registry *prometheus.Registry, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			metricLabels := prometheus.Labels{}
+			for _, pair := range metric.GetLabel() {
+				metricLabels[pair.GetName()] = pair.GetValue()
+			}
+			if !maps.Equal(metricLabels, labels) {
+				continue
+			}
+			if histogram := metric.GetHistogram(); histogram != nil {
+				return float64(histogram.GetSampleCount())
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func runToolAgent(t *testing.T, server *fakeapi.Server, exporter *telemetry.PrometheusExporter) {
+	t.Helper()
+	server.AddTurns(
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{}}}},
+		fakeapi.Turn{Text: "found it"},
+	)
+	lookup := tools.NewFunc(tools.Spec{Name: "lookup"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		return tools.TextResult("42"), nil
+	})
+	agent, err := agents.NewAgent(context.Background(), server.Client(), agents.WithTools(lookup), agents.WithHooks(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "look it up"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	exporter, err := telemetry.NewPrometheusExporter(registry, telemetry.WithConstLabels(prometheus.Labels{"service": "test"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeapi.NewServer(t)
+	runToolAgent(t, server, exporter)
+
+	// direct client calls: one retried rate limit, then one that fails after all retries
+	client := server.Client(models.WithHookRegistry(hooks.NewRegistry(exporter)))
+	messages := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}
+	server.AddTurns(fakeapi.Turn{Status: 429}, fakeapi.Turn{Text: "hello"})
+	response, err := client.StreamMessages(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	server.AddTurns(fakeapi.Turn{Status: 429}, fakeapi.Turn{Status: 429}, fakeapi.Turn{Status: 429})
+	response, err = client.StreamMessages(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err == nil {
+		t.Fatal("expected the rate limit error")
+	}
+
+	testcases := []struct {
+		name     string
+		labels   prometheus.Labels
+		expected float64
+	}{
+		{name: "model_requests_total", labels: prometheus.Labels{"model": model, "stop_reason": "tool_use"}, expected: 1},
+		{name: "model_requests_total", labels: prometheus.Labels{"model": model, "stop_reason": "end_turn"}, expected: 2},
+		{name: "model_request_errors_total", labels: prometheus.Labels{"model": model}, expected: 1},
+		{name: "model_tokens_total", labels: prometheus.Labels{"model": model, "type": "input"}, expected: 30},
+		{name: "model_tokens_total", labels: prometheus.Labels{"model": model, "type": "output"}, expected: 15},
+		{name: "model_retries_total", labels: prometheus.Labels{"model": model}, expected: 3},
+		{name: "model_rate_limited_total", labels: prometheus.Labels{"model": model}, expected: 4},
+		{name: "tool_calls_total", labels: prometheus.Labels{"tool": "lookup", "status": "success"}, expected: 1},
+		{name: "model_request_duration_seconds", labels: prometheus.Labels{"model": model}, expected: 4},
+		{name: "model_time_to_first_token_seconds", labels: prometheus.Labels{"model": model}, expected: 3},
+		{name: "tool_call_duration_seconds", labels: prometheus.Labels{"tool": "lookup"}, expected: 1},
+	}
+	for _, testcase := range testcases {
+		testcase.labels["service"] = "test"
+		if value := gatheredValue(t, registry, "strands_agents_"+testcase.name, testcase.labels); value != testcase.expected {
+			t.Errorf("expected %v for %s %v, got %v", testcase.expected, testcase.name, testcase.labels, value)
+		}
+	}
+
+	if _, err := telemetry.NewPrometheusExporter(registry); err == nil {
+		t.Error("expected an error when registering the metrics twice")
+	}
+}
+
+func TestPrometheusExporter_WithoutLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	exporter, err := telemetry.NewPrometheusExporter(registry,
+		telemetry.WithNamespace("app"),
+		telemetry.WithoutLabels(telemetry.LabelModel, telemetry.LabelTool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runToolAgent(t, fakeapi.NewServer(t), exporter)
+
+	if value := gatheredValue(t, registry, "app_tool_calls_total", prometheus.Labels{"status": "success"}); value != 1 {
+		t.Errorf("expected 1 tool call, got %v", value)
+	}
+	if value := gatheredValue(t, registry, "app_model_tokens_total", prometheus.Labels{"type": "input"}); value != 20 {
+		t.Errorf("expected 20 input tokens, got %v", value)
+	}
+	count, err := testutil.GatherAndCount(registry, "app_model_requests_total")
+	if err != nil || count != 2 {
+		t.Errorf("expected a series per stop reason, got %d %v", count, err)
+	}
+}
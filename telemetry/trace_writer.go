@@ -0,0 +1,271 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/hooks"
+)
+
+// Types of TraceRecord
+const (
+	RecordInvocationStart = "invocation_start"
+	RecordModelCall       = "model_call"
+	RecordModelRetry      = "model_retry"
+	RecordToolCall        = "tool_call"
+	RecordInvocationEnd   = "invocation_end"
+)
+
+// TraceRecord is one line of a trace file
+type TraceRecord struct {
+	TraceID string    `json:"trace_id"`
+	Step    int       `json:"step"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	AgentID string    `json:"agent_id,omitempty"`
+
+	Model      string `json:"model,omitempty"`
+	StopReason string `json:"stop_reason,omitempty"`
+	Tool       string `json:"tool,omitempty"`
+	ToolUseID  string `json:"tool_use_id,omitempty"`
+	// Input is the user message, the model request or the tool input
+	Input json.RawMessage `json:"input,omitempty"`
+	// Output is the last assistant message, the model response or the tool result
+	Output           json.RawMessage `json:"output,omitempty"`
+	Usage            *TraceUsage     `json:"usage,omitempty"`
+	Duration         time.Duration   `json:"duration_ns,omitempty"`
+	TimeToFirstToken time.Duration   `json:"time_to_first_token_ns,omitempty"`
+	Attempt          int             `json:"attempt,omitempty"`
+	StatusCode       int             `json:"status_code,omitempty"`
+	// Status is how a tool call ended
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type TraceUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// TraceWriter writes every agent invocation to its own <trace id>.jsonl file under a directory,
+// one record per step, for eval datasets and for diffing runs
+// It is a hooks.Provider: on an agent it traces invocations, on a client
+// (models.WithHookRegistry) every model call made outside of an invocation gets a trace of its own
+// Records hold prompts, completions and tool data in full
+type TraceWriter struct {
+	dir string
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewTraceWriter creates dir if needed
+func NewTraceWriter(dir string) (*TraceWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &TraceWriter{dir: dir}, nil
+}
+
+// Err returns the errors of failed writes, hooks cannot return them
+func (w *TraceWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.errs...)
+}
+
+func (w *TraceWriter) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs = append(w.errs, err)
+}
+
+// RegisterHooks keeps the running trace per registry, an agent runs one invocation at a time
+func (w *TraceWriter) RegisterHooks(registry *hooks.Registry) {
+	run := &traceRun{writer: w}
+	hooks.Add(registry, run.beforeInvocation)
+	hooks.Add(registry, run.afterModelCall)
+	hooks.Add(registry, run.modelRetry)
+	hooks.Add(registry, run.afterToolCall)
+	hooks.Add(registry, run.afterInvocation)
+}
+
+// traceRun is the trace of the current invocation of one registry
+type traceRun struct {
+	writer *TraceWriter
+
+	mu      sync.Mutex
+	file    *traceFile
+	agentID string
+	started time.Time
+}
+
+func (r *traceRun) beforeInvocation(ctx context.Context, event *hooks.BeforeInvocation) {
+	file, err := r.writer.create()
+	if err != nil {
+		r.writer.fail(err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file, r.agentID, r.started = file, event.AgentID, time.Now()
+	r.write(TraceRecord{Type: RecordInvocationStart, Input: marshal(event.Message)})
+}
+
+func (r *traceRun) afterModelCall(ctx context.Context, event *hooks.AfterModelCall) {
+	record := TraceRecord{
+		Type:       RecordModelCall,
+		Model:      event.Model,
+		StopReason: event.StopReason,
+		Input:      marshal(event.Params),
+		Duration:   event.Duration,
+		Usage: &TraceUsage{
+			InputTokens:              event.Message.Usage.InputTokens,
+			OutputTokens:             event.Message.Usage.OutputTokens,
+			CacheCreationInputTokens: event.Message.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     event.Message.Usage.CacheReadInputTokens,
+		},
+		TimeToFirstToken: event.TimeToFirstToken,
+		Error:            errorText(event.Err),
+	}
+	if event.Err == nil {
+		record.Output = marshal(event.Message.ToParam())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.write(record)
+		return
+	}
+	// a model call outside of an invocation is a trace of its own
+	file, err := r.writer.create()
+	if err != nil {
+		r.writer.fail(err)
+		return
+	}
+	record.Step, record.TraceID, record.Time = 1, file.traceID, time.Now()
+	r.writer.write(file, record)
+	r.writer.close(file)
+}
+
+func (r *traceRun) modelRetry(ctx context.Context, event *hooks.ModelRetry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write(TraceRecord{Type: RecordModelRetry, Model: event.Model, Attempt: event.Attempt, StatusCode: event.StatusCode})
+}
+
+func (r *traceRun) afterToolCall(ctx context.Context, event *hooks.AfterToolCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write(TraceRecord{
+		Type:      RecordToolCall,
+		Tool:      event.Name,
+		ToolUseID: event.ToolUseID,
+		Input:     event.Input,
+		Output:    marshal(event.Result),
+		Duration:  event.Duration,
+		Status:    string(event.Status),
+		Error:     errorText(event.Err),
+	})
+}
+
+func (r *traceRun) afterInvocation(ctx context.Context, event *hooks.AfterInvocation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	record := TraceRecord{Type: RecordInvocationEnd, StopReason: event.StopReason, Duration: time.Since(r.started), Error: errorText(event.Err)}
+	if event.Err == nil {
+		record.Output = marshal(event.Message)
+	}
+	r.write(record)
+	r.writer.close(r.file)
+	r.file = nil
+}
+
+// write adds a record to the running trace, r.mu must be held
+func (r *traceRun) write(record TraceRecord) {
+	if r.file == nil {
+		return
+	}
+	r.file.steps++
+	record.TraceID, record.Step, record.Time, record.AgentID = r.file.traceID, r.file.steps, time.Now(), r.agentID
+	r.writer.write(r.file, record)
+}
+
+type traceFile struct {
+	traceID string
+	file    *os.File
+	encoder *json.Encoder
+	steps   int
+}
+
+func (w *TraceWriter) create() (*traceFile, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	traceID := hex.EncodeToString(id)
+	file, err := os.OpenFile(filepath.Join(w.dir, traceID+".jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &traceFile{traceID: traceID, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (w *TraceWriter) write(file *traceFile, record TraceRecord) {
+	if err := file.encoder.Encode(record); err != nil {
+		w.fail(err)
+	}
+}
+
+func (w *TraceWriter) close(file *traceFile) {
+	if err := file.file.Close(); err != nil {
+		w.fail(err)
+	}
+}
+
+func marshal(value any) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ReadTrace reads the records of a trace file
+func ReadTrace(path string) ([]TraceRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records := []TraceRecord{}
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var record TraceRecord
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,113 @@
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/hooks"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/telemetry"
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+func TestTraceWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "traces")
+	writer, err := telemetry.NewTraceWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{Status: 529},
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "answer"}}}},
+		fakeapi.Turn{Text: "42", InputTokens: 30},
+	)
+	lookup := tools.NewFunc(tools.Spec{Name: "lookup"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		return tools.TextResult("the answer is 42"), nil
+	})
+	agent, err := agents.NewAgent(context.Background(), server.Client(),
+		agents.WithAgentID("assistant"),
+		agents.WithTools(lookup),
+		agents.WithHooks(writer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "what is the answer?"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a call outside of an agent is traced on its own
+	server.AddTurns(fakeapi.Turn{Text: "hello"})
+	client := server.Client(models.WithHookRegistry(hooks.NewRegistry(writer)))
+	response, err := client.StreamMessages(context.Background(), []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 trace files, got %v %v", files, err)
+	}
+	traces := map[int][]telemetry.TraceRecord{}
+	for _, file := range files {
+		records, err := telemetry.ReadTrace(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if records[0].TraceID+".jsonl" != filepath.Base(file) {
+			t.Errorf("trace id %s does not match %s", records[0].TraceID, file)
+		}
+		traces[len(records)] = records
+	}
+
+	run := traces[6]
+	types := []string{}
+	for i, record := range run {
+		types = append(types, record.Type)
+		if record.Step != i+1 || record.AgentID != "assistant" || record.TraceID != run[0].TraceID {
+			t.Errorf("unexpected record %+v", record)
+		}
+	}
+	expected := []string{
+		telemetry.RecordInvocationStart, telemetry.RecordModelRetry, telemetry.RecordModelCall,
+		telemetry.RecordToolCall, telemetry.RecordModelCall, telemetry.RecordInvocationEnd,
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	if !strings.Contains(string(run[0].Input), "what is the answer?") {
+		t.Errorf("unexpected input %s", run[0].Input)
+	}
+	if run[1].StatusCode != 529 || run[1].Attempt != 1 {
+		t.Errorf("unexpected retry %+v", run[1])
+	}
+	if call := run[2]; call.StopReason != "tool_use" || call.Usage.InputTokens != 10 || !strings.Contains(string(call.Input), `"max_tokens":1024`) ||
+		!strings.Contains(string(call.Output), `"name":"lookup"`) {
+		t.Errorf("unexpected model call %+v", call)
+	}
+	if tool := run[3]; tool.Tool != "lookup" || tool.ToolUseID != "tu_1" || string(tool.Input) != `{"q":"answer"}` ||
+		!strings.Contains(string(tool.Output), "the answer is 42") {
+		t.Errorf("unexpected tool call %+v", tool)
+	}
+	if end := run[5]; end.StopReason != "end_turn" || end.Duration <= 0 || !strings.Contains(string(end.Output), `"42"`) {
+		t.Errorf("unexpected end %+v", end)
+	}
+
+	single := traces[1]
+	if len(single) != 1 || single[0].Type != telemetry.RecordModelCall || single[0].AgentID != "" || !strings.Contains(string(single[0].Output), "hello") {
+		t.Errorf("unexpected trace %+v", single)
+	}
+}
@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/yuki5155/go-strands-agents/models"
+	"github.com/yuki5155/go-strands-agents/tools"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans
+const ScopeName = "github.com/yuki5155/go-strands-agents"
+
+// System is the gen_ai.system value of every span
+const System = "anthropic"
+
+// Tracer creates the spans of agent invocations, event loop cycles, model calls and tool calls
+// following the OpenTelemetry GenAI semantic conventions
+type Tracer struct {
+	provider      trace.TracerProvider
+	tracer        trace.Tracer
+	recordContent bool
+}
+
+type TracerOption func(t *Tracer)
+
+// WithTracerProvider sets the provider, the default is the global provider of otel
+func WithTracerProvider(provider trace.TracerProvider) TracerOption {
+	return func(t *Tracer) {
+		t.provider = provider
+	}
+}
+
+// WithContentRecording records prompts, completions and tool input and output as span events
+// They can contain personal data, so it is off by default
+func WithContentRecording(enabled bool) TracerOption {
+	return func(t *Tracer) {
+		t.recordContent = enabled
+	}
+}
+
+func NewTracer(options ...TracerOption) *Tracer {
+	t := &Tracer{}
+	for _, option := range options {
+		option(t)
+	}
+	if t.provider == nil {
+		t.provider = otel.GetTracerProvider()
+	}
+	t.tracer = t.provider.Tracer(ScopeName)
+	return t
+}
+
+// StartInvocation starts the span of one agent invocation, messages are the incoming messages
+func (t *Tracer) StartInvocation(ctx context.Context, agentID string, messages ...anthropic.MessageParam) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, "invoke_agent "+agentID,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "invoke_agent"),
+			attribute.String("gen_ai.system", System),
+			attribute.String("gen_ai.agent.id", agentID),
+			attribute.String("gen_ai.agent.name", agentID),
+		),
+	)
+	t.addMessageEvents(span, messages...)
+	return ctx, span
+}
+
+// EndInvocation ends an invocation span
+func (t *Tracer) EndInvocation(span trace.Span, stopReason string, message anthropic.MessageParam, err error) {
+	if stopReason != "" {
+		span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{stopReason}))
+	}
+	if err == nil {
+		t.addChoiceEvent(span, stopReason, message)
+	}
+	end(span, err)
+}
+
+// StartCycle starts the span of one event loop cycle
+func (t *Tracer) StartCycle(ctx context.Context, cycle int) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "execute_event_loop_cycle",
+		trace.WithAttributes(attribute.Int("event_loop.cycle_id", cycle)),
+	)
+}
+
+// EndCycle ends a cycle span
+func (t *Tracer) EndCycle(span trace.Span, err error) {
+	end(span, err)
+}
+
+// StartModelCall starts the span of one model request
+func (t *Tracer) StartModelCall(ctx context.Context, config *models.AnthropicConfig, messages []anthropic.MessageParam) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, "chat "+config.ModelId,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "chat"),
+			attribute.String("gen_ai.system", System),
+			attribute.String("gen_ai.request.model", config.ModelId),
+			attribute.Int64("gen_ai.request.max_tokens", config.MaxTokens),
+		),
+	)
+	t.addMessageEvents(span, messages...)
+	return ctx, span
+}
+
+// EndModelCall fills the response attributes from response and ends a model call span
+// response may be nil when the request could not be sent
+func (t *Tracer) EndModelCall(span trace.Span, response *models.StreamingResponse, err error) {
+	if response != nil {
+		span.SetAttributes(
+			attribute.String("gen_ai.response.id", response.MessageID),
+			attribute.String("gen_ai.response.model", response.Model),
+			attribute.Int64("gen_ai.usage.input_tokens", response.InputTokens),
+			attribute.Int64("gen_ai.usage.output_tokens", response.OutputTokens),
+			attribute.Int64("gen_ai.usage.cache_creation.input_tokens", response.CacheCreationInputTokens),
+			attribute.Int64("gen_ai.usage.cache_read.input_tokens", response.CacheReadInputTokens),
+		)
+		if response.StopReason != "" {
+			span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{response.StopReason}))
+		}
+		if err == nil {
+			t.addChoiceEvent(span, response.StopReason, response.Message.ToParam())
+		}
+	}
+	end(span, err)
+}
+
+// StartToolCall starts the span of one tool call, tools receive the returned context
+func (t *Tracer) StartToolCall(ctx context.Context, toolUseID string, name string, input json.RawMessage) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, "execute_tool "+name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "execute_tool"),
+			attribute.String("gen_ai.system", System),
+			attribute.String("gen_ai.tool.name", name),
+			attribute.String("gen_ai.tool.call.id", toolUseID),
+		),
+	)
+	if t.recordContent {
+		span.AddEvent("gen_ai.tool.input", trace.WithAttributes(attribute.String("content", string(input))))
+	}
+	return ctx, span
+}
+
+// EndToolCall ends a tool call span, an error result marks the span as failed
+func (t *Tracer) EndToolCall(span trace.Span, result tools.Result, err error) {
+	status := "success"
+	if result.IsError {
+		status = "error"
+	}
+	span.SetAttributes(attribute.String("gen_ai.tool.status", status))
+	if t.recordContent {
+		span.AddEvent("gen_ai.tool.message", trace.WithAttributes(attribute.String("content", result.Text())))
+	}
+	if err == nil && result.IsError {
+		// the result text stays out of the span unless content recording is on
+		span.SetStatus(codes.Error, "tool returned an error result")
+	}
+	end(span, err)
+}
+
+func (t *Tracer) addMessageEvents(span trace.Span, messages ...anthropic.MessageParam) {
+	if !t.recordContent {
+		return
+	}
+	for _, message := range messages {
+		span.AddEvent("gen_ai."+string(message.Role)+".message",
+			trace.WithAttributes(attribute.String("content", contentJSON(message.Content))),
+		)
+	}
+}
+
+func (t *Tracer) addChoiceEvent(span trace.Span, stopReason string, message anthropic.MessageParam) {
+	if !t.recordContent {
+		return
+	}
+	span.AddEvent("gen_ai.choice", trace.WithAttributes(
+		attribute.String("finish_reason", stopReason),
+		attribute.String("message", contentJSON(message.Content)),
+	))
+}
+
+func contentJSON(content []anthropic.ContentBlockParamUnion) string {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,153 @@
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/yuki5155/go-strands-agents/agents"
+	"github.com/yuki5155/go-strands-agents/internal/fakeapi"
+	"github.com/yuki5155/go-strands-agents/telemetry"
+	"github.com/yuki5155/go-strands-agents/tools"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func runAgent(t *testing.T, options ...telemetry.TracerOption) (tracetest.SpanStubs, trace.SpanContext) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	server := fakeapi.NewServer(t,
+		fakeapi.Turn{ToolUses: []fakeapi.ToolUse{{ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "secret question"}}}, InputTokens: 20, OutputTokens: 7},
+		fakeapi.Turn{Text: "secret answer", InputTokens: 30, OutputTokens: 4},
+	)
+
+	var toolSpan trace.SpanContext
+	lookup := tools.NewFunc(tools.Spec{Name: "lookup"}, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		toolSpan = trace.SpanContextFromContext(ctx)
+		return tools.ErrorResult("not found"), nil
+	})
+	options = append(options, telemetry.WithTracerProvider(provider))
+	agent, err := agents.NewAgent(context.Background(), server.Client(),
+		agents.WithAgentID("assistant"),
+		agents.WithTools(lookup),
+		agents.WithTracer(telemetry.NewTracer(options...)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Invoke(context.Background(), "secret prompt"); err != nil {
+		t.Fatal(err)
+	}
+	return exporter.GetSpans(), toolSpan
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q not found", name)
+	return tracetest.SpanStub{}
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestTracer_Spans(t *testing.T) {
+	spans, toolSpan := runAgent(t)
+
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	// spans are exported when they end
+	expected := []string{
+		"chat claude-sonnet-4-5-20250929",
+		"execute_tool lookup",
+		"execute_event_loop_cycle",
+		"chat claude-sonnet-4-5-20250929",
+		"execute_event_loop_cycle",
+		"invoke_agent assistant",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+
+	invocation := findSpan(t, spans, "invoke_agent assistant")
+	cycle := spans[2]
+	model := spans[0]
+	tool := spans[1]
+	if cycle.Parent.SpanID() != invocation.SpanContext.SpanID() || model.Parent.SpanID() != cycle.SpanContext.SpanID() || tool.Parent.SpanID() != cycle.SpanContext.SpanID() {
+		t.Error("unexpected span hierarchy")
+	}
+	if toolSpan.SpanID() != tool.SpanContext.SpanID() {
+		t.Error("tool did not receive the span context")
+	}
+
+	attrs := attributes(model)
+	if attrs["gen_ai.system"].AsString() != "anthropic" ||
+		attrs["gen_ai.request.model"].AsString() != "claude-sonnet-4-5-20250929" ||
+		attrs["gen_ai.request.max_tokens"].AsInt64() != 1024 ||
+		attrs["gen_ai.usage.input_tokens"].AsInt64() != 20 ||
+		attrs["gen_ai.usage.output_tokens"].AsInt64() != 7 ||
+		!reflect.DeepEqual(attrs["gen_ai.response.finish_reasons"].AsStringSlice(), []string{"tool_use"}) {
+		t.Errorf("unexpected model attributes %v", attrs)
+	}
+	if model.SpanKind != trace.SpanKindClient {
+		t.Errorf("expected a client span, got %v", model.SpanKind)
+	}
+
+	attrs = attributes(tool)
+	if attrs["gen_ai.tool.name"].AsString() != "lookup" || attrs["gen_ai.tool.call.id"].AsString() != "tu_1" || attrs["gen_ai.tool.status"].AsString() != "error" {
+		t.Errorf("unexpected tool attributes %v", attrs)
+	}
+	if tool.Status.Code != codes.Error {
+		t.Errorf("expected an error status, got %v", tool.Status)
+	}
+	if !reflect.DeepEqual(attributes(invocation)["gen_ai.response.finish_reasons"].AsStringSlice(), []string{"end_turn"}) {
+		t.Errorf("unexpected invocation attributes %v", invocation.Attributes)
+	}
+
+	// content is not recorded by default
+	for _, span := range spans {
+		if len(span.Events) != 0 {
+			t.Errorf("span %s has events %v", span.Name, span.Events)
+		}
+	}
+}
+
+func TestTracer_ContentRecording(t *testing.T) {
+	spans, _ := runAgent(t, telemetry.WithContentRecording(true))
+
+	events := map[string]bool{}
+	for _, span := range spans {
+		for _, event := range span.Events {
+			events[span.Name+" "+event.Name] = true
+		}
+	}
+	for _, want := range []string{
+		"invoke_agent assistant gen_ai.user.message",
+		"invoke_agent assistant gen_ai.choice",
+		"chat claude-sonnet-4-5-20250929 gen_ai.user.message",
+		"chat claude-sonnet-4-5-20250929 gen_ai.assistant.message",
+		"chat claude-sonnet-4-5-20250929 gen_ai.choice",
+		"execute_tool lookup gen_ai.tool.input",
+		"execute_tool lookup gen_ai.tool.message",
+	} {
+		if !events[want] {
+			t.Errorf("missing event %s in %v", want, events)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+// Package files provides tools that read, search and edit the files below a root directory
+//
+// Paths given by the model are relative to the root, absolute ones must point inside it.
+// Files are opened with os.Root so that neither ".." nor symbolic links can escape the root.
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const (
+	// DefaultMaxFileSize limits the files that are read and written
+	DefaultMaxFileSize = 1 << 20
+	// DefaultMaxResults limits the entries, paths and matches returned by list_directory, glob and grep
+	DefaultMaxResults = 200
+)
+
+var (
+	ErrOutsideRoot = errors.New("files: path is outside the root")
+	ErrTooLarge    = errors.New("files: file is too large")
+	ErrBinary      = errors.New("files: binary file")
+)
+
+// Sandbox confines the tools to a root directory
+type Sandbox struct {
+	dir         string
+	readOnly    bool
+	maxFileSize int64
+	maxResults  int
+}
+
+type Option func(s *Sandbox)
+
+// WithReadOnly leaves out file_write and str_replace
+func WithReadOnly() Option {
+	return func(s *Sandbox) {
+		s.readOnly = true
+	}
+}
+
+// WithMaxFileSize limits the size in bytes of the files that are read, searched and written
+func WithMaxFileSize(size int64) Option {
+	return func(s *Sandbox) {
+		s.maxFileSize = size
+	}
+}
+
+// WithMaxResults limits the entries, paths and matches returned by one call
+func WithMaxResults(n int) Option {
+	return func(s *Sandbox) {
+		s.maxResults = n
+	}
+}
+
+// NewSandbox confines the tools to dir, which must exist
+func NewSandbox(dir string, options ...Option) (*Sandbox, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// absolute paths given by the model are compared with the resolved root
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("files: %s is not a directory", dir)
+	}
+	s := &Sandbox{dir: abs, maxFileSize: DefaultMaxFileSize, maxResults: DefaultMaxResults}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+// Register adds the tools confined to dir to the registry
+func Register(registry *tools.Registry, dir string, options ...Option) error {
+	s, err := NewSandbox(dir, options...)
+	if err != nil {
+		return err
+	}
+	return registry.Register(s.Tools()...)
+}
+
+// Dir returns the resolved root directory
+func (s *Sandbox) Dir() string {
+	return s.dir
+}
+
+// Tools returns file_read, list_directory, glob and grep, and file_write and str_replace unless the sandbox is read-only
+// The tools that write are sequential
+func (s *Sandbox) Tools() []tools.Tool {
+	ts := []tools.Tool{
+		s.tool(tools.Spec{
+			Name:        "file_read",
+			Description: "Reads a text file. Use offset and limit to read a range of lines of a long file.",
+			InputSchema: schema(map[string]any{
+				"path":   property("string", "Path of the file, relative to the root"),
+				"offset": property("integer", "First line to read, starting at 1"),
+				"limit":  property("integer", "Maximum number of lines to read"),
+			}, "path"),
+		}, s.read),
+		s.tool(tools.Spec{
+			Name:        "list_directory",
+			Description: "Lists the entries of a directory, directories end with a slash.",
+			InputSchema: schema(map[string]any{
+				"path": property("string", "Path of the directory, relative to the root, defaults to the root"),
+			}),
+		}, s.list),
+		s.tool(tools.Spec{
+			Name:        "glob",
+			Description: "Finds the paths matching a pattern such as **/*.go, where ** matches any number of directories.",
+			InputSchema: schema(map[string]any{
+				"pattern": property("string", "Glob pattern, relative to the root"),
+			}, "pattern"),
+		}, s.glob),
+		s.tool(tools.Spec{
+			Name:        "grep",
+			Description: "Searches the lines of text files matching a regular expression (RE2 syntax).",
+			InputSchema: schema(map[string]any{
+				"pattern":     property("string", "Regular expression"),
+				"path":        property("string", "File or directory to search, defaults to the root"),
+				"include":     property("string", "Glob pattern the file names must match, e.g. *.go"),
+				"ignore_case": property("boolean", "Match without regard to case"),
+			}, "pattern"),
+		}, s.grep),
+	}
+	if s.readOnly {
+		return ts
+	}
+	return append(ts,
+		tools.Sequential(s.tool(tools.Spec{
+			Name:        "file_write",
+			Description: "Writes a text file, creating it and its parent directories when missing.",
+			InputSchema: schema(map[string]any{
+				"path":    property("string", "Path of the file, relative to the root"),
+				"content": property("string", "Content of the file"),
+				"append":  property("boolean", "Append to the file instead of replacing it"),
+			}, "path", "content"),
+		}, s.write)),
+		tools.Sequential(s.tool(tools.Spec{
+			Name:        "str_replace",
+			Description: "Replaces text in a file. old_str must occur exactly once unless replace_all is set, include enough context to make it unique.",
+			InputSchema: schema(map[string]any{
+				"path":        property("string", "Path of the file, relative to the root"),
+				"old_str":     property("string", "Text to replace, matched exactly"),
+				"new_str":     property("string", "Replacement text"),
+				"replace_all": property("boolean", "Replace every occurrence"),
+			}, "path", "old_str", "new_str"),
+		}, s.replace)),
+	)
+}
+
+func schema(properties map[string]any, required ...string) map[string]any {
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func property(kind, description string) map[string]any {
+	return map[string]any{"type": kind, "description": description}
+}
+
+// tool opens the root for every call, fn gets the decoded input
+func (s *Sandbox) tool(spec tools.Spec, fn func(ctx context.Context, root *os.Root, input params) (string, error)) tools.Tool {
+	return tools.NewFunc(spec, func(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+		var p params
+		if err := json.Unmarshal(input, &p); err != nil {
+			return tools.Result{}, fmt.Errorf("invalid input: %w", err)
+		}
+		root, err := os.OpenRoot(s.dir)
+		if err != nil {
+			return tools.Result{}, err
+		}
+		defer root.Close()
+		text, err := fn(ctx, root, p)
+		if err != nil {
+			return tools.Result{}, err
+		}
+		return tools.TextResult(text), nil
+	})
+}
+
+// params is the input of every tool
+type params struct {
+	Path       string  `json:"path"`
+	Offset     int     `json:"offset"`
+	Limit      int     `json:"limit"`
+	Content    *string `json:"content"`
+	Append     bool    `json:"append"`
+	Pattern    string  `json:"pattern"`
+	Include    string  `json:"include"`
+	IgnoreCase bool    `json:"ignore_case"`
+	OldStr     string  `json:"old_str"`
+	NewStr     *string `json:"new_str"`
+	ReplaceAll bool    `json:"replace_all"`
+}
+
+// rel turns a path given by the model into one relative to the root
+func (s *Sandbox) rel(name string) (string, error) {
+	if name == "" {
+		return ".", nil
+	}
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(s.dir, filepath.Clean(name))
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrOutsideRoot, name)
+		}
+		name = rel
+	}
+	name = filepath.Clean(name)
+	if name != "." && !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, name)
+	}
+	return name, nil
+}
+
+// readText reads a text file within the size limit
+func (s *Sandbox) readText(root *os.Root, name string) (string, os.FileInfo, error) {
+	file, err := root.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		return "", nil, fmt.Errorf("files: %s is a directory", name)
+	}
+	if info.Size() > s.maxFileSize {
+		return "", nil, fmt.Errorf("%w: %s has %d bytes, the limit is %d", ErrTooLarge, name, info.Size(), s.maxFileSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, s.maxFileSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) > s.maxFileSize {
+		return "", nil, fmt.Errorf("%w: %s has more than %d bytes", ErrTooLarge, name, s.maxFileSize)
+	}
+	if isBinary(data) {
+		return "", nil, fmt.Errorf("%w: %s", ErrBinary, name)
+	}
+	return string(data), info, nil
+}
+
+// isBinary reports data with NUL bytes or that is not UTF-8
+func isBinary(data []byte) bool {
+	head := data[:min(len(data), 8000)]
+	return strings.IndexByte(string(head), 0) >= 0 || !utf8.Valid(data)
+}
+
+func (s *Sandbox) read(ctx context.Context, root *os.Root, p params) (string, error) {
+	name, err := s.rel(p.Path)
+	if err != nil {
+		return "", err
+	}
+	text, _, err := s.readText(root, name)
+	if err != nil || (p.Offset <= 1 && p.Limit <= 0) {
+		return text, err
+	}
+	lines := strings.SplitAfter(text, "\n")
+	start := max(p.Offset, 1) - 1
+	if start >= len(lines) {
+		return "", fmt.Errorf("files: %s has %d lines", name, len(lines))
+	}
+	end := len(lines)
+	if p.Limit > 0 {
+		end = min(start+p.Limit, end)
+	}
+	return strings.Join(lines[start:end], ""), nil
+}
+
+func (s *Sandbox) write(ctx context.Context, root *os.Root, p params) (string, error) {
+	name, err := s.rel(p.Path)
+	if err != nil {
+		return "", err
+	}
+	if p.Content == nil {
+		return "", errors.New("files: content is required")
+	}
+	size := int64(len(*p.Content))
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if p.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if info, err := root.Stat(name); err == nil {
+			size += info.Size()
+		}
+	}
+	if size > s.maxFileSize {
+		return "", fmt.Errorf("%w: %s would have %d bytes, the limit is %d", ErrTooLarge, name, size, s.maxFileSize)
+	}
+	if err := mkdirAll(root, filepath.Dir(name)); err != nil {
+		return "", err
+	}
+	file, err := root.OpenFile(name, flags, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(file, *p.Content); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(*p.Content), filepath.ToSlash(name)), nil
+}
+
+// mkdirAll creates dir and its parents inside the root
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := mkdirAll(root, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Sandbox) replace(ctx context.Context, root *os.Root, p params) (string, error) {
+	name, err := s.rel(p.Path)
+	if err != nil {
+		return "", err
+	}
+	if p.OldStr == "" || p.NewStr == nil {
+		return "", errors.New("files: old_str and new_str are required")
+	}
+	text, info, err := s.readText(root, name)
+	if err != nil {
+		return "", err
+	}
+	count := strings.Count(text, p.OldStr)
+	switch {
+	case count == 0:
+		return "", fmt.Errorf("files: old_str not found in %s", name)
+	case count > 1 && !p.ReplaceAll:
+		return "", fmt.Errorf("files: old_str occurs %d times in %s, add context to make it unique or set replace_all", count, name)
+	}
+	text = strings.ReplaceAll(text, p.OldStr, *p.NewStr)
+	if int64(len(text)) > s.maxFileSize {
+		return "", fmt.Errorf("%w: %s would have %d bytes, the limit is %d", ErrTooLarge, name, len(text), s.maxFileSize)
+	}
+	file, err := root.OpenFile(name, os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(file, text); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("replaced %d occurrences in %s", count, filepath.ToSlash(name)), nil
+}
+
+func (s *Sandbox) list(ctx context.Context, root *os.Root, p params) (string, error) {
+	name, err := s.rel(p.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := fs.ReadDir(root.FS(), filepath.ToSlash(name))
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if len(lines) == s.maxResults {
+			lines = append(lines, fmt.Sprintf("(truncated: %d more entries not shown)", len(entries)-s.maxResults))
+			break
+		}
+		switch {
+		case entry.IsDir():
+			lines = append(lines, entry.Name()+"/")
+		case entry.Type()&fs.ModeSymlink != 0:
+			lines = append(lines, entry.Name()+" (symlink)")
+		default:
+			size := int64(0)
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			lines = append(lines, fmt.Sprintf("%s (%d bytes)", entry.Name(), size))
+		}
+	}
+	if len(lines) == 0 {
+		return "the directory is empty", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Sandbox) glob(ctx context.Context, root *os.Root, p params) (string, error) {
+	if p.Pattern == "" {
+		return "", errors.New("files: pattern is required")
+	}
+	pattern := path.Clean(filepath.ToSlash(p.Pattern))
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return "", fmt.Errorf("files: invalid pattern %q: %w", p.Pattern, err)
+	}
+	matches := []string{}
+	truncated := false
+	unreadable, err := s.walk(ctx, root, ".", func(name string, entry fs.DirEntry) bool {
+		if !matchGlob(pattern, name) {
+			return true
+		}
+		if len(matches) == s.maxResults {
+			truncated = true
+			return false
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, name)
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		matches = append(matches, "no paths match "+p.Pattern)
+	}
+	if truncated {
+		matches = append(matches, fmt.Sprintf("... stopped after %d paths", s.maxResults))
+	}
+	return strings.Join(append(matches, skipped(0, unreadable)...), "\n"), nil
+}
+
+// skipped tells the model about the files a search left out, so that it does not take the results as complete
+func skipped(unsupported, unreadable int) []string {
+	notes := []string{}
+	if unsupported > 0 {
+		notes = append(notes, fmt.Sprintf("(%d files skipped: binary or too large)", unsupported))
+	}
+	if unreadable > 0 {
+		notes = append(notes, fmt.Sprintf("(%d paths skipped: unreadable)", unreadable))
+	}
+	return notes
+}
+
+// matchGlob matches a slash separated name, ** matches any number of path segments
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
+
+func (s *Sandbox) grep(ctx context.Context, root *os.Root, p params) (string, error) {
+	name, err := s.rel(p.Path)
+	if err != nil {
+		return "", err
+	}
+	if p.Pattern == "" {
+		return "", errors.New("files: pattern is required")
+	}
+	expr := p.Pattern
+	if p.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("files: invalid pattern: %w", err)
+	}
+
+	matches := []string{}
+	truncated := false
+	unsupported, unreadable := 0, 0
+	walkErrors, err := s.walk(ctx, root, filepath.ToSlash(name), func(file string, entry fs.DirEntry) bool {
+		if !entry.Type().IsRegular() {
+			return true
+		}
+		if ok, _ := path.Match(p.Include, entry.Name()); p.Include != "" && !ok {
+			return true
+		}
+		text, _, err := s.readText(root, filepath.FromSlash(file))
+		switch {
+		case errors.Is(err, ErrBinary) || errors.Is(err, ErrTooLarge):
+			unsupported++
+			return true
+		case err != nil:
+			unreadable++
+			return true
+		}
+		for i, line := range strings.Split(text, "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if len(matches) == s.maxResults {
+				truncated = true
+				return false
+			}
+			matches = append(matches, fmt.Sprintf("%s:%d: %s", file, i+1, line))
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		matches = append(matches, "no matches")
+	}
+	if truncated {
+		matches = append(matches, fmt.Sprintf("... stopped after %d matches", s.maxResults))
+	}
+	return strings.Join(append(matches, skipped(unsupported, unreadable+walkErrors)...), "\n"), nil
+}
+
+// walk calls fn for the entries below dir, or for dir itself when it is a file, until fn returns false
+// Symbolic links are not followed, unreadable directories are skipped and counted
+func (s *Sandbox) walk(ctx context.Context, root *os.Root, dir string, fn func(name string, entry fs.DirEntry) bool) (int, error) {
+	errStop := errors.New("stop")
+	unreadable := 0
+	err := fs.WalkDir(root.FS(), dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if name == dir {
+				return err
+			}
+			unreadable++
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if name == "." {
+			return nil
+		}
+		if !fn(name, entry) {
+			return errStop
+		}
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		return unreadable, nil
+	}
+	return unreadable, err
+}
@@ -0,0 +1,180 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+// sandbox registers the tools for a temporary root holding the given files
+func sandbox(t *testing.T, files map[string]string, options ...Option) (*tools.Registry, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry, _ := tools.NewRegistry()
+	if err := Register(registry, dir, options...); err != nil {
+		t.Fatal(err)
+	}
+	return registry, dir
+}
+
+func call(t *testing.T, registry *tools.Registry, name, input string) (string, error) {
+	t.Helper()
+	tool, err := registry.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tool.Invoke(context.Background(), json.RawMessage(input))
+	return result.Text(), err
+}
+
+func TestSandbox_ReadWrite(t *testing.T) {
+	registry, dir := sandbox(t, map[string]string{"lines.txt": "one\ntwo\nthree\n", "image.bin": "\x89PNG\x00\x01"}, WithMaxFileSize(64))
+
+	if text, err := call(t, registry, "file_read", `{"path":"lines.txt","offset":2,"limit":1}`); err != nil || text != "two\n" {
+		t.Errorf("unexpected range %q %v", text, err)
+	}
+	if _, err := call(t, registry, "file_read", `{"path":"image.bin"}`); !errors.Is(err, ErrBinary) {
+		t.Errorf("expected ErrBinary, got %v", err)
+	}
+
+	if _, err := call(t, registry, "file_write", `{"path":"nested/dir/a.txt","content":"hello"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := call(t, registry, "file_write", `{"path":"nested/dir/a.txt","content":" world","append":true}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := call(t, registry, "file_write", `{"path":"big.txt","content":"`+strings.Repeat("x", 65)+`"}`); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	// absolute paths inside the root are accepted
+	if text, err := call(t, registry, "file_read", `{"path":"`+filepath.ToSlash(filepath.Join(dir, "nested", "dir", "a.txt"))+`"}`); err != nil || text != "hello world" {
+		t.Errorf("unexpected content %q %v", text, err)
+	}
+
+	if _, err := call(t, registry, "str_replace", `{"path":"lines.txt","old_str":"o","new_str":"0"}`); err == nil || !strings.Contains(err.Error(), "occurs 2 times") {
+		t.Errorf("expected an ambiguous replacement, got %v", err)
+	}
+	if _, err := call(t, registry, "str_replace", `{"path":"lines.txt","old_str":"four","new_str":"4"}`); err == nil {
+		t.Error("expected a missing old_str")
+	}
+	if _, err := call(t, registry, "str_replace", `{"path":"lines.txt","old_str":"two\n","new_str":""}`); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "lines.txt")); string(data) != "one\nthree\n" {
+		t.Errorf("unexpected replacement %q", data)
+	}
+}
+
+func TestSandbox_Escapes(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry, dir := sandbox(t, map[string]string{"a.txt": "a"})
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []struct{ tool, input string }{
+		{"file_read", `{"path":"../secret.txt"}`},
+		{"file_read", `{"path":"` + filepath.ToSlash(filepath.Join(outside, "secret.txt")) + `"}`},
+		{"file_read", `{"path":"link.txt"}`},
+		{"file_read", `{"path":"linkdir/secret.txt"}`},
+		{"file_write", `{"path":"linkdir/new.txt","content":"x"}`},
+		{"str_replace", `{"path":"link.txt","old_str":"secret","new_str":"public"}`},
+		{"list_directory", `{"path":"linkdir"}`},
+		{"grep", `{"pattern":"secret","path":"linkdir"}`},
+	} {
+		if text, err := call(t, registry, input.tool, input.input); err == nil {
+			t.Errorf("%s %s escaped the root: %q", input.tool, input.input, text)
+		}
+	}
+	if text, err := call(t, registry, "grep", `{"pattern":"secret"}`); err != nil || text != "no matches" {
+		t.Errorf("grep followed a symlink: %q %v", text, err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Error("a file was written outside the root")
+	}
+}
+
+func TestSandbox_Search(t *testing.T) {
+	registry, _ := sandbox(t, map[string]string{
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"pkg/util.go":      "package pkg\n\nfunc Helper() {}\n",
+		"pkg/deep/deep.go": "package deep\n\nfunc main() {}\n",
+		"README.md":        "func main in docs\n",
+	}, WithMaxResults(2))
+
+	if text, err := call(t, registry, "list_directory", `{}`); err != nil || text != "README.md (18 bytes)\nmain.go (29 bytes)\n(truncated: 1 more entries not shown)" {
+		t.Errorf("unexpected listing %q %v", text, err)
+	}
+	if text, err := call(t, registry, "glob", `{"pattern":"pkg/**/*.go"}`); err != nil || text != "pkg/deep/deep.go\npkg/util.go" {
+		t.Errorf("unexpected glob %q %v", text, err)
+	}
+	if text, err := call(t, registry, "glob", `{"pattern":"**/*.go"}`); err != nil || !strings.HasSuffix(text, "... stopped after 2 paths") {
+		t.Errorf("expected truncated glob, got %q %v", text, err)
+	}
+	if text, err := call(t, registry, "grep", `{"pattern":"FUNC MAIN","include":"*.go","ignore_case":true}`); err != nil || text != "main.go:3: func main() {}\npkg/deep/deep.go:3: func main() {}" {
+		t.Errorf("unexpected grep %q %v", text, err)
+	}
+	if text, err := call(t, registry, "grep", `{"pattern":"Helper","path":"pkg/util.go"}`); err != nil || text != "pkg/util.go:3: func Helper() {}" {
+		t.Errorf("unexpected grep of a file %q %v", text, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	list, _ := registry.Get("list_directory")
+	if _, err := list.Invoke(ctx, json.RawMessage(`{}`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled listing, got %v", err)
+	}
+}
+
+func TestSandbox_SearchSkipped(t *testing.T) {
+	registry, _ := sandbox(t, map[string]string{
+		"notes.txt": "needle\n",
+		"image.bin": "needle\x00",
+		"large.txt": strings.Repeat("needle\n", 20),
+	}, WithMaxFileSize(64))
+
+	if text, err := call(t, registry, "grep", `{"pattern":"needle"}`); err != nil || text != "notes.txt:1: needle\n(2 files skipped: binary or too large)" {
+		t.Errorf("expected the skipped files to be reported, got %q %v", text, err)
+	}
+	if text, err := call(t, registry, "grep", `{"pattern":"haystack"}`); err != nil || text != "no matches\n(2 files skipped: binary or too large)" {
+		t.Errorf("expected the skipped files to be reported, got %q %v", text, err)
+	}
+}
+
+func TestSandbox_ReadOnly(t *testing.T) {
+	registry, _ := sandbox(t, nil, WithReadOnly())
+	names := []string{}
+	for _, tool := range registry.List() {
+		names = append(names, tool.Spec().Name)
+	}
+	if strings.Join(names, ",") != "file_read,glob,grep,list_directory" {
+		t.Errorf("unexpected read-only tools %v", names)
+	}
+
+	registry, _ = sandbox(t, nil)
+	write, _ := registry.Get("file_write")
+	if len(registry.List()) != 6 || !tools.IsSequential(write) {
+		t.Errorf("expected 6 tools with a sequential file_write, got %d", len(registry.List()))
+	}
+}
@@ -0,0 +1,185 @@
+package httprequest
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// skippedElements are not rendered with their content
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true, "math": true, "iframe": true,
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true, "footer": true,
+	"nav": true, "aside": true, "ul": true, "ol": true, "table": true, "tr": true, "blockquote": true,
+	"form": true, "dl": true, "dt": true, "dd": true, "figure": true, "hr": true,
+}
+
+var (
+	spacePattern = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankPattern = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+)
+
+// htmlToText renders an HTML document as markdown, or as plain text without the markdown syntax
+// Relative links and images are resolved against base, the URL the document was read from
+func htmlToText(document string, base *url.URL, markdown bool) string {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		// the parser only fails when reading, which a string does not
+		return document
+	}
+	r := &renderer{markdown: markdown, base: base}
+	r.node(root)
+	text := blankPattern.ReplaceAllString(r.out.String(), "\n\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+type renderer struct {
+	out      strings.Builder
+	markdown bool
+	base     *url.URL
+	pre      int
+	links    []string
+}
+
+func (r *renderer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+		if skippedElements[n.Data] {
+			return
+		}
+		attributes := map[string]string{}
+		for _, attribute := range n.Attr {
+			if attribute.Namespace == "" {
+				attributes[attribute.Key] = attribute.Val
+			}
+		}
+		r.tag(n.Data, false, attributes)
+		defer r.tag(n.Data, true, attributes)
+	case html.DocumentNode:
+	default:
+		// comments and doctypes
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.node(child)
+	}
+}
+
+func (r *renderer) write(s string) {
+	r.out.WriteString(s)
+}
+
+// markup writes markdown syntax, it is left out of plain text
+func (r *renderer) markup(s string) {
+	if r.markdown {
+		r.write(s)
+	}
+}
+
+func (r *renderer) text(s string) {
+	if r.pre > 0 {
+		r.write(s)
+		return
+	}
+	s = spacePattern.ReplaceAllString(s, " ")
+	if current := r.out.String(); s == " " && (current == "" || strings.HasSuffix(current, " ") || strings.HasSuffix(current, "\n")) {
+		return
+	}
+	r.write(s)
+}
+
+// resolve makes a link absolute, links that do not parse are kept as they are
+func (r *renderer) resolve(link string) string {
+	if r.base == nil || link == "" {
+		return link
+	}
+	resolved, err := r.base.Parse(link)
+	if err != nil {
+		return link
+	}
+	return resolved.String()
+}
+
+func (r *renderer) tag(name string, closing bool, attributes map[string]string) {
+	switch name {
+	case "br":
+		if !closing {
+			r.write("\n")
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.write("\n\n")
+		if !closing {
+			r.markup(strings.Repeat("#", int(name[1]-'0')) + " ")
+		}
+	case "li":
+		if !closing {
+			r.write("\n")
+			r.markup("- ")
+		}
+	case "td", "th":
+		if closing {
+			r.write(" ")
+		}
+	case "pre":
+		if closing {
+			r.pre = max(r.pre-1, 0)
+			r.write("\n")
+			r.markup("```")
+			r.write("\n\n")
+		} else {
+			r.pre++
+			r.write("\n\n")
+			r.markup("```\n")
+		}
+	case "code":
+		if r.pre == 0 {
+			r.markup("`")
+		}
+	case "strong", "b":
+		r.markup("**")
+	case "em", "i":
+		r.markup("*")
+	case "a":
+		if !closing {
+			href := strings.TrimSpace(attributes["href"])
+			if strings.HasPrefix(strings.ToLower(href), "javascript:") {
+				href = ""
+			}
+			href = r.resolve(href)
+			r.links = append(r.links, href)
+			if href != "" {
+				r.markup("[")
+			}
+		} else if len(r.links) > 0 {
+			href := r.links[len(r.links)-1]
+			r.links = r.links[:len(r.links)-1]
+			if href != "" {
+				r.markup("](" + href + ")")
+			}
+		}
+	case "img":
+		if alt := attributes["alt"]; alt != "" && !closing {
+			if r.markdown {
+				r.write("![" + alt + "](" + r.resolve(attributes["src"]) + ")")
+			} else {
+				r.write(alt)
+			}
+		}
+	default:
+		if blockElements[name] {
+			r.write("\n\n")
+		}
+	}
+}
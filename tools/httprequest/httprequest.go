@@ -0,0 +1,379 @@
+// Package httprequest provides a tool that sends HTTP requests for the model
+//
+// Requests are limited to the allowed domains and never connect to loopback, private,
+// link-local or other non-public addresses, which is checked for every connection so
+// that redirects and DNS answers cannot reach internal services. Credentials come from
+// the configuration, the model cannot set them, and are only sent over https.
+package httprequest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const (
+	// ToolName is the name of the tool
+	ToolName       = "http_request"
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxResponseSize limits the bytes read of a response body
+	DefaultMaxResponseSize = 1 << 20
+	maxRedirects           = 10
+)
+
+var (
+	ErrDomainNotAllowed = errors.New("httprequest: domain not allowed")
+	ErrBlockedAddress   = errors.New("httprequest: address not allowed")
+)
+
+// sensitiveHeaders are dropped from the headers given by the model
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// nonPublic are the ranges that netip.Addr methods do not cover
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+type credential struct {
+	domain string
+	header string
+	value  string
+	// insecure sends the credential over plain http too
+	insecure bool
+}
+
+type requester struct {
+	domains         []string
+	privateNetworks bool
+	credentials     []credential
+	maxResponseSize int64
+	timeout         time.Duration
+	client          *http.Client
+}
+
+type Option func(r *requester)
+
+// WithAllowedDomains limits the requests to the given hosts, "*.example.com" allows the subdomains of example.com
+// Requests may go to any public host without it
+func WithAllowedDomains(domains ...string) Option {
+	return func(r *requester) {
+		for _, domain := range domains {
+			r.domains = append(r.domains, strings.ToLower(domain))
+		}
+	}
+}
+
+// WithPrivateNetworks allows loopback, private and link-local addresses, e.g. for internal services and tests
+func WithPrivateNetworks() Option {
+	return func(r *requester) {
+		r.privateNetworks = true
+	}
+}
+
+// WithCredential sets a header on the requests to domain, matched like WithAllowedDomains,
+// e.g. WithCredential("api.github.com", "Authorization", "Bearer "+token)
+// The model cannot set or read the header, it is left out of redirects to other hosts and of plain http requests
+func WithCredential(domain, header, value string) Option {
+	return func(r *requester) {
+		r.credentials = append(r.credentials, credential{domain: strings.ToLower(domain), header: http.CanonicalHeaderKey(header), value: value})
+	}
+}
+
+// WithInsecureCredential is WithCredential that also sends the header over plain http,
+// e.g. to an internal service without TLS, anyone on the network path can read it
+func WithInsecureCredential(domain, header, value string) Option {
+	return func(r *requester) {
+		r.credentials = append(r.credentials, credential{domain: strings.ToLower(domain), header: http.CanonicalHeaderKey(header), value: value, insecure: true})
+	}
+}
+
+// WithMaxResponseSize limits the bytes read of a response body, the rest is dropped
+func WithMaxResponseSize(size int64) Option {
+	return func(r *requester) {
+		r.maxResponseSize = size
+	}
+}
+
+// WithTimeout limits the duration of a request including redirects and reading the body
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *requester) {
+		r.timeout = timeout
+	}
+}
+
+// Response is the result of a request, sent to the model as JSON
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// Truncated is set when the body exceeded the maximum response size
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// New creates the http_request tool, responses with a status of 400 or more give error results
+func New(options ...Option) tools.Tool {
+	r := &requester{maxResponseSize: DefaultMaxResponseSize, timeout: DefaultTimeout}
+	for _, option := range options {
+		option(r)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: r.control}
+	r.client = &http.Client{
+		Timeout: r.timeout,
+		Transport: &credentialTransport{requester: r, next: &http.Transport{
+			// a proxy would connect on our behalf without the address check
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("httprequest: stopped after %d redirects", maxRedirects)
+			}
+			return r.checkURL(req.URL)
+		},
+	}
+
+	return tools.NewFunc(tools.Spec{
+		Name:        ToolName,
+		Description: r.description(),
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"url":     map[string]any{"type": "string", "description": "http or https URL"},
+				"method":  map[string]any{"type": "string", "description": "HTTP method, defaults to GET"},
+				"headers": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "description": "Request headers, credentials are added by the tool"},
+				"json":    map[string]any{"description": "Body sent as JSON"},
+				"form":    map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "description": "Body sent URL-encoded"},
+				"body":    map[string]any{"type": "string", "description": "Raw body"},
+				"format":  map[string]any{"type": "string", "enum": []string{"markdown", "text", "raw"}, "description": "How HTML responses are returned, defaults to markdown"},
+			},
+			"required": []string{"url"},
+		},
+	}, r.invoke)
+}
+
+func (r *requester) description() string {
+	description := "Sends an HTTP request and returns the status, headers and body. HTML pages are converted to markdown."
+	if len(r.domains) > 0 {
+		description += " Allowed domains: " + strings.Join(r.domains, ", ") + "."
+	}
+	return description
+}
+
+type params struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	JSON    json.RawMessage   `json:"json"`
+	Form    map[string]string `json:"form"`
+	Body    *string           `json:"body"`
+	Format  string            `json:"format"`
+}
+
+func (r *requester) invoke(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+	var p params
+	if err := json.Unmarshal(input, &p); err != nil {
+		return tools.Result{}, fmt.Errorf("invalid input: %w", err)
+	}
+	req, err := r.request(ctx, p)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, r.maxResponseSize+1))
+	if err != nil {
+		return tools.Result{}, fmt.Errorf("httprequest: reading the response: %w", err)
+	}
+
+	response := Response{Status: resp.StatusCode, Headers: map[string]string{}}
+	if int64(len(data)) > r.maxResponseSize {
+		data, response.Truncated = data[:r.maxResponseSize], true
+	}
+	for name := range resp.Header {
+		if name != "Set-Cookie" {
+			response.Headers[name] = resp.Header.Get(name)
+		}
+	}
+	response.Body = body(data, resp.Header.Get("Content-Type"), p.Format, resp.Request.URL)
+	text, err := json.Marshal(response)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	result := tools.TextResult(string(text))
+	result.IsError = resp.StatusCode >= 400
+	return result, nil
+}
+
+func (r *requester) request(ctx context.Context, p params) (*http.Request, error) {
+	target, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("httprequest: invalid url: %w", err)
+	}
+	if err := r.checkURL(target); err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	contentType := ""
+	bodies := 0
+	if len(p.JSON) > 0 && string(p.JSON) != "null" {
+		body, contentType = strings.NewReader(string(p.JSON)), "application/json"
+		bodies++
+	}
+	if p.Form != nil {
+		form := url.Values{}
+		for key, value := range p.Form {
+			form.Set(key, value)
+		}
+		body, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+		bodies++
+	}
+	if p.Body != nil {
+		body = strings.NewReader(*p.Body)
+		bodies++
+	}
+	if bodies > 1 {
+		return nil, errors.New("httprequest: give only one of json, form and body")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("httprequest: %w", err)
+	}
+	for name, value := range p.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if slices.Contains(sensitiveHeaders, name) || r.isCredential(name) {
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// checkURL applies the scheme and the domain allowlist, addresses are checked when connecting
+func (r *requester) checkURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("httprequest: unsupported scheme %q", target.Scheme)
+	}
+	if target.User != nil {
+		return errors.New("httprequest: credentials in the url are not allowed")
+	}
+	host := strings.ToLower(target.Hostname())
+	if host == "" {
+		return errors.New("httprequest: the url has no host")
+	}
+	if len(r.domains) > 0 && !slices.ContainsFunc(r.domains, func(domain string) bool { return matchDomain(domain, host) }) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+	return nil
+}
+
+// matchDomain matches a host with "example.com" or "*.example.com"
+func matchDomain(domain, host string) bool {
+	if suffix, ok := strings.CutPrefix(domain, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == domain
+}
+
+// control runs before every connection, with the address DNS resolved to
+func (r *requester) control(network, address string, _ syscall.RawConn) error {
+	if r.privateNetworks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	return !slices.ContainsFunc(nonPublic, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+func (r *requester) isCredential(header string) bool {
+	return slices.ContainsFunc(r.credentials, func(c credential) bool { return c.header == header })
+}
+
+// credentialTransport sets the credentials of the host on every request, redirects included
+// Credentials are only sent over https unless they were set with WithInsecureCredential
+type credentialTransport struct {
+	requester *requester
+	next      http.RoundTripper
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	secure := req.URL.Scheme == "https"
+	req = req.Clone(req.Context())
+	for _, c := range t.requester.credentials {
+		// the client copies the headers of the first request to redirects
+		req.Header.Del(c.header)
+	}
+	for _, c := range t.requester.credentials {
+		if matchDomain(c.domain, host) && (secure || c.insecure) {
+			req.Header.Set(c.header, c.value)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// body converts HTML to markdown or text unless format is raw, binary content is left out
+// Links in HTML are resolved against base, the URL of the last request after redirects
+func body(data []byte, contentType, format string, base *url.URL) string {
+	if !utf8.Valid(data) {
+		// a truncated body may end within a character
+		trimmed := data
+		for i := 0; i < utf8.UTFMax && len(trimmed) > 0 && !utf8.Valid(trimmed); i++ {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if !utf8.Valid(trimmed) {
+			return fmt.Sprintf("(%d bytes of binary content)", len(data))
+		}
+		data = trimmed
+	}
+	if strings.Contains(strings.ToLower(contentType), "html") && format != "raw" {
+		return htmlToText(string(data), base, format != "text")
+	}
+	return string(data)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package shell
+
+import "os/exec"
+
+// processGroup only kills the command itself, the children of the command are not tracked
+func processGroup(cmd *exec.Cmd) func() {
+	return func() {}
+}
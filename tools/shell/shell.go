@@ -0,0 +1,295 @@
+// Package shell provides a tool that runs commands in a working directory
+//
+// Commands are executables looked up in PATH and run without a shell, so that pipes,
+// redirections and substitutions cannot get around the allowlist. The working directory
+// is confined to a root, but the commands themselves can still reach any file they name,
+// allow only executables that are safe with any argument.
+//
+// The tool needs an allowlist or the approval of the caller for every command. A denylist
+// alone is not a security control: env, xargs, busybox, interpreters and any other
+// executable that runs commands get around it.
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxOutput limits the bytes kept of stdout and of stderr
+	DefaultMaxOutput = 64 << 10
+	// ToolName is the name of the tool
+	ToolName = "shell"
+)
+
+var (
+	ErrNotAllowed = errors.New("shell: command not allowed")
+	// ErrNoPolicy is returned by New without an allowlist or approval
+	ErrNoPolicy = errors.New("shell: an allowlist (WithAllow) or approval (WithApproval) is required")
+)
+
+type shell struct {
+	dir       string
+	allow     []string
+	deny      []string
+	env       []string
+	timeout   time.Duration
+	maxOutput int
+	approval  string
+}
+
+type Option func(s *shell)
+
+// WithAllow only runs the given executables
+func WithAllow(executables ...string) Option {
+	return func(s *shell) {
+		s.allow = append(s.allow, executables...)
+	}
+}
+
+// WithDeny never runs the given executables, e.g. to take some out of the approved ones
+// It does not stop the allowed or approved executables from running the denied ones
+func WithDeny(executables ...string) Option {
+	return func(s *shell) {
+		s.deny = append(s.deny, executables...)
+	}
+}
+
+// WithEnv passes the given variables of the process to the commands,
+// which only get PATH and HOME, set to the root, otherwise
+func WithEnv(names ...string) Option {
+	return func(s *shell) {
+		s.env = append(s.env, names...)
+	}
+}
+
+// WithTimeout limits how long a command runs, it is killed afterwards
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *shell) {
+		s.timeout = timeout
+	}
+}
+
+// WithMaxOutput limits the bytes kept of stdout and of stderr, the rest is dropped
+func WithMaxOutput(size int) Option {
+	return func(s *shell) {
+		s.maxOutput = size
+	}
+}
+
+// WithApproval makes agents ask the caller before running any command, see tools.RequireApproval
+func WithApproval(reason string) Option {
+	return func(s *shell) {
+		s.approval = reason
+	}
+}
+
+// Output is the result of a command, sent to the model as JSON
+type Output struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	// Truncated is set when stdout or stderr exceeded the maximum output
+	Truncated bool `json:"truncated,omitempty"`
+	TimedOut  bool `json:"timed_out,omitempty"`
+}
+
+// New creates the shell tool running commands in dir or below it
+// A command that fails, exits with a non-zero code or times out gives an error result
+// It fails with ErrNoPolicy unless WithAllow or WithApproval is given
+func New(dir string, options ...Option) (tools.Tool, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	s := &shell{dir: abs, timeout: DefaultTimeout, maxOutput: DefaultMaxOutput}
+	for _, option := range options {
+		option(s)
+	}
+	if len(s.allow) == 0 && s.approval == "" {
+		return nil, ErrNoPolicy
+	}
+	tool := tools.NewFunc(tools.Spec{
+		Name:        ToolName,
+		Description: s.description(),
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "description": "Executable to run, looked up in PATH"},
+				"args":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Arguments, passed as they are without shell expansion"},
+				"dir":     map[string]any{"type": "string", "description": "Working directory relative to the root, defaults to the root"},
+				"stdin":   map[string]any{"type": "string", "description": "Input written to the command"},
+			},
+			"required": []string{"command"},
+		},
+	}, s.run)
+	if s.approval != "" {
+		tool = tools.RequireApproval(tool, s.approval)
+	}
+	return tool, nil
+}
+
+func (s *shell) description() string {
+	description := "Runs a command without a shell and returns its exit code, stdout and stderr."
+	if len(s.allow) > 0 {
+		description += " Allowed commands: " + strings.Join(s.allow, ", ") + "."
+	}
+	return description
+}
+
+func (s *shell) run(ctx context.Context, input json.RawMessage) (tools.Result, error) {
+	var params struct {
+		Command string   `json:"command"`
+		Args    []string `json:"args"`
+		Dir     string   `json:"dir"`
+		Stdin   string   `json:"stdin"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return tools.Result{}, fmt.Errorf("invalid input: %w", err)
+	}
+	if err := s.check(params.Command); err != nil {
+		return tools.Result{}, err
+	}
+	dir, err := s.workDir(params.Dir)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	env := s.environ()
+	path, err := lookPath(params.Command, env)
+	if err != nil {
+		return tools.Result{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, params.Args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(params.Stdin)
+	// children that keep the pipes open do not hold the call after the kill
+	cmd.WaitDelay = time.Second
+	// the kill reaches the children of the command too, where the platform allows it
+	killGroup := processGroup(cmd)
+	stdout, stderr := &limitedBuffer{max: s.maxOutput}, &limitedBuffer{max: s.maxOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err = cmd.Run()
+	// processes left in the background do not outlive the call
+	killGroup()
+	output := Output{
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !output.TimedOut && !errors.Is(err, exec.ErrWaitDelay) {
+		return tools.Result{}, fmt.Errorf("shell: %s: %w", params.Command, err)
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		return tools.Result{}, err
+	}
+	result := tools.TextResult(string(data))
+	result.IsError = output.ExitCode != 0 || output.TimedOut
+	return result, nil
+}
+
+// check applies the allowlist and denylist to the executable, which must be a name without a path
+func (s *shell) check(command string) error {
+	if command == "" {
+		return errors.New("shell: command is required")
+	}
+	if strings.ContainsAny(command, `/\`) {
+		return fmt.Errorf("%w: %s, give the name of an executable in PATH", ErrNotAllowed, command)
+	}
+	if slices.Contains(s.deny, command) || (len(s.allow) > 0 && !slices.Contains(s.allow, command)) {
+		return fmt.Errorf("%w: %s", ErrNotAllowed, command)
+	}
+	return nil
+}
+
+// workDir resolves the working directory, symlinks must not lead out of the root
+func (s *shell) workDir(dir string) (string, error) {
+	if dir == "" || dir == "." {
+		return s.dir, nil
+	}
+	if !filepath.IsLocal(dir) {
+		return "", fmt.Errorf("shell: directory %s is outside the root", dir)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(s.dir, dir))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(s.dir, resolved); err != nil || !(rel == "." || filepath.IsLocal(rel)) {
+		return "", fmt.Errorf("shell: directory %s is outside the root", dir)
+	}
+	return resolved, nil
+}
+
+// environ keeps PATH and the variables passed with WithEnv
+func (s *shell) environ() []string {
+	env := []string{"HOME=" + s.dir}
+	for _, name := range append([]string{"PATH"}, s.env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// lookPath finds the executable in the PATH of the scrubbed environment
+func lookPath(command string, env []string) (string, error) {
+	for _, variable := range env {
+		if dirs, ok := strings.CutPrefix(variable, "PATH="); ok {
+			for _, dir := range filepath.SplitList(dirs) {
+				if !filepath.IsAbs(dir) {
+					// relative entries would run executables of the working directory
+					continue
+				}
+				path := filepath.Join(dir, command)
+				if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+					return path, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("shell: %s: %w", command, exec.ErrNotFound)
+}
+
+// limitedBuffer keeps the first max bytes written to it
+// The buffer is not embedded, its ReadFrom would let io.Copy get around the limit
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
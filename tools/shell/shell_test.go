@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuki5155/go-strands-agents/tools"
+)
+
+func run(t *testing.T, tool tools.Tool, input string) (Output, tools.Result, error) {
+	t.Helper()
+	result, err := tool.Invoke(context.Background(), json.RawMessage(input))
+	var output Output
+	if err == nil {
+		if err := json.Unmarshal([]byte(result.Text()), &output); err != nil {
+			t.Fatalf("unexpected result %q: %v", result.Text(), err)
+		}
+	}
+	return output, result, err
+}
+
+func TestShell(t *testing.T) {
+	for _, command := range []string{"sh", "pwd", "sleep", "env"} {
+		if _, err := exec.LookPath(command); err != nil {
+			t.Skip(command, "is not available")
+		}
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SHELL_TEST_SECRET", "secret")
+	t.Setenv("SHELL_TEST_VISIBLE", "visible")
+	for _, options := range [][]Option{nil, {WithDeny("rm")}} {
+		if _, err := New(dir, options...); !errors.Is(err, ErrNoPolicy) {
+			t.Errorf("expected ErrNoPolicy, got %v", err)
+		}
+	}
+	tool, err := New(dir, WithApproval("runs commands"), WithDeny("rm"), WithEnv("SHELL_TEST_VISIBLE"), WithTimeout(200*time.Millisecond), WithMaxOutput(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, result, err := run(t, tool, `{"command":"sh","args":["-c","printf 'out'; printf 'err' >&2; exit 3"]}`)
+	if err != nil || output.ExitCode != 3 || output.Stdout != "out" || output.Stderr != "err" || !result.IsError {
+		t.Errorf("unexpected output %+v %v", output, err)
+	}
+	if output, _, err := run(t, tool, `{"command":"sh","args":["-c","cat; echo 0123456789"],"stdin":"in"}`); err != nil || output.Stdout != "in012345" || !output.Truncated {
+		t.Errorf("expected truncated output, got %+v %v", output, err)
+	}
+	resolved, _ := filepath.EvalSymlinks(dir)
+	if output, result, err := run(t, defaultTool(t, dir), `{"command":"pwd","dir":"sub"}`); err != nil || strings.TrimSpace(output.Stdout) != filepath.Join(resolved, "sub") || result.IsError {
+		t.Errorf("unexpected working directory %+v %v", output, err)
+	}
+	if output, _, err := run(t, defaultTool(t, dir), `{"command":"env"}`); err != nil || strings.Contains(output.Stdout, "SHELL_TEST_SECRET") || strings.Contains(output.Stdout, "SHELL_TEST_VISIBLE") {
+		t.Errorf("the environment was not scrubbed: %+v %v", output, err)
+	}
+	if output, _, err := run(t, tool, `{"command":"sh","args":["-c","echo $SHELL_TEST_VISIBLE"]}`); err != nil || output.Stdout != "visible\n" {
+		t.Errorf("expected the passed variable, got %+v %v", output, err)
+	}
+
+	started := time.Now()
+	if output, result, err := run(t, tool, `{"command":"sleep","args":["5"]}`); err != nil || !output.TimedOut || !result.IsError || time.Since(started) > 3*time.Second {
+		t.Errorf("expected a timeout, got %+v %v after %v", output, err, time.Since(started))
+	}
+
+	for _, input := range []string{
+		`{"command":"rm","args":["-rf","sub"]}`,
+		`{"command":"/bin/sh","args":["-c","true"]}`,
+		`{"command":"pwd","dir":"../"}`,
+		`{"command":"pwd","dir":"out"}`,
+	} {
+		if _, _, err := run(t, tool, input); err == nil {
+			t.Errorf("expected %s to be rejected", input)
+		}
+	}
+
+	allowed, _ := New(dir, WithAllow("pwd"), WithApproval("runs commands"))
+	if _, _, err := run(t, allowed, `{"command":"sh","args":["-c","true"]}`); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed, got %v", err)
+	}
+	if tools.ApprovalReason(allowed) != "runs commands" {
+		t.Error("expected the tool to require approval")
+	}
+}
+
+// defaultTool is a shell with the default options in dir
+func defaultTool(t *testing.T, dir string) tools.Tool {
+	t.Helper()
+	tool, err := New(dir, WithAllow("pwd", "env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tool
+}
+
+func TestShell_KillsChildren(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil || runtime.GOOS != "linux" {
+		t.Skip("/proc is not available")
+	}
+	tool, err := New(t.TempDir(), WithAllow("sh"), WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []string{
+		// the background process is left behind when the command exits
+		"sleep 100 >/dev/null 2>&1 & echo $!",
+		// the command times out and only its own process would be killed
+		"sleep 100 >/dev/null 2>&1 & echo $!; wait",
+	} {
+		input, _ := json.Marshal(map[string]any{"command": "sh", "args": []string{"-c", script}})
+		output, _, err := run(t, tool, string(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid := strings.TrimSpace(output.Stdout)
+		deadline := time.Now().Add(5 * time.Second)
+		for running(pid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("process %s of %q is still running", pid, script)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
+
+// running reports whether the process exists and is not a zombie
+func running(pid string) bool {
+	stat, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
@@ -0,0 +1,308 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+)
+
+var (
+	ErrToolNotFound  = errors.New("tools: tool not found")
+	ErrDuplicateTool = errors.New("tools: duplicate tool name")
+)
+
+// Spec describes a tool to the model
+type Spec struct {
+	Name        string
+	Description string
+	// InputSchema is a JSON schema object, it defaults to an object without properties
+	InputSchema map[string]any
+}
+
+// Result is what a tool returns to the model as a tool_result block
+type Result struct {
+	Content []anthropic.ToolResultBlockParamContentUnion
+	IsError bool
+}
+
+// TextResult is a successful result with a single text block
+func TextResult(text string) Result {
+	return Result{Content: []anthropic.ToolResultBlockParamContentUnion{
+		{OfText: &anthropic.TextBlockParam{Text: text}},
+	}}
+}
+
+// ErrorResult tells the model that the tool failed
+func ErrorResult(message string) Result {
+	result := TextResult(message)
+	result.IsError = true
+	return result
+}
+
+// ToBlock builds the tool_result block for the tool use with the given id
+func (r Result) ToBlock(toolUseID string) anthropic.ContentBlockParamUnion {
+	return anthropic.ContentBlockParamUnion{OfToolResult: &anthropic.ToolResultBlockParam{
+		ToolUseID: toolUseID,
+		Content:   r.Content,
+		IsError:   anthropic.Bool(r.IsError),
+	}}
+}
+
+// Text joins the text blocks of the result
+func (r Result) Text() string {
+	text := ""
+	for _, block := range r.Content {
+		if block.OfText != nil {
+			text += block.OfText.Text
+		}
+	}
+	return text
+}
+
+// Tool is something the model can call
+// An error returned by Invoke is sent to the model as an error result
+type Tool interface {
+	Spec() Spec
+	Invoke(ctx context.Context, input json.RawMessage) (Result, error)
+}
+
+type funcTool struct {
+	spec Spec
+	fn   func(ctx context.Context, input json.RawMessage) (Result, error)
+}
+
+func (t *funcTool) Spec() Spec {
+	return t.spec
+}
+
+func (t *funcTool) Invoke(ctx context.Context, input json.RawMessage) (Result, error) {
+	return t.fn(ctx, input)
+}
+
+// NewFunc creates a tool from a function
+func NewFunc(spec Spec, fn func(ctx context.Context, input json.RawMessage) (Result, error)) Tool {
+	return &funcTool{spec: spec, fn: fn}
+}
+
+// Status is how a tool call ended
+type Status string
+
+const (
+	StatusSuccess   Status = "success"
+	StatusError     Status = "error"
+	StatusTimeout   Status = "timeout"
+	StatusPanic     Status = "panic"
+	StatusCancelled Status = "cancelled"
+	// StatusDenied is a call the user refused to approve
+	StatusDenied Status = "denied"
+)
+
+// Wrapper is implemented by tools that wrap another tool, e.g. the ones of Sequential and WithTimeout
+type Wrapper interface {
+	Unwrap() Tool
+}
+
+// find looks for a tool implementing T in the chain of wrapped tools
+func find[T any](tool Tool) (T, bool) {
+	for tool != nil {
+		if found, ok := tool.(T); ok {
+			return found, true
+		}
+		wrapper, ok := tool.(Wrapper)
+		if !ok {
+			break
+		}
+		tool = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+type sequentialTool struct {
+	Tool
+}
+
+func (t sequentialTool) Unwrap() Tool {
+	return t.Tool
+}
+
+func (sequentialTool) Sequential() bool {
+	return true
+}
+
+// Sequential marks a tool that is not safe for concurrent use,
+// agents that run tool calls in parallel run it alone
+func Sequential(tool Tool) Tool {
+	return sequentialTool{tool}
+}
+
+// IsSequential reports whether a tool was marked with Sequential or has a Sequential method returning true
+func IsSequential(tool Tool) bool {
+	sequential, ok := find[interface{ Sequential() bool }](tool)
+	return ok && sequential.Sequential()
+}
+
+type timeoutTool struct {
+	Tool
+	timeout time.Duration
+}
+
+func (t timeoutTool) Unwrap() Tool {
+	return t.Tool
+}
+
+func (t timeoutTool) Timeout() time.Duration {
+	return t.timeout
+}
+
+// WithTimeout limits how long agents wait for the tool, it takes precedence over the agent's timeout
+func WithTimeout(tool Tool, timeout time.Duration) Tool {
+	return timeoutTool{Tool: tool, timeout: timeout}
+}
+
+// Timeout returns the timeout set with WithTimeout or by a Timeout method of the tool, zero when there is none
+func Timeout(tool Tool) time.Duration {
+	if timeout, ok := find[interface{ Timeout() time.Duration }](tool); ok {
+		return timeout.Timeout()
+	}
+	return 0
+}
+
+type approvalTool struct {
+	Tool
+	reason string
+}
+
+func (t approvalTool) Unwrap() Tool {
+	return t.Tool
+}
+
+func (t approvalTool) ApprovalReason() string {
+	return t.reason
+}
+
+// RequireApproval makes agents pause before calling the tool until the caller approves,
+// denies or edits the call, reason tells the caller why, e.g. "deletes files"
+func RequireApproval(tool Tool, reason string) Tool {
+	return approvalTool{Tool: tool, reason: reason}
+}
+
+// ApprovalReason returns the reason set with RequireApproval or by an ApprovalReason method of the tool,
+// empty when calls need no approval
+func ApprovalReason(tool Tool) string {
+	if approval, ok := find[interface{ ApprovalReason() string }](tool); ok {
+		return approval.ApprovalReason()
+	}
+	return ""
+}
+
+// Registry holds the tools available to an agent
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{tools: map[string]Tool{}}
+	if err := r.Register(tools...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds tools, names must be unique
+func (r *Registry) Register(tools ...Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tool := range tools {
+		name := tool.Spec().Name
+		if name == "" {
+			return fmt.Errorf("tools: tool without a name")
+		}
+		if _, ok := r.tools[name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateTool, name)
+		}
+		r.tools[name] = tool
+	}
+	return nil
+}
+
+// Unregister removes a tool, unknown names are ignored
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+func (r *Registry) Get(name string) (Tool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	return tool, nil
+}
+
+// List returns the tools sorted by name
+func (r *Registry) List() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := make([]Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Spec().Name < tools[j].Spec().Name
+	})
+	return tools
+}
+
+// ToolParams converts the tools into the request's tools field
+func (r *Registry) ToolParams() []anthropic.ToolUnionParam {
+	params := []anthropic.ToolUnionParam{}
+	for _, tool := range r.List() {
+		params = append(params, ToolParam(tool.Spec()))
+	}
+	return params
+}
+
+// ToolParam converts a spec into the SDK's tool definition
+func ToolParam(spec Spec) anthropic.ToolUnionParam {
+	schema := anthropic.ToolInputSchemaParam{ExtraFields: map[string]any{}}
+	for key, value := range spec.InputSchema {
+		switch key {
+		case "type":
+		case "properties":
+			schema.Properties = value
+		case "required":
+			// schemas decoded from JSON hold []any
+			switch required := value.(type) {
+			case []string:
+				schema.Required = required
+			case []any:
+				for _, name := range required {
+					if s, ok := name.(string); ok {
+						schema.Required = append(schema.Required, s)
+					}
+				}
+			}
+		default:
+			schema.ExtraFields[key] = value
+		}
+	}
+	tool := anthropic.ToolParam{
+		Name:        spec.Name,
+		InputSchema: schema,
+	}
+	if spec.Description != "" {
+		tool.Description = anthropic.String(spec.Description)
+	}
+	return anthropic.ToolUnionParam{OfTool: &tool}
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func echoTool(name string) Tool {
+	return NewFunc(Spec{
+		Name:        name,
+		Description: "echoes the input",
+		InputSchema: map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{"text": map[string]any{"type": "string"}},
+			"required":             []any{"text"},
+			"additionalProperties": false,
+		},
+	}, func(ctx context.Context, input json.RawMessage) (Result, error) {
+		return TextResult(string(input)), nil
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	registry, err := NewRegistry(echoTool("b"), echoTool("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(echoTool("a")); !errors.Is(err, ErrDuplicateTool) {
+		t.Errorf("expected ErrDuplicateTool, got %v", err)
+	}
+	names := []string{}
+	for _, tool := range registry.List() {
+		names = append(names, tool.Spec().Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	registry.Unregister("b")
+	if _, err := registry.Get("b"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("expected ErrToolNotFound, got %v", err)
+	}
+	tool, err := registry.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tool.Invoke(context.Background(), json.RawMessage(`{"text":"hi"}`))
+	if err != nil || result.Text() != `{"text":"hi"}` {
+		t.Errorf("unexpected result %q %v", result.Text(), err)
+	}
+}
+
+func TestToolParam(t *testing.T) {
+	param := ToolParam(echoTool("echo").Spec())
+	data, err := json.Marshal(param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	schema := decoded["input_schema"].(map[string]any)
+	if schema["type"] != "object" || schema["additionalProperties"] != false {
+		t.Errorf("unexpected schema %v", schema)
+	}
+	if !reflect.DeepEqual(schema["required"], []any{"text"}) {
+		t.Errorf("unexpected required %v", schema["required"])
+	}
+	if decoded["description"] != "echoes the input" {
+		t.Errorf("unexpected description %v", decoded["description"])
+	}
+}
+
+func TestResult_ToBlock(t *testing.T) {
+	block := ErrorResult("boom").ToBlock("tu_1")
+	if block.OfToolResult == nil || block.OfToolResult.ToolUseID != "tu_1" || !block.OfToolResult.IsError.Value {
+		t.Errorf("unexpected block %+v", block)
+	}
+}
+
+func TestWrappers(t *testing.T) {
+	tool := echoTool("echo")
+	if IsSequential(tool) || Timeout(tool) != 0 {
+		t.Errorf("expected no marks on %v", tool.Spec().Name)
+	}
+	wrapped := Sequential(WithTimeout(tool, time.Second))
+	if !IsSequential(wrapped) || Timeout(wrapped) != time.Second || wrapped.Spec().Name != "echo" {
+		t.Errorf("expected the marks of every wrapper")
+	}
+	if wrapped = WithTimeout(Sequential(tool), time.Minute); !IsSequential(wrapped) || Timeout(wrapped) != time.Minute {
+		t.Errorf("expected the marks of every wrapper")
+	}
+	result, err := wrapped.Invoke(context.Background(), json.RawMessage(`{"text":"hi"}`))
+	if err != nil || result.Text() == "" {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+}
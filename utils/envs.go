@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -41,7 +41,7 @@ func LoadEnvs() {
 		}
 	}
 
-	log.Println("Warning: Could not load .env file from any common location")
+	slog.Debug("could not load .env file from any common location")
 }
 
 func GetApiKeyFromEnv() (string, bool) {